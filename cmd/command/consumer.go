@@ -5,15 +5,20 @@ import (
 	"arvan/message-gateway/internal/constant"
 	"arvan/message-gateway/internal/domain"
 	"arvan/message-gateway/internal/infra"
+	"arvan/message-gateway/internal/offset"
 	"arvan/message-gateway/internal/provider"
 	"arvan/message-gateway/internal/queue"
+	"arvan/message-gateway/internal/repository"
+	balanceService "arvan/message-gateway/internal/service/balance"
+	dlrService "arvan/message-gateway/internal/service/dlr"
+	refundService "arvan/message-gateway/internal/service/refund"
 	"arvan/message-gateway/internal/worker"
 	"context"
 	"encoding/json"
 	"github.com/segmentio/kafka-go"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -33,11 +38,55 @@ func (cmd ConsumerCommand) Command(ctx context.Context, cfg *config.Config) *cob
 }
 
 func (cmd ConsumerCommand) main(cfg *config.Config, ctx context.Context) {
-	queueManager := queue.NewQueueManager()
-	smsProvider := provider.NewStubProvider()
-	kafkaConsumerSmsAccepted := infra.NewKafkaConsumer(cfg.Kafka, constant.TopicAccepted)
+	psql, err := infra.NewPostgresClient(ctx, cfg.Database.Postgres)
+	if err != nil {
+		cmd.Logger.WithContext(ctx).Fatal(errors.Wrap(err, "consume : failed to connect to postgresql"))
+		return
+	}
+
+	redisClient, err := infra.NewRedisClient(ctx, cfg.Database.Redis, cmd.Logger)
+	if err != nil {
+		cmd.Logger.WithContext(ctx).Fatal(errors.Wrap(err, "consume : failed to connect to redis"))
+		return
+	}
+
+	// the consumer only refunds failed messages, it never queues sms log writes
+	balanceServiceInstance := balanceService.NewBalanceService(redisClient, psql.GetDb(), cmd.Logger, 0, 0)
+
+	queueManager := queue.NewQueueManager(cfg.Scheduler)
+	kafkaConsumerSmsAccepted := infra.NewKafkaConsumer(cfg.Kafka, constant.TopicAccepted, constant.KafkaGroupID)
 	kafkaSmsStatusWriter := infra.NewKafkaWriter(cfg.Kafka, constant.TopicStatus)
-	pool := worker.NewWorkerPool(queueManager, smsProvider, cfg.WorkerCount, kafkaSmsStatusWriter)
+	refundServiceInstance := refundService.NewRefundService(
+		balanceServiceInstance,
+		cfg.Delivery.RefundPolicy,
+		kafkaSmsStatusWriter,
+		cmd.Logger,
+	)
+
+	// receipts of providers with a session, e.g. smpp, are resolved the same
+	// way as the ones posted to the dlr endpoint
+	dlrServiceInstance := dlrService.NewDlrService(
+		repository.NewProviderMessageRepository(psql.GetDb()),
+		redisClient,
+		kafkaSmsStatusWriter,
+		cfg.Providers,
+		refundServiceInstance,
+		cmd.Logger,
+	)
+	smsProvider, err := provider.NewRouted(ctx, cfg, dlrServiceInstance.Report, cmd.Logger)
+	if err != nil {
+		cmd.Logger.WithContext(ctx).Fatal(errors.Wrap(err, "consume : failed to create sms providers"))
+		return
+	}
+	pool := worker.NewWorkerPool(
+		queueManager,
+		smsProvider,
+		cfg.WorkerCount,
+		kafkaSmsStatusWriter,
+		cfg.Delivery,
+		refundServiceInstance,
+		dlrServiceInstance,
+	)
 
 	pool.Start(ctx)
 
@@ -46,60 +95,63 @@ func (cmd ConsumerCommand) main(cfg *config.Config, ctx context.Context) {
 		numConsumers = 10
 	}
 
+	// offsets are committed only once the worker pool is done with a job, so
+	// jobs still waiting in the queue manager are read again after a crash
+	tracker := offset.NewTracker(kafkaConsumerSmsAccepted, cmd.Logger)
+	go tracker.Run(ctx, constant.KafkaCommitInterval)
+
+	// a single fetcher tracks the messages in partition order before they are
+	// handed to the consumer goroutines
+	fetched := make(chan kafka.Message, numConsumers)
+	go func() {
+		defer close(fetched)
+		for {
+			m, err := kafkaConsumerSmsAccepted.FetchMessage(ctx)
+			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+				}
+				cmd.Logger.WithContext(ctx).Errorf("kafka consumer: fetch error: %v", err)
+				time.Sleep(500 * time.Millisecond)
+				continue
+			}
+
+			tracker.Track(m)
+
+			select {
+			case fetched <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
 	for i := 0; i < numConsumers; i++ {
 		consumerID := i
 		go func() {
-			for {
-				m, err := kafkaConsumerSmsAccepted.ReadMessage(ctx)
-				if err != nil {
-					select {
-					case <-ctx.Done():
-						return
-					default:
-					}
-					cmd.Logger.WithContext(ctx).Errorf("kafka consumer %d: read error: %v", consumerID, err)
-					time.Sleep(500 * time.Millisecond)
-					continue
-				}
-
+			for m := range fetched {
 				var sms domain.Sms
 				if err := json.Unmarshal(m.Value, &sms); err != nil {
 					cmd.Logger.WithContext(ctx).Errorf("kafka consumer %d: invalid payload: %v", consumerID, err)
+					tracker.Done(m)
 					continue
 				}
 
-				job := domain.Job{
-					ID:         uuid.NewString(),
-					CustomerID: sms.CustomerId,
-					Phone:      sms.To,
-					Message:    sms.Message,
-					Priority:   sms.Priority,
-					CreatedAt:  time.Now(),
-				}
-
-				msg := struct {
-					domain.Job `json:",inline"`
-					Status     string `json:"status"`
-				}{
-					job,
-					"processing",
-				}
-
-				marshalled, err := json.Marshal(msg)
-				if err != nil {
-					cmd.Logger.WithContext(ctx).Warnf("kafka publish to status topic consumer_id [%d]:  error: %v", consumerID, err)
-				}
+				job := sms.ToJob()
 
-				if err = kafkaSmsStatusWriter.WriteMessages(ctx, kafka.Message{
-					Key:   []byte(job.ID),
-					Value: marshalled,
-					Time:  time.Now(),
-				}); err != nil {
+				if err := infra.WriteStatusEvent(ctx, kafkaSmsStatusWriter, domain.NewStatusEvent(job, domain.StatusQueued, "")); err != nil {
 					cmd.Logger.WithContext(ctx).Warnf("kafka publish to status topic consumer_id [%d]: error: %v", consumerID, err)
 				}
+				job.Status = domain.StatusQueued
 
+				job.Done = func() {
+					tracker.Done(m)
+				}
 				if err := queueManager.Enqueue(sms.CustomerId, job); err != nil {
 					cmd.Logger.WithContext(ctx).Errorf("kafka consumer %d: enqueue error: %v", consumerID, err)
+					tracker.Done(m)
 				}
 			}
 		}()
@@ -110,9 +162,20 @@ func (cmd ConsumerCommand) main(cfg *config.Config, ctx context.Context) {
 	select {
 	case <-ctx.Done():
 		cmd.Logger.WithContext(ctx).Info("kafka consumer: context done, shutting down...")
+		pool.Stop(ctx)
+
+		commitCtx, cancel := context.WithTimeout(context.Background(), constant.KafkaWriteTimeout)
+		if err := tracker.Commit(commitCtx); err != nil {
+			cmd.Logger.WithContext(ctx).Errorf("kafka consumer: final commit error: %v", err)
+		}
+		cancel()
+
 		if err := kafkaConsumerSmsAccepted.Close(); err != nil {
 			cmd.Logger.WithContext(ctx).Errorf("kafka consumer: close error: %s", err.Error())
 		}
-		pool.Stop(ctx)
+		balanceServiceInstance.Stop()
+		if err := redisClient.Close(); err != nil {
+			cmd.Logger.WithContext(ctx).Errorf("kafka consumer: redis close error: %s", err.Error())
+		}
 	}
 }
@@ -0,0 +1,125 @@
+package command
+
+import (
+	"arvan/message-gateway/internal/config"
+	"arvan/message-gateway/internal/domain"
+	"arvan/message-gateway/internal/infra"
+	"arvan/message-gateway/internal/repository"
+	dlqService "arvan/message-gateway/internal/service/dlq"
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type DlqCommand struct {
+	Logger *log.Logger
+}
+
+func (cmd DlqCommand) Command(ctx context.Context, cfg *config.Config) *cobra.Command {
+	var (
+		listLimit   int
+		replayLimit int
+		force       bool
+		all         bool
+	)
+
+	root := &cobra.Command{
+		Use:   "dlq",
+		Short: "inspect and replay messages parked in kafka_dlq",
+	}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "list messages in kafka_dlq",
+		Run: func(_ *cobra.Command, _ []string) {
+			cmd.list(cfg, ctx, listLimit)
+		},
+	}
+	list.Flags().IntVar(&listLimit, "limit", 100, "maximum number of rows to show")
+
+	replay := &cobra.Command{
+		Use:   "replay",
+		Short: "republish messages in kafka_dlq to their original topic",
+		Run: func(_ *cobra.Command, _ []string) {
+			cmd.replay(cfg, ctx, replayLimit, force)
+		},
+	}
+	replay.Flags().IntVar(&replayLimit, "limit", 1000, "maximum number of rows to replay")
+	replay.Flags().BoolVar(&force, "force", false, "ignore the backoff of rows")
+
+	purge := &cobra.Command{
+		Use:   "purge",
+		Short: "delete messages that reached the max attempts from kafka_dlq",
+		Run: func(_ *cobra.Command, _ []string) {
+			cmd.purge(cfg, ctx, all)
+		},
+	}
+	purge.Flags().BoolVar(&all, "all", false, "delete every row instead of only exhausted ones")
+
+	root.AddCommand(list, replay, purge)
+
+	return root
+}
+
+type dlqManager interface {
+	List(ctx context.Context, limit int) ([]domain.DlqMessage, error)
+	Replay(ctx context.Context, limit int, force bool) (int, int, error)
+	Purge(ctx context.Context, all bool) (int, error)
+}
+
+func (cmd DlqCommand) service(cfg *config.Config, ctx context.Context) dlqManager {
+	psql, err := infra.NewPostgresClient(ctx, cfg.Database.Postgres)
+	if err != nil {
+		cmd.Logger.WithContext(ctx).Fatal(errors.Wrap(err, "dlq : failed to connect to postgresql"))
+	}
+
+	return dlqService.NewDlqService(
+		repository.NewDlqRepository(psql.GetDb()),
+		infra.NewKafkaWriter(cfg.Kafka, ""),
+		cfg.Dlq,
+		cmd.Logger,
+	)
+}
+
+func (cmd DlqCommand) list(cfg *config.Config, ctx context.Context, limit int) {
+	messages, err := cmd.service(cfg, ctx).List(ctx, limit)
+	if err != nil {
+		cmd.Logger.WithContext(ctx).Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tTOPIC\tKEY\tATTEMPTS\tCREATED AT\tLAST ATTEMPT AT")
+	for _, msg := range messages {
+		lastAttempt := "-"
+		if msg.LastAttemptAt != nil {
+			lastAttempt = msg.LastAttemptAt.Format(time.RFC3339)
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\n",
+			msg.ID, msg.Topic, msg.Key, msg.Attempts, msg.CreatedAt.Format(time.RFC3339), lastAttempt)
+	}
+	_ = w.Flush()
+}
+
+func (cmd DlqCommand) replay(cfg *config.Config, ctx context.Context, limit int, force bool) {
+	succeeded, failed, err := cmd.service(cfg, ctx).Replay(ctx, limit, force)
+	if err != nil {
+		cmd.Logger.WithContext(ctx).Fatal(err)
+	}
+
+	cmd.Logger.WithContext(ctx).Infof("dlq replay: republished %d messages, %d failed", succeeded, failed)
+}
+
+func (cmd DlqCommand) purge(cfg *config.Config, ctx context.Context, all bool) {
+	deleted, err := cmd.service(cfg, ctx).Purge(ctx, all)
+	if err != nil {
+		cmd.Logger.WithContext(ctx).Fatal(err)
+	}
+
+	cmd.Logger.WithContext(ctx).Infof("dlq purge: deleted %d messages", deleted)
+}
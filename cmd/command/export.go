@@ -0,0 +1,105 @@
+package command
+
+import (
+	"arvan/message-gateway/internal/config"
+	"arvan/message-gateway/internal/domain"
+	"arvan/message-gateway/internal/infra"
+	"arvan/message-gateway/internal/repository"
+	exportService "arvan/message-gateway/internal/service/export"
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type ExportCommand struct {
+	Logger *log.Logger
+}
+
+func (cmd ExportCommand) Command(ctx context.Context, cfg *config.Config) *cobra.Command {
+	var (
+		customerId int
+		format     string
+		from, to   string
+		output     string
+	)
+
+	export := &cobra.Command{
+		Use:   "export",
+		Short: "export the sms log of a customer from ClickHouse to a local file",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			fromTime, err := time.Parse(time.RFC3339, from)
+			if err != nil {
+				return errors.Wrap(err, "invalid --from")
+			}
+			toTime, err := time.Parse(time.RFC3339, to)
+			if err != nil {
+				return errors.Wrap(err, "invalid --to")
+			}
+			if !fromTime.Before(toTime) {
+				return errors.New("--from must be before --to")
+			}
+			exportFormat := domain.ExportFormat(format)
+			if !exportFormat.Valid() {
+				return errors.New("--format must be csv or ndjson")
+			}
+			if output == "" {
+				output = fmt.Sprintf("sms-log-%d-%s-%s.%s", customerId, fromTime.UTC().Format("20060102"), toTime.UTC().Format("20060102"), exportFormat)
+			}
+
+			cmd.main(cfg, ctx, customerId, exportFormat, fromTime, toTime, output)
+			return nil
+		},
+	}
+	export.Flags().IntVar(&customerId, "customer", 0, "customer whose messages are exported")
+	export.Flags().StringVar(&format, "format", string(domain.ExportFormatCSV), "csv or ndjson")
+	export.Flags().StringVar(&from, "from", "", "accepted at or after, RFC3339")
+	export.Flags().StringVar(&to, "to", "", "accepted before, RFC3339")
+	export.Flags().StringVarP(&output, "output", "o", "", "file to write, named after the customer and range by default")
+	_ = export.MarkFlagRequired("customer")
+	_ = export.MarkFlagRequired("from")
+	_ = export.MarkFlagRequired("to")
+
+	return export
+}
+
+// main writes the export next to output first and renames it once complete,
+// a failed export never leaves a truncated file under the final name.
+func (cmd ExportCommand) main(cfg *config.Config, ctx context.Context, customerId int, format domain.ExportFormat, from, to time.Time, output string) {
+	clickhouseDb, err := infra.NewClickHouseClient(cfg.Database.ClickHouse)
+	if err != nil {
+		cmd.Logger.WithContext(ctx).Fatal(errors.Wrap(err, "export : failed to connect to clickhouse"))
+	}
+
+	exporter := exportService.NewExportService(repository.NewSmsRepository(nil, clickhouseDb.GetDb()))
+
+	partial := output + ".part"
+	file, err := os.Create(partial)
+	if err != nil {
+		cmd.Logger.WithContext(ctx).Fatal(errors.Wrap(err, "export : failed to create output file"))
+	}
+
+	w := bufio.NewWriter(file)
+	rows, err := exporter.Export(ctx, customerId, format, from, to, w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(partial)
+		cmd.Logger.WithContext(ctx).Fatal(errors.Wrap(err, "export : failed to export sms log"))
+	}
+
+	if err := os.Rename(partial, output); err != nil {
+		cmd.Logger.WithContext(ctx).Fatal(errors.Wrap(err, "export : failed to move output file"))
+	}
+
+	cmd.Logger.WithContext(ctx).Infof("export: wrote %d messages of customer %d to %s", rows, customerId, output)
+}
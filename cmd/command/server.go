@@ -4,11 +4,15 @@ import (
 	"arvan/message-gateway/internal/api/middleware"
 	"arvan/message-gateway/internal/constant"
 	"arvan/message-gateway/internal/repository"
-	"arvan/message-gateway/internal/service/plan"
+	apiKeyService "arvan/message-gateway/internal/service/apikey"
+	dlqService "arvan/message-gateway/internal/service/dlq"
+	dlrService "arvan/message-gateway/internal/service/dlr"
+	exportService "arvan/message-gateway/internal/service/export"
+	outboxService "arvan/message-gateway/internal/service/outbox"
+	refundService "arvan/message-gateway/internal/service/refund"
 	smsService "arvan/message-gateway/internal/service/sms"
+	webhookService "arvan/message-gateway/internal/service/webhook"
 	"context"
-	"crypto/sha256"
-	"encoding/json"
 	"fmt"
 
 	"github.com/pkg/errors"
@@ -16,7 +20,10 @@ import (
 	"github.com/spf13/cobra"
 
 	"arvan/message-gateway/internal/api"
+	"arvan/message-gateway/internal/api/handler/apikey"
+	"arvan/message-gateway/internal/api/handler/dlr"
 	"arvan/message-gateway/internal/api/handler/sms"
+	"arvan/message-gateway/internal/api/handler/webhook"
 	"arvan/message-gateway/internal/config"
 	"arvan/message-gateway/internal/infra"
 	balanceService "arvan/message-gateway/internal/service/balance"
@@ -61,14 +68,21 @@ func (cmd Server) main(cfg *config.Config, ctx context.Context) {
 		}
 	}()
 
-	kafkaWriterSmsAccepted := infra.NewKafkaWriter(cfg.Kafka, constant.TopicAccepted)
 	kafkaSmsStatusWriter := infra.NewKafkaWriter(cfg.Kafka, constant.TopicStatus)
 
-	planRepository := repository.NewPlanRepository(psql.GetDb())
+	apiKeyRepository := repository.NewApiKeyRepository(psql.GetDb())
 	dlqRepository := repository.NewDlqRepository(psql.GetDb())
+	outboxRepository := repository.NewOutboxRepository(psql.GetDb())
 	smsRepository := repository.NewSmsRepository(psql.GetDb(), clickhouse.GetDb())
+	webhookRepository := repository.NewWebhookRepository(psql.GetDb())
+	providerMessageRepository := repository.NewProviderMessageRepository(psql.GetDb())
 
-	planServiceInstance := plan.NewPlanService(planRepository, redisClient)
+	apiKeyServiceInstance := apiKeyService.NewApiKeyService(
+		apiKeyRepository,
+		repository.NewPlanRepository(psql.GetDb()),
+		redisClient,
+		cmd.Logger,
+	)
 
 	balanceServiceInstance := balanceService.NewBalanceService(
 		redisClient,
@@ -85,48 +99,71 @@ func (cmd Server) main(cfg *config.Config, ctx context.Context) {
 	smsServiceInstance := smsService.NewSmsService(
 		balanceServiceInstance,
 		dlqRepository,
+		outboxRepository,
 		smsRepository,
 		redisClient,
 		cmd.Logger,
-		kafkaWriterSmsAccepted,
 		kafkaSmsStatusWriter,
 	)
 
-	plans, err := planServiceInstance.GetAllPlansAndSetInRedis(ctx)
-	if err != nil {
-		cmd.Logger.WithContext(ctx).Fatal(errors.Wrap(err, "server : failed to get all plans and set in redis"))
-		return
-	}
-
-	marshalled, err := json.Marshal(plans)
-	if err != nil {
-		cmd.Logger.WithContext(ctx).Fatal(errors.Wrap(err, "server : failed to marshal plans"))
-		return
-	}
-
-	h := sha256.New()
-	h.Write(marshalled)
-	hash := h.Sum(nil)
-
-	smsHandler := sms.New(smsServiceInstance)
+	smsHandler := sms.New(smsServiceInstance, exportService.NewExportService(smsRepository))
+	webhookHandler := webhook.New(webhookService.NewWebhookService(webhookRepository, cmd.Logger))
+	dlrServiceInstance := dlrService.NewDlrService(
+		providerMessageRepository,
+		redisClient,
+		kafkaSmsStatusWriter,
+		cfg.Providers,
+		refundService.NewRefundService(balanceServiceInstance, cfg.Delivery.RefundPolicy, kafkaSmsStatusWriter, cmd.Logger),
+		cmd.Logger,
+	)
+	dlrHandler := dlr.New(dlrServiceInstance)
+	apiKeyHandler := apikey.New(apiKeyServiceInstance)
 
 	priorityMiddleware := middleware.NewPriorityMiddleware(
 		redisClient,
-		planServiceInstance,
-		plans,
-		string(hash),
+		apiKeyServiceInstance,
+		cfg.Auth,
+		cmd.Logger,
 	)
+	defer priorityMiddleware.Stop()
+
+	idempotencyMiddleware := middleware.NewIdempotencyMiddleware(redisClient, constant.IdempotencyTTL, constant.IdempotencyInProgressTTL)
+	adminMiddleware := middleware.NewAdminMiddleware(cfg.Auth.AdminToken)
 
 	server := api.New(cfg.AppEnv)
 	server.SetupAPIRoutes(
 		smsHandler,
+		webhookHandler,
+		dlrHandler,
+		apiKeyHandler,
 		priorityMiddleware,
+		idempotencyMiddleware,
+		adminMiddleware,
 	)
 
-	for i := 0; i < constant.KafkaWriteWorkerPool; i++ {
-		go smsServiceInstance.ProduceMessages(i)
+	outboxServiceInstance := outboxService.NewOutboxService(
+		outboxRepository,
+		infra.NewKafkaWriter(cfg.Kafka, ""),
+		cmd.Logger,
+	)
+	go outboxServiceInstance.Relay(ctx)
+
+	go smsServiceInstance.ReleaseScheduled(ctx)
+
+	go dlrServiceInstance.Purge(ctx)
+
+	go balanceServiceInstance.ReconcileRefunds(ctx)
+
+	if cfg.Dlq.RedriveEnabled {
+		dlqServiceInstance := dlqService.NewDlqService(
+			dlqRepository,
+			infra.NewKafkaWriter(cfg.Kafka, ""),
+			cfg.Dlq,
+			cmd.Logger,
+		)
+		go dlqServiceInstance.Redrive(ctx)
+		cmd.Logger.WithContext(ctx).Infof("started dlq re-driver every %s", cfg.Dlq.RedriveInterval)
 	}
-	cmd.Logger.WithContext(ctx).Infof("started %d kafka producer workers", constant.KafkaWriteWorkerPool)
 
 	defer func() {
 		cmd.Logger.Info("shutting down balance service...")
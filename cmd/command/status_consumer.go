@@ -5,11 +5,15 @@ import (
 	"arvan/message-gateway/internal/constant"
 	"arvan/message-gateway/internal/domain"
 	"arvan/message-gateway/internal/infra"
+	"arvan/message-gateway/internal/offset"
 	"arvan/message-gateway/internal/repository"
+	statusService "arvan/message-gateway/internal/service/status"
 	"context"
 	"encoding/json"
+	"sync"
 	"time"
 
+	"github.com/segmentio/kafka-go"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -18,6 +22,13 @@ type StatusConsumerCommand struct {
 	Logger *log.Logger
 }
 
+// fetchedStatus is a status event with the kafka message it was read from,
+// the offset is done once the event is in clickhouse.
+type fetchedStatus struct {
+	event   domain.StatusEvent
+	message kafka.Message
+}
+
 func (cmd StatusConsumerCommand) Command(ctx context.Context, cfg *config.Config) *cobra.Command {
 	return &cobra.Command{
 		Use:   "consume-status",
@@ -34,7 +45,7 @@ func (cmd StatusConsumerCommand) main(cfg *config.Config, ctx context.Context) {
 		cmd.Logger.WithContext(ctx).Fatalf("failed to initialize ClickHouse client: %v", err)
 	}
 
-	kafkaConsumerSmsStatus := infra.NewKafkaConsumer(cfg.Kafka, constant.TopicStatus)
+	kafkaConsumerSmsStatus := infra.NewKafkaConsumer(cfg.Kafka, constant.TopicStatus, constant.KafkaGroupID)
 	defer func() {
 		if err := kafkaConsumerSmsStatus.Close(); err != nil {
 			cmd.Logger.WithContext(ctx).Errorf("failed to close Kafka consumer: %v", err)
@@ -43,112 +54,181 @@ func (cmd StatusConsumerCommand) main(cfg *config.Config, ctx context.Context) {
 
 	smsRepo := repository.NewSmsRepository(nil, clickhouseDb.GetDb())
 
-	numConsumers := cfg.WorkerCount
-	if numConsumers == 0 {
-		numConsumers = 4
-	}
+	statusServiceInstance := statusService.NewStatusService(smsRepo, cmd.Logger)
+	go statusServiceInstance.Run(ctx)
 
-	cmd.Logger.WithContext(ctx).Infof("starting %d consumer goroutines for sms.status topic", numConsumers)
+	// offsets are committed only once the events up to them are flushed, a
+	// crash reads the unflushed events again
+	tracker := offset.NewTracker(kafkaConsumerSmsStatus, cmd.Logger)
+	go tracker.Run(ctx, constant.KafkaCommitInterval)
 
-	msgChan := make(chan domain.SMSStatus, 1000)
+	msgChan := make(chan fetchedStatus, cfg.StatusLog.BatchSize)
 
-	for i := 0; i < numConsumers; i++ {
-		consumerID := i
-		go func() {
-			for {
+	// a single reader checks the transitions in the order of the partitions,
+	// the events of a message share its key and partition
+	go func() {
+		defer close(msgChan)
+		for {
+			m, err := kafkaConsumerSmsStatus.FetchMessage(ctx)
+			if err != nil {
 				select {
 				case <-ctx.Done():
-					cmd.Logger.WithContext(ctx).Infof("consumer %d: context cancelled, shutting down", consumerID)
+					cmd.Logger.WithContext(ctx).Info("status reader: context cancelled, shutting down")
 					return
 				default:
-					m, err := kafkaConsumerSmsStatus.ReadMessage(ctx)
-					if err != nil {
-						select {
-						case <-ctx.Done():
-							return
-						default:
-						}
-						cmd.Logger.WithContext(ctx).Errorf("consumer %d: read error: %v", consumerID, err)
-						time.Sleep(500 * time.Millisecond)
-						continue
-					}
-
-					var status domain.SMSStatus
-					if err := json.Unmarshal(m.Value, &status); err != nil {
-						cmd.Logger.WithContext(ctx).Errorf("consumer %d: failed to unmarshal message: %v, raw: %s", consumerID, err, string(m.Value))
-						continue
-					}
-
-					select {
-					case msgChan <- status:
-					case <-ctx.Done():
-						return
-					}
 				}
+				cmd.Logger.WithContext(ctx).Errorf("status reader: fetch error: %v", err)
+				time.Sleep(500 * time.Millisecond)
+				continue
 			}
-		}()
-	}
-
-	numWriters := 4
-	for i := 0; i < numWriters; i++ {
-		writerID := i
-		go func() {
-			batch := make([]domain.SMSStatus, 0, 100)
-			ticker := time.NewTicker(1 * time.Second)
-			defer ticker.Stop()
 
-			flushBatch := func() {
-				if len(batch) == 0 {
-					return
-				}
+			tracker.Track(m)
 
-				insertCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-				defer cancel()
-
-				for _, status := range batch {
-					err := smsRepo.InsertSMSStatus(
-						insertCtx,
-						status.ID,
-						status.CustomerID,
-						status.Phone,
-						status.Message,
-						status.Status,
-						status.Priority,
-						status.CreatedAt,
-						time.Now(),
-					)
-					if err != nil {
-						cmd.Logger.WithContext(ctx).Errorf("writer %d: failed to insert status: %v", writerID, err)
-					}
-
-					cmd.Logger.WithContext(ctx).Info("writer %d: insert status: %v", writerID, status.ID)
-				}
+			var event domain.StatusEvent
+			if err := json.Unmarshal(m.Value, &event); err != nil {
+				cmd.Logger.WithContext(ctx).Errorf("status reader: failed to unmarshal message: %v, raw: %s", err, string(m.Value))
+				tracker.Done(m)
+				continue
+			}
+			// events written before they carried a timestamp are ordered by publish time
+			if event.Timestamp.IsZero() {
+				event.Timestamp = m.Time
+			}
 
-				cmd.Logger.WithContext(ctx).Debugf("writer %d: flushed %d messages to ClickHouse", writerID, len(batch))
-				batch = batch[:0]
+			if err := statusServiceInstance.Apply(ctx, event); err != nil {
+				cmd.Logger.WithContext(ctx).Warnf("status reader: rejecting %s status of %s: %v", event.Status, event.ID, err)
+				tracker.Done(m)
+				continue
 			}
 
-			for {
-				select {
-				case <-ctx.Done():
-					flushBatch()
-					cmd.Logger.WithContext(ctx).Infof("writer %d: context cancelled, shutting down", writerID)
-					return
-				case status := <-msgChan:
-					batch = append(batch, status)
-					if len(batch) >= 100 {
-						flushBatch()
-					}
-				case <-ticker.C:
-					flushBatch()
-				}
+			select {
+			case msgChan <- fetchedStatus{event: event, message: m}:
+			case <-ctx.Done():
+				return
 			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.StatusLog.Writers; i++ {
+		writerID := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cmd.write(ctx, cfg.StatusLog, writerID, smsRepo, tracker, msgChan)
 		}()
 	}
 
-	cmd.Logger.WithContext(ctx).Info("status consumer started successfully")
+	cmd.Logger.WithContext(ctx).Infof("status consumer started with %d writers", cfg.StatusLog.Writers)
 
 	<-ctx.Done()
 	cmd.Logger.WithContext(ctx).Info("status consumer: shutting down gracefully...")
-	time.Sleep(2 * time.Second)
+	wg.Wait()
+
+	commitCtx, cancel := context.WithTimeout(context.Background(), constant.KafkaWriteTimeout)
+	defer cancel()
+	if err := tracker.Commit(commitCtx); err != nil {
+		cmd.Logger.WithContext(ctx).Errorf("status consumer: final commit error: %v", err)
+	}
+}
+
+type statusWriter interface {
+	InsertSMSStatuses(ctx context.Context, events []domain.StatusEvent) error
+}
+
+// write collects events into batches and flushes them every BatchSize events
+// or FlushInterval. A failed flush is retried until it succeeds, the reader
+// waits meanwhile. The last batch gets a single try on shutdown.
+func (cmd StatusConsumerCommand) write(
+	ctx context.Context,
+	cfg config.StatusLog,
+	writerID int,
+	repo statusWriter,
+	tracker *offset.Tracker,
+	msgChan <-chan fetchedStatus,
+) {
+	batch := make([]fetchedStatus, 0, cfg.BatchSize)
+	events := make([]domain.StatusEvent, 0, cfg.BatchSize)
+	ticker := time.NewTicker(cfg.FlushInterval)
+	defer ticker.Stop()
+
+	insert := func(ctx context.Context) error {
+		events = events[:0]
+		for _, fetched := range batch {
+			events = append(events, fetched.event)
+		}
+
+		insertCtx, cancel := context.WithTimeout(ctx, constant.StatusLogInsertTimeout)
+		defer cancel()
+		return repo.InsertSMSStatuses(insertCtx, events)
+	}
+
+	done := func() {
+		for _, fetched := range batch {
+			tracker.Done(fetched.message)
+		}
+		cmd.Logger.WithContext(ctx).Debugf("writer %d: flushed %d statuses to ClickHouse", writerID, len(batch))
+		batch = batch[:0]
+	}
+
+	flush := func() bool {
+		if len(batch) == 0 {
+			return true
+		}
+
+		backoff := cfg.RetryBackoff
+		for {
+			err := insert(ctx)
+			if err == nil {
+				done()
+				return true
+			}
+			cmd.Logger.WithContext(ctx).Errorf("writer %d: flushing %d statuses failed, retrying in %s: %v", writerID, len(batch), backoff, err)
+
+			select {
+			case <-ctx.Done():
+				return false
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, constant.StatusLogMaxRetryBackoff)
+		}
+	}
+
+	shutdown := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		finalCtx, cancel := context.WithTimeout(context.Background(), constant.StatusLogInsertTimeout)
+		defer cancel()
+		if err := insert(finalCtx); err != nil {
+			cmd.Logger.WithContext(ctx).Errorf("writer %d: final flush of %d statuses failed, they are read again: %v", writerID, len(batch), err)
+			return
+		}
+		done()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			shutdown()
+			cmd.Logger.WithContext(ctx).Infof("writer %d: context cancelled, shutting down", writerID)
+			return
+		case fetched, ok := <-msgChan:
+			if !ok {
+				shutdown()
+				return
+			}
+			batch = append(batch, fetched)
+			if len(batch) >= cfg.BatchSize && !flush() {
+				shutdown()
+				return
+			}
+		case <-ticker.C:
+			if !flush() {
+				shutdown()
+				return
+			}
+		}
+	}
 }
@@ -0,0 +1,200 @@
+package command
+
+import (
+	"arvan/message-gateway/internal/config"
+	"arvan/message-gateway/internal/domain"
+	"arvan/message-gateway/internal/offset"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// fakeStatusWriter fails the first failures inserts, every insert when
+// failures is negative, and records the batches it took.
+type fakeStatusWriter struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	batches  [][]string
+}
+
+func (w *fakeStatusWriter) InsertSMSStatuses(_ context.Context, events []domain.StatusEvent) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.calls++
+	if w.failures < 0 || w.calls <= w.failures {
+		return errors.New("clickhouse is down")
+	}
+
+	ids := make([]string, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	w.batches = append(w.batches, ids)
+	return nil
+}
+
+func (w *fakeStatusWriter) state() (calls int, batches [][]string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.calls, append([][]string(nil), w.batches...)
+}
+
+type fakeCommitter struct {
+	mu        sync.Mutex
+	committed map[int]int64
+}
+
+func (c *fakeCommitter) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, m := range msgs {
+		c.committed[m.Partition] = m.Offset
+	}
+	return nil
+}
+
+func TestStatusConsumerWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.StatusLog
+		events   int
+		failures int
+		// closeChan closes the channel right away, otherwise the context is
+		// cancelled once waitCalls inserts were made
+		closeChan   bool
+		waitCalls   int
+		wantBatches []int
+		// wantCommitted is the committed offset, -1 when nothing is committed
+		wantCommitted int64
+	}{
+		{
+			name:          "flushes full batches and the rest on close",
+			cfg:           config.StatusLog{BatchSize: 2, FlushInterval: time.Hour, RetryBackoff: time.Millisecond},
+			events:        5,
+			closeChan:     true,
+			wantBatches:   []int{2, 2, 1},
+			wantCommitted: 4,
+		},
+		{
+			name:          "flushes a partial batch on the interval",
+			cfg:           config.StatusLog{BatchSize: 10, FlushInterval: 50 * time.Millisecond, RetryBackoff: time.Millisecond},
+			events:        3,
+			waitCalls:     1,
+			wantBatches:   []int{3},
+			wantCommitted: 2,
+		},
+		{
+			name:          "retries a failed flush until it succeeds",
+			cfg:           config.StatusLog{BatchSize: 2, FlushInterval: time.Hour, RetryBackoff: time.Millisecond},
+			events:        2,
+			failures:      3,
+			waitCalls:     4,
+			wantBatches:   []int{2},
+			wantCommitted: 1,
+		},
+		{
+			name:          "failed final flush commits nothing",
+			cfg:           config.StatusLog{BatchSize: 10, FlushInterval: time.Hour, RetryBackoff: time.Millisecond},
+			events:        3,
+			failures:      -1,
+			closeChan:     true,
+			wantCommitted: -1,
+		},
+		{
+			name:          "shutdown while retrying commits nothing",
+			cfg:           config.StatusLog{BatchSize: 1, FlushInterval: time.Hour, RetryBackoff: time.Millisecond},
+			events:        2,
+			failures:      -1,
+			waitCalls:     3,
+			wantCommitted: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New()
+			logger.SetOutput(io.Discard)
+			cmd := StatusConsumerCommand{Logger: logger}
+
+			repo := &fakeStatusWriter{failures: tt.failures}
+			committer := &fakeCommitter{committed: make(map[int]int64)}
+			tracker := offset.NewTracker(committer, logger)
+
+			msgChan := make(chan fetchedStatus, tt.events)
+			for i := 0; i < tt.events; i++ {
+				m := kafka.Message{Topic: "sms.status", Offset: int64(i)}
+				tracker.Track(m)
+				msgChan <- fetchedStatus{event: domain.StatusEvent{ID: strconv.Itoa(i)}, message: m}
+			}
+			if tt.closeChan {
+				close(msgChan)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				cmd.write(ctx, tt.cfg, 0, repo, tracker, msgChan)
+			}()
+
+			if !tt.closeChan {
+				deadline := time.Now().Add(5 * time.Second)
+				for {
+					if calls, _ := repo.state(); calls >= tt.waitCalls {
+						break
+					}
+					if time.Now().After(deadline) {
+						t.Fatalf("waited for %d inserts", tt.waitCalls)
+					}
+					time.Sleep(time.Millisecond)
+				}
+				cancel()
+			}
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("write did not return")
+			}
+
+			_, batches := repo.state()
+			if len(batches) != len(tt.wantBatches) {
+				t.Fatalf("batches = %v, want sizes %v", batches, tt.wantBatches)
+			}
+			next := 0
+			for i, batch := range batches {
+				if len(batch) != tt.wantBatches[i] {
+					t.Fatalf("batches = %v, want sizes %v", batches, tt.wantBatches)
+				}
+				for _, id := range batch {
+					if id != strconv.Itoa(next) {
+						t.Fatalf("batches = %v, want the events in order", batches)
+					}
+					next++
+				}
+			}
+
+			if err := tracker.Commit(context.Background()); err != nil {
+				t.Fatalf("Commit: %v", err)
+			}
+			committed, ok := committer.committed[0]
+			if !ok {
+				committed = -1
+			}
+			if committed != tt.wantCommitted {
+				t.Fatalf("committed offset = %d, want %d", committed, tt.wantCommitted)
+			}
+		})
+	}
+}
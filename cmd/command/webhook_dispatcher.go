@@ -0,0 +1,191 @@
+package command
+
+import (
+	"arvan/message-gateway/internal/config"
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"arvan/message-gateway/internal/infra"
+	"arvan/message-gateway/internal/offset"
+	"arvan/message-gateway/internal/repository"
+	statusService "arvan/message-gateway/internal/service/status"
+	webhookService "arvan/message-gateway/internal/service/webhook"
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type WebhookDispatcherCommand struct {
+	Logger *log.Logger
+}
+
+// fetchedWebhookEvent is a webhook event with the kafka message it was read
+// from, the offset is done once the event is delivered or dead lettered.
+type fetchedWebhookEvent struct {
+	event   domain.WebhookEvent
+	message kafka.Message
+}
+
+func (cmd WebhookDispatcherCommand) Command(ctx context.Context, cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "dispatch-webhooks",
+		Short: "consume SMS status messages from Kafka and deliver them to customer webhooks",
+		Run: func(_ *cobra.Command, _ []string) {
+			cmd.main(cfg, ctx)
+		},
+	}
+}
+
+func (cmd WebhookDispatcherCommand) main(cfg *config.Config, ctx context.Context) {
+	psql, err := infra.NewPostgresClient(ctx, cfg.Database.Postgres)
+	if err != nil {
+		cmd.Logger.WithContext(ctx).Fatal(errors.Wrap(err, "dispatch-webhooks : failed to connect to postgresql"))
+		return
+	}
+
+	// a separate consumer group so every status event reaches both consume-status and the dispatcher
+	kafkaConsumerSmsStatus := infra.NewKafkaConsumer(cfg.Kafka, constant.TopicStatus, constant.KafkaWebhookGroupID)
+	defer func() {
+		if err := kafkaConsumerSmsStatus.Close(); err != nil {
+			cmd.Logger.WithContext(ctx).Errorf("failed to close Kafka consumer: %v", err)
+		}
+	}()
+
+	dispatcher := webhookService.NewWebhookService(repository.NewWebhookRepository(psql.GetDb()), cmd.Logger)
+
+	// the events consume-status rejects are not sent either. The dispatcher
+	// does not read the clickhouse log, which consume-status may have written
+	// ahead of it, so only the history seen since the start is checked
+	statusServiceInstance := statusService.NewStatusService(nil, cmd.Logger)
+	go statusServiceInstance.Run(ctx)
+
+	// offsets are committed only once the events up to them are delivered or
+	// dead lettered, a crash delivers the unfinished events again
+	tracker := offset.NewTracker(kafkaConsumerSmsStatus, cmd.Logger)
+	go tracker.Run(ctx, constant.KafkaCommitInterval)
+
+	// the events of a message share its key and always go to the same worker,
+	// so they are delivered in order
+	workers := make([]chan fetchedWebhookEvent, constant.WebhookDispatchWorkers)
+	for i := range workers {
+		workers[i] = make(chan fetchedWebhookEvent, constant.WebhookDispatchQueueSize)
+	}
+
+	go func() {
+		defer func() {
+			for _, events := range workers {
+				close(events)
+			}
+		}()
+		for {
+			m, err := kafkaConsumerSmsStatus.FetchMessage(ctx)
+			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+				}
+				cmd.Logger.WithContext(ctx).Errorf("webhook consumer: fetch error: %v", err)
+				time.Sleep(500 * time.Millisecond)
+				continue
+			}
+
+			tracker.Track(m)
+
+			var status domain.StatusEvent
+			if err := json.Unmarshal(m.Value, &status); err != nil {
+				cmd.Logger.WithContext(ctx).Errorf("webhook consumer: failed to unmarshal message: %v, raw: %s", err, string(m.Value))
+				tracker.Done(m)
+				continue
+			}
+			if status.Timestamp.IsZero() {
+				status.Timestamp = m.Time
+			}
+
+			if err := statusServiceInstance.Apply(ctx, status); err != nil {
+				cmd.Logger.WithContext(ctx).Warnf("webhook consumer: dropping %s status of %s: %v", status.Status, status.ID, err)
+				tracker.Done(m)
+				continue
+			}
+
+			hash := fnv.New32a()
+			hash.Write(m.Key)
+
+			select {
+			case workers[hash.Sum32()%uint32(len(workers))] <- fetchedWebhookEvent{
+				event: domain.WebhookEvent{
+					MessageId:  status.ID,
+					CustomerId: status.CustomerID,
+					Phone:      status.Phone,
+					Status:     status.Status,
+					Timestamp:  status.Timestamp,
+				},
+				message: m,
+			}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i, events := range workers {
+		workerID := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fetched := range events {
+				if cmd.deliver(ctx, dispatcher, workerID, fetched.event) {
+					tracker.Done(fetched.message)
+				}
+			}
+		}()
+	}
+
+	go dispatcher.Retry(ctx)
+
+	cmd.Logger.WithContext(ctx).Infof("webhook dispatcher started with %d workers", constant.WebhookDispatchWorkers)
+
+	<-ctx.Done()
+	cmd.Logger.WithContext(ctx).Info("webhook dispatcher: shutting down gracefully...")
+	wg.Wait()
+
+	commitCtx, cancel := context.WithTimeout(context.Background(), constant.KafkaWriteTimeout)
+	defer cancel()
+	if err := tracker.Commit(commitCtx); err != nil {
+		cmd.Logger.WithContext(ctx).Errorf("webhook dispatcher: final commit error: %v", err)
+	}
+}
+
+type webhookDeliverer interface {
+	Deliver(ctx context.Context, event domain.WebhookEvent) error
+}
+
+// deliver hands the event to the dispatcher until it is delivered or stored
+// for a retry and reports whether it was. An event that could be neither,
+// e.g. while postgres is down, is tried again after a backoff. It is not done
+// when ctx ends first, so it is read again after the shutdown.
+func (cmd WebhookDispatcherCommand) deliver(ctx context.Context, dispatcher webhookDeliverer, workerID int, event domain.WebhookEvent) bool {
+	for {
+		err := dispatcher.Deliver(ctx, event)
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		cmd.Logger.WithContext(ctx).Errorf("webhook worker %d: delivery of %s failed: %v", workerID, event.MessageId, err)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(constant.WebhookDispatchErrorBackoff):
+		}
+	}
+}
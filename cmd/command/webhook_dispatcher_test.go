@@ -0,0 +1,62 @@
+package command
+
+import (
+	"arvan/message-gateway/internal/domain"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fakeDeliverer fails the first failures deliveries, every delivery when
+// failures is negative.
+type fakeDeliverer struct {
+	failures int
+	calls    int
+}
+
+func (d *fakeDeliverer) Deliver(_ context.Context, _ domain.WebhookEvent) error {
+	d.calls++
+	if d.failures < 0 || d.calls <= d.failures {
+		return errors.New("postgres is down")
+	}
+	return nil
+}
+
+func TestWebhookDispatcherDeliver(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		timeout   time.Duration
+		wantDone  bool
+		wantCalls int
+	}{
+		{name: "delivered", failures: 0, timeout: time.Minute, wantDone: true, wantCalls: 1},
+		{name: "delivered after an error", failures: 1, timeout: time.Minute, wantDone: true, wantCalls: 2},
+		{name: "not done on shutdown", failures: -1, timeout: 100 * time.Millisecond, wantDone: false, wantCalls: 1},
+	}
+
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	cmd := WebhookDispatcherCommand{Logger: logger}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			dispatcher := &fakeDeliverer{failures: tt.failures}
+			done := cmd.deliver(ctx, dispatcher, 0, domain.WebhookEvent{MessageId: "m-1"})
+
+			if done != tt.wantDone {
+				t.Fatalf("done = %v, want %v", done, tt.wantDone)
+			}
+			if dispatcher.calls != tt.wantCalls {
+				t.Fatalf("calls = %d, want %d", dispatcher.calls, tt.wantCalls)
+			}
+		})
+	}
+}
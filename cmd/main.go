@@ -29,7 +29,10 @@ func main() {
 		command.Server{Logger: logger}.Command(ctx, cfg),
 		command.ConsumerCommand{Logger: logger}.Command(ctx, cfg),
 		command.StatusConsumerCommand{Logger: logger}.Command(ctx, cfg),
+		command.WebhookDispatcherCommand{Logger: logger}.Command(ctx, cfg),
+		command.DlqCommand{Logger: logger}.Command(ctx, cfg),
 		command.MigrateCommand{Logger: logger}.Command(ctx, cfg),
+		command.ExportCommand{Logger: logger}.Command(ctx, cfg),
 	)
 
 	if err := root.Execute(); err != nil {
@@ -0,0 +1,43 @@
+package apikey
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// ApiKeyHandler serves the same endpoints to customers under /v1/api-keys and
+// to admins under /admin/v1/customers/{customer_id}/api-keys, the customer is
+// set by the middleware of the route either way.
+type ApiKeyHandler struct {
+	apiKeyService apiKeyService
+}
+
+type apiKeyService interface {
+	PlanId(ctx context.Context, name string) (int64, error)
+	List(ctx context.Context, customerId int) ([]domain.ApiKey, error)
+	Create(ctx context.Context, customerId int, planId int64, label string) (domain.IssuedApiKey, error)
+	Label(ctx context.Context, customerId int, keyId, label string) (domain.ApiKey, error)
+	Rotate(ctx context.Context, customerId int, keyId string) (domain.IssuedApiKey, error)
+	Revoke(ctx context.Context, customerId int, keyId string) (domain.ApiKey, error)
+}
+
+func New(apiKeyService apiKeyService) *ApiKeyHandler {
+	return &ApiKeyHandler{
+		apiKeyService: apiKeyService,
+	}
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, constant.ApiKeyNotFoundErr):
+		return http.StatusNotFound
+	case errors.Is(err, constant.InvalidApiKeyLabelErr), errors.Is(err, constant.PlanNotFoundErr):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,63 @@
+package apikey
+
+import (
+	"arvan/message-gateway/internal/api/request"
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Create godoc
+// @Summary      Create API key
+// @Description  Issue a new API key. The key is only returned in this response, only a salted hash of it is stored. Customers get a key on the plan of the key they call with, admins choose the plan by name.
+// @Tags         API Keys
+// @Accept       json
+// @Produce      json
+// @Param        customer_id path int false "Customer ID, admin route only"
+// @Param        request body request.CreateApiKeyRequest true "Label and, for admins, the plan"
+// @Success      201 {object} map[string]interface{} "API key with its secret in data.key"
+// @Failure      400 {object} map[string]string "Invalid request body, label or plan"
+// @Failure      403 {object} map[string]string "Plan chosen by a customer"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /v1/api-keys [post]
+// @Router       /admin/v1/customers/{customer_id}/api-keys [post]
+// @Security     ApiKeyAuth
+// @Security     AdminTokenAuth
+func (h *ApiKeyHandler) Create(c *gin.Context) {
+	var req request.CreateApiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var planId int64
+	if current, ok := c.Get(constant.ApiKeyKey); ok {
+		if req.Plan != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only an admin can choose the plan of a key"})
+			return
+		}
+		planId = current.(domain.ApiKey).PlanID
+	} else {
+		if req.Plan == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "plan is required"})
+			return
+		}
+		var err error
+		planId, err = h.apiKeyService.PlanId(c, req.Plan)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userId := c.MustGet(constant.UserIdKey).(int)
+	key, err := h.apiKeyService.Create(c, userId, planId, req.Label)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "created", "data": key})
+}
@@ -0,0 +1,43 @@
+package apikey
+
+import (
+	"arvan/message-gateway/internal/api/request"
+	"arvan/message-gateway/internal/constant"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Label godoc
+// @Summary      Label API key
+// @Description  Change the label of an API key of the customer
+// @Tags         API Keys
+// @Accept       json
+// @Produce      json
+// @Param        customer_id path int false "Customer ID, admin route only"
+// @Param        key_id path string true "API key ID"
+// @Param        request body request.LabelApiKeyRequest true "New label"
+// @Success      200 {object} map[string]interface{} "Labelled API key"
+// @Failure      400 {object} map[string]string "Invalid request body or label"
+// @Failure      404 {object} map[string]string "API key not found"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /v1/api-keys/{key_id} [patch]
+// @Router       /admin/v1/customers/{customer_id}/api-keys/{key_id} [patch]
+// @Security     ApiKeyAuth
+// @Security     AdminTokenAuth
+func (h *ApiKeyHandler) Label(c *gin.Context) {
+	var req request.LabelApiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userId := c.MustGet(constant.UserIdKey).(int)
+	key, err := h.apiKeyService.Label(c, userId, c.Param("key_id"), req.Label)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": key})
+}
@@ -0,0 +1,31 @@
+package apikey
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// List godoc
+// @Summary      List API keys
+// @Description  List the API keys of the customer newest first, revoked keys included. Secrets are never returned.
+// @Tags         API Keys
+// @Produce      json
+// @Param        customer_id path int false "Customer ID, admin route only"
+// @Success      200 {object} map[string]interface{} "API keys"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /v1/api-keys [get]
+// @Router       /admin/v1/customers/{customer_id}/api-keys [get]
+// @Security     ApiKeyAuth
+// @Security     AdminTokenAuth
+func (h *ApiKeyHandler) List(c *gin.Context) {
+	userId := c.MustGet(constant.UserIdKey).(int)
+	keys, err := h.apiKeyService.List(c, userId)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": keys})
+}
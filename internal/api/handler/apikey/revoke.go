@@ -0,0 +1,33 @@
+package apikey
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Revoke godoc
+// @Summary      Revoke API key
+// @Description  Revoke an API key of the customer, it stops working on every server within seconds. Revoking a revoked key succeeds.
+// @Tags         API Keys
+// @Produce      json
+// @Param        customer_id path int false "Customer ID, admin route only"
+// @Param        key_id path string true "API key ID"
+// @Success      200 {object} map[string]interface{} "Revoked API key"
+// @Failure      404 {object} map[string]string "API key not found"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /v1/api-keys/{key_id} [delete]
+// @Router       /admin/v1/customers/{customer_id}/api-keys/{key_id} [delete]
+// @Security     ApiKeyAuth
+// @Security     AdminTokenAuth
+func (h *ApiKeyHandler) Revoke(c *gin.Context) {
+	userId := c.MustGet(constant.UserIdKey).(int)
+	key, err := h.apiKeyService.Revoke(c, userId, c.Param("key_id"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "revoked", "data": key})
+}
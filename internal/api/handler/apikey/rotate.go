@@ -0,0 +1,33 @@
+package apikey
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rotate godoc
+// @Summary      Rotate API key
+// @Description  Revoke an active API key and issue a new one with the same plan and label. The new key is only returned in this response, the old one stops working on every server within seconds.
+// @Tags         API Keys
+// @Produce      json
+// @Param        customer_id path int false "Customer ID, admin route only"
+// @Param        key_id path string true "API key ID"
+// @Success      201 {object} map[string]interface{} "New API key with its secret in data.key"
+// @Failure      404 {object} map[string]string "API key not found or revoked"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /v1/api-keys/{key_id}/rotate [post]
+// @Router       /admin/v1/customers/{customer_id}/api-keys/{key_id}/rotate [post]
+// @Security     ApiKeyAuth
+// @Security     AdminTokenAuth
+func (h *ApiKeyHandler) Rotate(c *gin.Context) {
+	userId := c.MustGet(constant.UserIdKey).(int)
+	key, err := h.apiKeyService.Rotate(c, userId, c.Param("key_id"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "rotated", "data": key})
+}
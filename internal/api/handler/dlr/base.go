@@ -0,0 +1,21 @@
+package dlr
+
+import (
+	"context"
+)
+
+const TokenHeader = "X-DLR-Token"
+
+type DlrHandler struct {
+	dlrService dlrService
+}
+
+type dlrService interface {
+	Receive(ctx context.Context, providerName, token string, fields map[string]interface{}) error
+}
+
+func New(dlrService dlrService) *DlrHandler {
+	return &DlrHandler{
+		dlrService: dlrService,
+	}
+}
@@ -0,0 +1,83 @@
+package dlr
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"encoding/json"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Receive godoc
+// @Summary      Receive delivery receipt
+// @Description  Delivery receipt of a provider, given as a json body, a form or query parameters. The provider message id is mapped back to the message and delivered, undelivered or expired is published to its timeline. Every receipt must carry the PROVIDER_DLR_TOKEN of the provider, receipts of providers without one are refused.
+// @Tags         DLR
+// @Accept       json
+// @Produce      json
+// @Param        provider path string true "Configured provider name"
+// @Success      200 {object} map[string]string "Receipt accepted"
+// @Failure      400 {object} map[string]string "Invalid receipt"
+// @Failure      401 {object} map[string]string "Invalid token"
+// @Failure      403 {object} map[string]string "No dlr token configured for the provider"
+// @Failure      404 {object} map[string]string "Unknown provider or message"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /v1/dlr/{provider} [post]
+// @Router       /v1/dlr/{provider} [get]
+func (h *DlrHandler) Receive(c *gin.Context) {
+	fields, err := receiptFields(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token := c.GetHeader(TokenHeader)
+	if token == "" {
+		token = c.Query("token")
+	}
+
+	err = h.dlrService.Receive(c, c.Param("provider"), token, fields)
+	if err != nil {
+		switch {
+		case errors.Is(err, constant.InvalidDlrErr):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, constant.InvalidDlrTokenErr):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, constant.DlrDisabledErr):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, constant.UnknownProviderErr), errors.Is(err, constant.ProviderMessageNotFoundErr):
+			// providers retry receipts that are not acknowledged, which covers
+			// receipts that were faster than recording the send
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
+
+// receiptFields decodes a json body, any other request is read from its form
+// and query values.
+func receiptFields(r *http.Request) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+			return nil, errors.Wrap(err, "invalid json body")
+		}
+		return fields, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, errors.Wrap(err, "invalid form")
+	}
+	for key := range r.Form {
+		fields[key] = r.Form.Get(key)
+	}
+
+	return fields, nil
+}
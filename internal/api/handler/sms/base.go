@@ -4,20 +4,30 @@ import (
 	"arvan/message-gateway/internal/api/request"
 	"arvan/message-gateway/internal/domain"
 	"context"
+	"io"
+	"time"
 )
 
 type SmsHandler struct {
-	smsService smsService
+	smsService    smsService
+	exportService exportService
 }
 
 type smsService interface {
-	Send(ctx context.Context, priority, customerId int, req request.SendSmsRequest) error
-	GetAllSmsLog(ctx context.Context, customerId, limit, offset int) ([]domain.SMSStatus, int64, error)
-	ViewSmsTimeLine(ctx context.Context, messageId string) ([]domain.SMSStatus, error)
+	Send(ctx context.Context, priority, customerId int, req request.SendSmsRequest) (domain.SmsReceipt, error)
+	SendBulk(ctx context.Context, priority, customerId int, reqs []request.SendSmsRequest) (domain.BulkSmsReceipt, error)
+	CancelScheduled(ctx context.Context, customerId int, messageId string) (domain.CancelReceipt, error)
+	GetAllSmsLog(ctx context.Context, customerId int, filter domain.SmsLogFilter) ([]domain.SMSStatus, *domain.SmsLogCursor, error)
+	ViewSmsTimeLine(ctx context.Context, customerId int, messageId string) ([]domain.SMSStatus, error)
 }
 
-func New(smsService smsService) *SmsHandler {
+type exportService interface {
+	Export(ctx context.Context, customerId int, format domain.ExportFormat, from, to time.Time, w io.Writer) (int, error)
+}
+
+func New(smsService smsService, exportService exportService) *SmsHandler {
 	return &SmsHandler{
-		smsService: smsService,
+		smsService:    smsService,
+		exportService: exportService,
 	}
 }
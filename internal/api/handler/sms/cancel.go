@@ -0,0 +1,38 @@
+package sms
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Cancel godoc
+// @Summary      Cancel scheduled SMS
+// @Description  Cancel an SMS that is still waiting for its send_at and refund its cost
+// @Tags         SMS
+// @Accept       json
+// @Produce      json
+// @Param        id path string true "SMS Message ID"
+// @Success      200 {object} map[string]interface{} "SMS cancelled and refunded"
+// @Failure      404 {object} map[string]string "Scheduled SMS not found"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /v1/sms/{id} [delete]
+// @Security     ApiKeyAuth
+func (h *SmsHandler) Cancel(c *gin.Context) {
+	smsId := c.Param("id")
+
+	userId := c.MustGet(constant.UserIdKey).(int)
+	receipt, err := h.smsService.CancelScheduled(c, userId, smsId)
+	if err != nil {
+		if errors.Is(err, constant.ScheduledSmsNotFoundErr) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "cancelled", "data": receipt})
+}
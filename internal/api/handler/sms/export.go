@@ -0,0 +1,79 @@
+package sms
+
+import (
+	"arvan/message-gateway/internal/api/request"
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportSmsLog godoc
+// @Summary      Export SMS logs
+// @Description  Stream every SMS of the authenticated user accepted between from and to with its current status, oldest first, as CSV or newline delimited JSON. Rows are sent in chunks while they are read; an export that fails midway is cut off without the final chunk.
+// @Tags         SMS
+// @Produce      text/csv
+// @Produce      application/x-ndjson
+// @Param        format query string false "Export format" Enums(csv, ndjson) default(csv)
+// @Param        from query string true "Accepted at or after, RFC3339"
+// @Param        to query string true "Accepted before, RFC3339"
+// @Success      200 {string} string "Exported SMS logs"
+// @Failure      400 {object} map[string]interface{} "Invalid format or time range"
+// @Failure      500 {object} map[string]interface{} "Internal server error"
+// @Router       /v1/sms/log/export [get]
+// @Security     ApiKeyAuth
+func (h *SmsHandler) ExportSmsLog(c *gin.Context) {
+	userId := c.MustGet(constant.UserIdKey).(int)
+
+	var query request.SmsLogExportQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	format := domain.ExportFormatCSV
+	if query.Format != "" {
+		format = domain.ExportFormat(query.Format)
+	}
+	if !format.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": constant.InvalidExportFormatErr.Error(),
+		})
+		return
+	}
+
+	if query.From.IsZero() || query.To.IsZero() || !query.From.Before(query.To) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "from and to are required and from must be before to",
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("sms-log-%s-%s.%s", query.From.UTC().Format("20060102T150405Z"), query.To.UTC().Format("20060102T150405Z"), format)
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	if _, err := h.exportService.Export(c, userId, format, query.From, query.To, c.Writer); err != nil {
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    http.StatusInternalServerError,
+				"message": err.Error(),
+			})
+			return
+		}
+		// the status is sent already, dropping the connection keeps the
+		// client from taking a partial export for a complete one
+		_ = c.Error(err)
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -1,23 +1,34 @@
 package sms
 
 import (
+	"arvan/message-gateway/internal/api/request"
 	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
 	"arvan/message-gateway/pkg/paginator"
 	"net/http"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 )
 
 // GetAllSmsLog godoc
 // @Summary      Get all SMS logs
-// @Description  Retrieve all SMS logs for the authenticated user with pagination
+// @Description  Retrieve every SMS of the authenticated user once with its current status, newest first. Filters combine, the next page is read by passing meta.next_cursor back as cursor.
 // @Tags         SMS
 // @Accept       json
 // @Produce      json
-// @Param        page query int false "Page number" default(1)
-// @Param        page_size query int false "Number of items per page" default(10)
-// @Success      200 {object} map[string]interface{} "List of SMS logs with pagination metadata"
-// @Failure      400 {object} map[string]interface{} "Invalid user ID"
+// @Param        status query string false "Comma separated statuses, e.g. delivered,failed"
+// @Param        phone query string false "Exact recipient phone number"
+// @Param        from query string false "Accepted at or after, RFC3339"
+// @Param        to query string false "Accepted before, RFC3339"
+// @Param        priority query int false "Priority of the messages" Enums(1, 2, 3)
+// @Param        q query string false "Text contained in the message, case insensitive"
+// @Param        cursor query string false "next_cursor of the previous page"
+// @Param        page_size query int false "Number of items per page, at most 100" default(20)
+// @Success      200 {object} map[string]interface{} "List of SMS logs with the cursor of the next page in meta"
+// @Failure      400 {object} map[string]interface{} "Invalid filter or cursor"
 // @Failure      500 {object} map[string]interface{} "Internal server error"
 // @Router       /v1/sms/log [get]
 // @Security     ApiKeyAuth
@@ -33,9 +44,25 @@ func (h *SmsHandler) GetAllSmsLog(c *gin.Context) {
 		return
 	}
 
-	pagination := paginator.New(c)
+	var query request.SmsLogQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": errors.Wrap(constant.InvalidSmsLogFilterErr, err.Error()).Error(),
+		})
+		return
+	}
+
+	filter, err := smsLogFilter(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
 
-	all, count, err := h.smsService.GetAllSmsLog(c, iUserId, pagination.Size, pagination.From)
+	all, next, err := h.smsService.GetAllSmsLog(c, iUserId, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
@@ -44,13 +71,78 @@ func (h *SmsHandler) GetAllSmsLog(c *gin.Context) {
 		return
 	}
 
+	nextCursor := ""
+	if next != nil {
+		nextCursor, err = paginator.EncodeCursor(next)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    http.StatusInternalServerError,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "success",
 		"data":    all,
 		"meta": gin.H{
-			"page_size": pagination.Size,
-			"page":      pagination.Page,
-			"total":     count,
+			"page_size":   filter.Limit,
+			"next_cursor": nextCursor,
 		},
 	})
 }
+
+// smsLogFilter validates the query of the message list and turns it into a
+// filter, an empty next_cursor in the response means there are no more pages.
+func smsLogFilter(query request.SmsLogQuery) (domain.SmsLogFilter, error) {
+	filter := domain.SmsLogFilter{
+		Phone:    strings.TrimSpace(query.Phone),
+		From:     query.From,
+		To:       query.To,
+		Priority: query.Priority,
+		Text:     strings.TrimSpace(query.Query),
+		Limit:    query.PageSize,
+	}
+
+	if query.Status != "" {
+		for _, name := range strings.Split(query.Status, ",") {
+			status := domain.ParseStatus(strings.TrimSpace(name))
+			if !status.Valid() {
+				return filter, errors.Wrapf(constant.InvalidSmsLogFilterErr, "unknown status %q", name)
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	switch filter.Priority {
+	case 0, constant.PriorityFree, constant.PriorityPro, constant.PriorityEnterprise:
+	default:
+		return filter, errors.Wrapf(constant.InvalidSmsLogFilterErr, "unknown priority %d", filter.Priority)
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, errors.Wrap(constant.InvalidSmsLogFilterErr, "from must be before to")
+	}
+
+	if utf8.RuneCountInString(filter.Text) > constant.MaxSearchLength {
+		return filter, errors.Wrapf(constant.InvalidSmsLogFilterErr, "q is longer than %d characters", constant.MaxSearchLength)
+	}
+
+	switch {
+	case filter.Limit == 0:
+		filter.Limit = constant.DefaultPageSize
+	case filter.Limit < 0 || filter.Limit > constant.MaxPageSize:
+		return filter, errors.Wrapf(constant.InvalidSmsLogFilterErr, "page_size must be between 1 and %d", constant.MaxPageSize)
+	}
+
+	if query.Cursor != "" {
+		var after domain.SmsLogCursor
+		if err := paginator.DecodeCursor(query.Cursor, &after); err != nil || after.ID == "" {
+			return filter, errors.Wrap(constant.InvalidSmsLogFilterErr, paginator.ErrInvalidCursor.Error())
+		}
+		filter.After = &after
+	}
+
+	return filter, nil
+}
@@ -17,8 +17,10 @@ import (
 // @Accept       json
 // @Produce      json
 // @Param        request body request.SendSmsRequest true "SMS request body"
-// @Success      200 {object} map[string]string "SMS queued successfully"
+// @Param        Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Success      200 {object} map[string]interface{} "SMS queued, receipt with message id, cost and balance in data"
 // @Failure      400 {object} map[string]string "Invalid request body"
+// @Failure      409 {object} map[string]string "Idempotency key reused with a different body or still in progress"
 // @Failure      402 {object} map[string]string "Insufficient balance"
 // @Failure      500 {object} map[string]string "Internal server error"
 // @Router       /v1/sms/send [post]
@@ -32,15 +34,23 @@ func (h *SmsHandler) Send(c *gin.Context) {
 
 	userId := c.MustGet(constant.UserIdKey).(int)
 	priority := c.MustGet(constant.PriorityKey).(int)
-	err := h.smsService.Send(c, priority, userId, req)
+	receipt, err := h.smsService.Send(c, priority, userId, req)
+	if receipt.MessageId != "" {
+		// a retry must not charge again, even when the request failed after the charge
+		c.Set(constant.ChargedKey, true)
+	}
 	if err != nil {
 		if errors.Is(err, constant.InsufficientBalanceErr) {
 			c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
 			return
 		}
+		if errors.Is(err, constant.InvalidSendAtErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "queued"})
+	c.JSON(http.StatusOK, gin.H{"message": "queued", "data": receipt})
 }
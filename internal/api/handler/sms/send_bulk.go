@@ -0,0 +1,61 @@
+package sms
+
+import (
+	"arvan/message-gateway/internal/api/request"
+	"arvan/message-gateway/internal/constant"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// SendBulk godoc
+// @Summary      Send SMS in bulk
+// @Description  Send many SMS messages in one request, either as explicit items or one message to many phone numbers
+// @Tags         SMS
+// @Accept       json
+// @Produce      json
+// @Param        request body request.SendBulkSmsRequest true "Bulk SMS request body"
+// @Param        Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Success      200 {object} map[string]interface{} "Per-item results with message ids and rejections"
+// @Failure      400 {object} map[string]string "Invalid request body"
+// @Failure      409 {object} map[string]string "Idempotency key reused with a different body or still in progress"
+// @Failure      402 {object} map[string]interface{} "Balance does not cover every valid item, nothing was charged"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /v1/sms/send/bulk [post]
+// @Security     ApiKeyAuth
+func (h *SmsHandler) SendBulk(c *gin.Context) {
+	var req request.SendBulkSmsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	items := req.ToItems()
+	if len(items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recipients given"})
+		return
+	}
+	if len(items) > constant.MaxBulkSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d recipients are allowed", constant.MaxBulkSize)})
+		return
+	}
+
+	userId := c.MustGet(constant.UserIdKey).(int)
+	priority := c.MustGet(constant.PriorityKey).(int)
+	receipt, err := h.smsService.SendBulk(c, priority, userId, items)
+	if receipt.Cost > 0 {
+		c.Set(constant.ChargedKey, true)
+	}
+	if err != nil {
+		if errors.Is(err, constant.InsufficientBalanceErr) {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error(), "data": receipt})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "queued", "data": receipt})
+}
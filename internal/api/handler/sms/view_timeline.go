@@ -1,20 +1,22 @@
 package sms
 
 import (
+	"arvan/message-gateway/internal/constant"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 )
 
 // ViewSmsTimeLine godoc
 // @Summary      View SMS timeline
-// @Description  Get the timeline/status history of a specific SMS message
+// @Description  Get the timeline/status history of a specific SMS message of the authenticated user
 // @Tags         SMS
 // @Accept       json
 // @Produce      json
 // @Param        id path string true "SMS Message ID"
 // @Success      200 {object} map[string]interface{} "SMS timeline data"
-// @Failure      404 {object} map[string]string "SMS not found"
+// @Failure      404 {object} map[string]string "SMS not found or sent by another user"
 // @Failure      500 {object} map[string]string "Internal server error"
 // @Router       /v1/sms/{id} [get]
 // @Security     ApiKeyAuth
@@ -23,13 +25,22 @@ func (h *SmsHandler) ViewSmsTimeLine(c *gin.Context) {
 
 	if smsId == "" {
 		c.JSON(http.StatusNotFound, gin.H{
-			"message": "sms not found",
+			"message": constant.SmsNotFoundErrMsg,
 		})
 		return
 	}
 
-	timelineData, err := h.smsService.ViewSmsTimeLine(c, smsId)
+	userId := c.MustGet(constant.UserIdKey).(int)
+	timelineData, err := h.smsService.ViewSmsTimeLine(c, userId, smsId)
 	if err != nil {
+		// a message of another user is reported like a missing one so ids
+		// cannot be probed
+		if errors.Is(err, constant.SmsNotFoundErr) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": err.Error(),
 		})
@@ -0,0 +1,22 @@
+package webhook
+
+import (
+	"arvan/message-gateway/internal/domain"
+	"context"
+)
+
+type WebhookHandler struct {
+	webhookService webhookService
+}
+
+type webhookService interface {
+	Register(ctx context.Context, customerId int, callbackUrl string) (domain.Webhook, error)
+	GetWebhook(ctx context.Context, customerId int) (domain.Webhook, error)
+	DeleteWebhook(ctx context.Context, customerId int) error
+}
+
+func New(webhookService webhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
@@ -0,0 +1,34 @@
+package webhook
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Delete godoc
+// @Summary      Delete webhook
+// @Description  Stop sending status transitions to the customer's callback url
+// @Tags         Webhook
+// @Accept       json
+// @Produce      json
+// @Success      200 {object} map[string]string "Webhook deleted"
+// @Failure      404 {object} map[string]string "Webhook not found"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /v1/webhook [delete]
+// @Security     ApiKeyAuth
+func (h *WebhookHandler) Delete(c *gin.Context) {
+	userId := c.MustGet(constant.UserIdKey).(int)
+	if err := h.webhookService.DeleteWebhook(c, userId); err != nil {
+		if errors.Is(err, constant.WebhookNotFoundErr) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
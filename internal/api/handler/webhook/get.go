@@ -0,0 +1,35 @@
+package webhook
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Get godoc
+// @Summary      Get webhook
+// @Description  Get the registered callback url of the authenticated customer
+// @Tags         Webhook
+// @Accept       json
+// @Produce      json
+// @Success      200 {object} map[string]interface{} "Registered webhook"
+// @Failure      404 {object} map[string]string "Webhook not found"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /v1/webhook [get]
+// @Security     ApiKeyAuth
+func (h *WebhookHandler) Get(c *gin.Context) {
+	userId := c.MustGet(constant.UserIdKey).(int)
+	webhook, err := h.webhookService.GetWebhook(c, userId)
+	if err != nil {
+		if errors.Is(err, constant.WebhookNotFoundErr) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": webhook})
+}
@@ -0,0 +1,43 @@
+package webhook
+
+import (
+	"arvan/message-gateway/internal/api/request"
+	"arvan/message-gateway/internal/constant"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Register godoc
+// @Summary      Register webhook
+// @Description  Set the callback url that receives delivery status transitions. A new signing secret is returned once.
+// @Tags         Webhook
+// @Accept       json
+// @Produce      json
+// @Param        request body request.RegisterWebhookRequest true "Webhook request body"
+// @Success      200 {object} map[string]interface{} "Webhook with its signing secret"
+// @Failure      400 {object} map[string]string "Invalid request body, or a url resolving to a loopback, link-local or private address"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /v1/webhook [put]
+// @Security     ApiKeyAuth
+func (h *WebhookHandler) Register(c *gin.Context) {
+	var req request.RegisterWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userId := c.MustGet(constant.UserIdKey).(int)
+	webhook, err := h.webhookService.Register(c, userId, req.Url)
+	if err != nil {
+		if errors.Is(err, constant.InvalidWebhookUrlErr) || errors.Is(err, constant.WebhookHostNotAllowedErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": webhook})
+}
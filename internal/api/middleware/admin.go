@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const AdminTokenHeader = "X-Admin-Token"
+
+// AdminMiddleware lets operators act on behalf of the customer in the
+// :customer_id path parameter. Without a token the admin api is disabled.
+type AdminMiddleware struct {
+	token string
+}
+
+func NewAdminMiddleware(token string) *AdminMiddleware {
+	return &AdminMiddleware{
+		token: token,
+	}
+}
+
+func (m *AdminMiddleware) Handle(c *gin.Context) {
+	if m.token == "" {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "admin api is disabled"})
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(m.token), []byte(c.GetHeader(AdminTokenHeader))) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+		return
+	}
+
+	customerId, err := strconv.Atoi(c.Param("customer_id"))
+	if err != nil || customerId <= 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid customer id"})
+		return
+	}
+
+	c.Set(constant.UserIdKey, customerId)
+	c.Next()
+}
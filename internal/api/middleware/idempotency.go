@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const IdempotencyHeader = "Idempotency-Key"
+
+// IdempotencyMiddleware makes the send endpoints safe to retry. The first request
+// with a given Idempotency-Key reserves the key in redis, and its successful
+// response is stored under the key so that retries get the same response
+// without charging or queueing the message again. A failed response is stored
+// as well when the handler had already charged the customer, otherwise the key
+// is released so the request may be retried. A reservation expires after
+// inProgressTTL so a request that never finished does not hold its key for
+// the whole ttl.
+type IdempotencyMiddleware struct {
+	redisClient   *redis.Client
+	ttl           time.Duration
+	inProgressTTL time.Duration
+}
+
+type idempotencyRecord struct {
+	BodyHash string          `json:"body_hash"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func NewIdempotencyMiddleware(redisClient *redis.Client, ttl, inProgressTTL time.Duration) *IdempotencyMiddleware {
+	return &IdempotencyMiddleware{
+		redisClient:   redisClient,
+		ttl:           ttl,
+		inProgressTTL: inProgressTTL,
+	}
+}
+
+func (m *IdempotencyMiddleware) Handle(c *gin.Context) {
+	key := c.GetHeader(IdempotencyHeader)
+	if key == "" {
+		c.Next()
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	sum := sha256.Sum256(body)
+	bodyHash := hex.EncodeToString(sum[:])
+
+	// keys are scoped per customer so two customers may use the same key
+	redisKey := fmt.Sprintf("%s%d:%s", constant.IdempotencyKeyPrefix, c.GetInt(constant.UserIdKey), key)
+
+	// status 0 marks a request that is still being processed
+	reserved, err := json.Marshal(idempotencyRecord{BodyHash: bodyHash})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ok, err := m.redisClient.SetNX(c, redisKey, reserved, m.inProgressTTL).Result()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check idempotency key"})
+		return
+	}
+
+	if !ok {
+		m.replay(c, redisKey, bodyHash)
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	c.Next()
+
+	// the outcome is recorded even when the client went away meanwhile
+	ctx := context.WithoutCancel(c.Request.Context())
+
+	status := recorder.Status()
+	if (status < http.StatusOK || status >= http.StatusMultipleChoices) && !c.GetBool(constant.ChargedKey) {
+		// nothing was charged, the request may be retried with the same key
+		m.redisClient.Del(ctx, redisKey)
+		return
+	}
+
+	record, err := json.Marshal(idempotencyRecord{
+		BodyHash: bodyHash,
+		Status:   status,
+		Response: recorder.body.Bytes(),
+	})
+	if err != nil {
+		m.redisClient.Del(ctx, redisKey)
+		return
+	}
+
+	m.redisClient.Set(ctx, redisKey, record, m.ttl)
+}
+
+func (m *IdempotencyMiddleware) replay(c *gin.Context, redisKey, bodyHash string) {
+	raw, err := m.redisClient.Get(c, redisKey).Bytes()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to load idempotency key"})
+		return
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to load idempotency key"})
+		return
+	}
+
+	if record.BodyHash != bodyHash {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "idempotency key was already used with a different request body"})
+		return
+	}
+
+	if record.Status == 0 {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this idempotency key is still in progress"})
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(record.Status, "application/json; charset=utf-8", record.Response)
+	c.Abort()
+}
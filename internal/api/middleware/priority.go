@@ -1,53 +1,84 @@
 package middleware
 
 import (
+	"arvan/message-gateway/internal/config"
 	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
 	"context"
-	"crypto/sha256"
-	"encoding/json"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
 )
 
+// PriorityMiddleware authenticates a request by its api key and sets the
+// customer and the priority of the key's plan. Keys are cached by their id
+// once used, revoked and rotated keys are dropped from the cache of every
+// replica through a redis channel, and every key is read again after
+// ApiKeyCacheTTL in case an invalidation was lost. Ids that are not found are
+// cached briefly so unknown keys do not all reach the database. With legacy plan keys enabled the api key
+// of a plan is accepted as well, for the customer the gateway authenticated.
 type PriorityMiddleware struct {
-	redisClient  *redis.Client
-	data         map[string]int
-	dataChecksum string
-	planService  planService
-	lastBucket   int64
-	mu           sync.RWMutex
-	stopCh       chan struct{}
+	redisClient    *redis.Client
+	data           map[string]cachedApiKey
+	notFound       map[string]time.Time
+	legacyPlans    map[string]domain.Plan
+	apiKeyService  apiKeyService
+	mode           config.AuthMode
+	legacyPlanKeys bool
+	logger         *logrus.Logger
+	// generation changes with every invalidation, a key read from the
+	// database before one is not cached
+	generation uint64
+	mu         sync.RWMutex
+	cancel     context.CancelFunc
 }
 
-type planService interface {
-	GetAllPlansAndSetInRedis(ctx context.Context) (map[string]int, error)
+// cachedApiKey is a key in the cache until expiresAt
+type cachedApiKey struct {
+	key       domain.ApiKey
+	expiresAt time.Time
+}
+
+type apiKeyService interface {
+	GetApiKey(ctx context.Context, keyId string) (domain.ApiKey, error)
+	LegacyPlan(ctx context.Context, apiKey string) (domain.Plan, error)
 }
 
 func NewPriorityMiddleware(
 	redisClient *redis.Client,
-	planService planService,
-	data map[string]int,
-	dataChecksum string,
+	apiKeyService apiKeyService,
+	auth config.Auth,
+	logger *logrus.Logger,
 ) *PriorityMiddleware {
+	ctx, cancel := context.WithCancel(context.Background())
 	pm := &PriorityMiddleware{
-		redisClient:  redisClient,
-		data:         data,
-		dataChecksum: dataChecksum,
-		planService:  planService,
-		stopCh:       make(chan struct{}),
+		redisClient:    redisClient,
+		data:           make(map[string]cachedApiKey),
+		notFound:       make(map[string]time.Time),
+		legacyPlans:    make(map[string]domain.Plan),
+		apiKeyService:  apiKeyService,
+		mode:           auth.Mode,
+		legacyPlanKeys: auth.LegacyPlanKeys,
+		logger:         logger,
+		cancel:         cancel,
+	}
+	if pm.legacyPlanKeys {
+		logger.Warn("api keys of plans are accepted, turn AUTH_LEGACY_PLAN_KEYS off once customers use their own keys")
 	}
 
-	go pm.backgroundRefresh()
+	go pm.listen(ctx)
 
 	return pm
 }
 
 func (m *PriorityMiddleware) Stop() {
-	close(m.stopCh)
+	m.cancel()
 }
 
 func (m *PriorityMiddleware) Handle(c *gin.Context) {
@@ -57,76 +88,180 @@ func (m *PriorityMiddleware) Handle(c *gin.Context) {
 		return
 	}
 
-	// Fast read-only access to cached data (no blocking operations)
-	m.mu.RLock()
-	priority, exists := m.data[apiKey]
-	m.mu.RUnlock()
-
-	if !exists {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "api key not found"})
+	keyId, secret := domain.ParseApiKey(apiKey)
+	key, err := m.lookup(c, keyId)
+	if err == nil && !key.Matches(secret) {
+		err = constant.ApiKeyNotFoundErr
+	}
+	legacy := false
+	if errors.Is(err, constant.ApiKeyNotFoundErr) && m.legacyPlanKeys {
+		key, err = m.legacyKey(c, apiKey)
+		legacy = err == nil
+	}
+	if err != nil {
+		if errors.Is(err, constant.ApiKeyNotFoundErr) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Set(constant.PriorityKey, priority)
+	if m.mode == config.AuthGateway {
+		// the api gateway authenticated the user, the key must be theirs
+		userId, err := strconv.Atoi(c.GetHeader("X-Auth-User-Id"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"code": http.StatusUnauthorized,
+				"msg":  "user is not authorized",
+			})
+			return
+		}
+		// a plan key belongs to no customer, it is used by whoever the
+		// gateway authenticated
+		if legacy {
+			key.CustomerID = userId
+		}
+		if userId != key.CustomerID {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "api key does not belong to the user"})
+			return
+		}
+	}
+
+	c.Set(constant.UserIdKey, key.CustomerID)
+	c.Set(constant.PriorityKey, key.Priority)
+	c.Set(constant.ApiKeyKey, key)
 	c.Next()
 }
 
-func (m *PriorityMiddleware) backgroundRefresh() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
+// lookup reads the key from the cache, a key that is not cached yet or whose
+// entry expired is read from the database.
+func (m *PriorityMiddleware) lookup(ctx context.Context, keyId string) (domain.ApiKey, error) {
+	now := time.Now()
 
-	for {
-		select {
-		case <-m.stopCh:
-			return
-		case <-ticker.C:
-			if err := m.refreshPlans(); err != nil {
-				// Log but don't crash - continue with cached data
-				// Logger would need to be added to struct, for now just continue
-			}
-		}
+	// Fast read-only access to cached data (no blocking operations)
+	m.mu.RLock()
+	cached, exists := m.data[keyId]
+	missingUntil, missing := m.notFound[keyId]
+	generation := m.generation
+	m.mu.RUnlock()
+
+	if exists && now.Before(cached.expiresAt) {
+		return cached.key, nil
+	}
+	if missing && now.Before(missingUntil) {
+		return domain.ApiKey{}, constant.ApiKeyNotFoundErr
 	}
-}
 
-func (m *PriorityMiddleware) refreshPlans() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, constant.DBTxTimeout)
 	defer cancel()
 
-	redisData, err := m.redisClient.Get(ctx, constant.RedisPlanKey).Result()
-	if err != nil {
-		return err
+	key, err := m.apiKeyService.GetApiKey(ctx, keyId)
+	if err != nil && !errors.Is(err, constant.ApiKeyNotFoundErr) {
+		return domain.ApiKey{}, err
+	}
+
+	m.mu.Lock()
+	if m.generation == generation {
+		if err != nil {
+			m.cacheNotFound(keyId, now)
+		} else {
+			delete(m.notFound, keyId)
+			m.data[keyId] = cachedApiKey{key: key, expiresAt: now.Add(constant.ApiKeyCacheTTL)}
+		}
 	}
+	m.mu.Unlock()
 
-	h := sha256.New()
-	h.Write([]byte(redisData))
-	hashed := h.Sum(nil)
+	return key, err
+}
+
+// cacheNotFound remembers an unknown key id, expired ids are swept when the
+// cache is full and it starts over when none expired. Callers hold mu.
+func (m *PriorityMiddleware) cacheNotFound(keyId string, now time.Time) {
+	delete(m.data, keyId)
+	if len(m.notFound) >= constant.ApiKeyNotFoundCacheSize {
+		for id, until := range m.notFound {
+			if !now.Before(until) {
+				delete(m.notFound, id)
+			}
+		}
+		if len(m.notFound) >= constant.ApiKeyNotFoundCacheSize {
+			m.notFound = make(map[string]time.Time)
+		}
+	}
+	m.notFound[keyId] = now.Add(constant.ApiKeyNotFoundTTL)
+}
 
+// legacyKey finds the plan of an api key issued before keys belonged to
+// customers. The key has no owner, the caller sets the customer.
+func (m *PriorityMiddleware) legacyKey(ctx context.Context, apiKey string) (domain.ApiKey, error) {
 	m.mu.RLock()
-	currentChecksum := m.dataChecksum
+	plan, exists := m.legacyPlans[apiKey]
 	m.mu.RUnlock()
 
-	if currentChecksum == string(hashed) {
-		return nil
-	}
+	if !exists {
+		ctx, cancel := context.WithTimeout(ctx, constant.DBTxTimeout)
+		defer cancel()
 
-	plans, err := m.planService.GetAllPlansAndSetInRedis(ctx)
-	if err != nil {
-		return err
-	}
+		var err error
+		plan, err = m.apiKeyService.LegacyPlan(ctx, apiKey)
+		if err != nil {
+			if errors.Is(err, constant.PlanNotFoundErr) {
+				return domain.ApiKey{}, constant.ApiKeyNotFoundErr
+			}
+			return domain.ApiKey{}, err
+		}
 
-	marshalled, err := json.Marshal(plans)
-	if err != nil {
-		return err
+		m.mu.Lock()
+		m.legacyPlans[apiKey] = plan
+		m.mu.Unlock()
 	}
 
-	h.Reset()
-	h.Write(marshalled)
-	newHash := h.Sum(nil)
+	return domain.ApiKey{PlanID: plan.ID, Priority: plan.Priority}, nil
+}
+
+// listen drops the keys published on the invalidation channel. Invalidations
+// sent while the subscription was down are lost, so the whole cache is dropped
+// whenever it is (re)established.
+func (m *PriorityMiddleware) listen(ctx context.Context) {
+	pubsub := m.redisClient.Subscribe(ctx, constant.RedisApiKeysChannel)
+	defer pubsub.Close()
+
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			m.logger.Errorf("api key invalidation: receive error, resubscribing: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			m.invalidate(nil)
+		case *redis.Message:
+			m.invalidate(&msg.Payload)
+		}
+	}
+}
 
+// invalidate drops a key from the cache, or every key when keyId is nil.
+func (m *PriorityMiddleware) invalidate(keyId *string) {
 	m.mu.Lock()
-	m.data = plans
-	m.dataChecksum = string(newHash)
-	m.mu.Unlock()
+	defer m.mu.Unlock()
 
-	return nil
+	m.generation++
+	if keyId == nil {
+		m.data = make(map[string]cachedApiKey)
+		m.notFound = make(map[string]time.Time)
+		return
+	}
+	delete(m.data, *keyId)
+	delete(m.notFound, *keyId)
 }
@@ -0,0 +1,12 @@
+package request
+
+// CreateApiKeyRequest issues a key. Plan is the name of the plan and can only
+// be chosen by an admin, customers get a key on the plan of the key they use.
+type CreateApiKeyRequest struct {
+	Label string `json:"label"`
+	Plan  string `json:"plan"`
+}
+
+type LabelApiKeyRequest struct {
+	Label string `json:"label"`
+}
@@ -0,0 +1,5 @@
+package request
+
+type RegisterWebhookRequest struct {
+	Url string `json:"url"`
+}
@@ -1,6 +1,33 @@
 package request
 
+import "time"
+
 type SendSmsRequest struct {
 	PhoneNumber string `json:"phone_number"`
 	Message     string `json:"message"`
+	// SendAt holds the message back until the given time, a missing or past
+	// value sends it right away
+	SendAt *time.Time `json:"send_at,omitempty"`
+}
+
+// SendBulkSmsRequest either carries explicit items or one message for many
+// phone numbers, both forms may be combined in a single request.
+type SendBulkSmsRequest struct {
+	Items        []SendSmsRequest `json:"items"`
+	Message      string           `json:"message"`
+	PhoneNumbers []string         `json:"phone_numbers"`
+	SendAt       *time.Time       `json:"send_at,omitempty"`
+}
+
+func (r SendBulkSmsRequest) ToItems() []SendSmsRequest {
+	items := make([]SendSmsRequest, 0, len(r.Items)+len(r.PhoneNumbers))
+	items = append(items, r.Items...)
+	for _, phone := range r.PhoneNumbers {
+		items = append(items, SendSmsRequest{
+			PhoneNumber: phone,
+			Message:     r.Message,
+			SendAt:      r.SendAt,
+		})
+	}
+	return items
 }
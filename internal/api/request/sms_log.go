@@ -0,0 +1,24 @@
+package request
+
+import "time"
+
+// SmsLogQuery holds the query parameters of the message list. Status is a
+// comma separated list, From and To bound the accepted time of the messages.
+type SmsLogQuery struct {
+	Status   string    `form:"status"`
+	Phone    string    `form:"phone"`
+	From     time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To       time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Priority int       `form:"priority"`
+	Query    string    `form:"q"`
+	Cursor   string    `form:"cursor"`
+	PageSize int       `form:"page_size"`
+}
+
+// SmsLogExportQuery holds the query parameters of the message export, both
+// bounds are required.
+type SmsLogExportQuery struct {
+	Format string    `form:"format"`
+	From   time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
@@ -1,7 +1,10 @@
 package api
 
 import (
+	"arvan/message-gateway/internal/api/handler/apikey"
+	"arvan/message-gateway/internal/api/handler/dlr"
 	"arvan/message-gateway/internal/api/handler/sms"
+	"arvan/message-gateway/internal/api/handler/webhook"
 	"arvan/message-gateway/internal/api/middleware"
 )
 
@@ -14,15 +17,49 @@ import (
 // @Schemes 					https
 func (s *Server) SetupAPIRoutes(
 	smsHandler *sms.SmsHandler,
+	webhookHandler *webhook.WebhookHandler,
+	dlrHandler *dlr.DlrHandler,
+	apiKeyHandler *apikey.ApiKeyHandler,
 	priorityMiddleware *middleware.PriorityMiddleware,
+	idempotencyMiddleware *middleware.IdempotencyMiddleware,
+	adminMiddleware *middleware.AdminMiddleware,
 ) {
 	r := s.engine
 
+	// providers authenticate their delivery receipts with a token of their own
+	r.POST("/v1/dlr/:provider", dlrHandler.Receive)
+	r.GET("/v1/dlr/:provider", dlrHandler.Receive)
+
 	v1 := r.Group("v1")
-	v1.Use(middleware.HandleAuth(), priorityMiddleware.Handle)
+	// the api key decides the customer and the priority of a request
+	v1.Use(priorityMiddleware.Handle)
 	{
-		v1.POST("/sms/send", smsHandler.Send)
+		v1.POST("/sms/send", idempotencyMiddleware.Handle, smsHandler.Send)
+		v1.POST("/sms/send/bulk", idempotencyMiddleware.Handle, smsHandler.SendBulk)
 		v1.GET("/sms/log", smsHandler.GetAllSmsLog)
+		v1.GET("/sms/log/export", smsHandler.ExportSmsLog)
 		v1.GET("/sms/:id", smsHandler.ViewSmsTimeLine)
+		v1.DELETE("/sms/:id", smsHandler.Cancel)
+
+		v1.PUT("/webhook", webhookHandler.Register)
+		v1.GET("/webhook", webhookHandler.Get)
+		v1.DELETE("/webhook", webhookHandler.Delete)
+
+		v1.POST("/api-keys", apiKeyHandler.Create)
+		v1.GET("/api-keys", apiKeyHandler.List)
+		v1.PATCH("/api-keys/:key_id", apiKeyHandler.Label)
+		v1.POST("/api-keys/:key_id/rotate", apiKeyHandler.Rotate)
+		v1.DELETE("/api-keys/:key_id", apiKeyHandler.Revoke)
+	}
+
+	// operators manage the keys of any customer with the admin token
+	admin := r.Group("admin/v1/customers/:customer_id")
+	admin.Use(adminMiddleware.Handle)
+	{
+		admin.POST("/api-keys", apiKeyHandler.Create)
+		admin.GET("/api-keys", apiKeyHandler.List)
+		admin.PATCH("/api-keys/:key_id", apiKeyHandler.Label)
+		admin.POST("/api-keys/:key_id/rotate", apiKeyHandler.Rotate)
+		admin.DELETE("/api-keys/:key_id", apiKeyHandler.Revoke)
 	}
 }
@@ -1,6 +1,10 @@
 package config
 
-import "github.com/sirupsen/logrus"
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
 
 type AppEnv string
 
@@ -12,20 +16,69 @@ const (
 	TestEnv       AppEnv = "test"
 )
 
+// RefundPolicy decides whether a message that permanently failed is refunded.
+type RefundPolicy string
+
+const (
+	// RefundNever keeps the charge of every message that was attempted
+	RefundNever RefundPolicy = "never"
+	// RefundOnFailure refunds every message that ends up failed
+	RefundOnFailure RefundPolicy = "on_failure"
+)
+
+// AuthMode decides how the customer of a request is found.
+type AuthMode string
+
+const (
+	// AuthKey takes the customer from the owner of X-Api-Key alone
+	AuthKey AuthMode = "key"
+	// AuthGateway also requires the X-Auth-User-Id header of the api gateway
+	// and rejects requests where it is not the owner of the key
+	AuthGateway AuthMode = "gateway"
+)
+
+// ProviderType selects the SMSProvider implementation used by the consumer.
+type ProviderType string
+
+const (
+	StubProvider ProviderType = "stub"
+	HTTPProvider ProviderType = "http"
+	SMPPProvider ProviderType = "smpp"
+)
+
 type (
 	Config struct {
 		AppEnv      AppEnv
 		LogLevel    logrus.Level
 		HTTP        HTTP
+		Auth        Auth
 		Database    Database
 		Kafka       Kafka
 		WorkerCount int
+		Scheduler   Scheduler
+		Delivery    Delivery
+		Dlq         Dlq
+		StatusLog   StatusLog
+		// Providers are tried in this order unless a routing rule says otherwise
+		Providers []Provider
+		Routing   Routing
 	}
 
 	HTTP struct {
 		Port int
 	}
 
+	// Auth configures how requests are authenticated, the admin api to manage
+	// the keys of any customer is only served when AdminToken is set.
+	Auth struct {
+		Mode       AuthMode
+		AdminToken string
+		// LegacyPlanKeys still accepts the api keys of plans, which belong to
+		// no customer, while customers move to their own keys. The customer
+		// comes from X-Auth-User-Id, so it needs AuthGateway.
+		LegacyPlanKeys bool
+	}
+
 	Database struct {
 		Postgres   Postgres
 		Redis      Redis
@@ -59,4 +112,127 @@ type (
 		Host string
 		Port int
 	}
+
+	// Scheduler configures the weighted fair queuing done by the queue manager.
+	// Weights maps a plan priority to the number of jobs a customer on that plan
+	// may be served per round, AgingThreshold is the longest a customer with
+	// pending jobs may wait before it is served out of turn.
+	Scheduler struct {
+		Weights        map[int]int
+		AgingThreshold time.Duration
+	}
+
+	// Delivery configures how often a job is tried before it is marked as failed
+	// and whether the customer gets its money back then.
+	Delivery struct {
+		MaxAttempts  int
+		RefundPolicy RefundPolicy
+	}
+
+	// Dlq configures how rows of kafka_dlq are republished. The server only runs
+	// the background re-driver when RedriveEnabled is set.
+	Dlq struct {
+		RedriveEnabled  bool
+		RedriveInterval time.Duration
+		MaxAttempts     int
+		Backoff         time.Duration
+		BatchSize       int
+	}
+
+	// StatusLog configures how consume-status writes status events to
+	// clickhouse. Every writer flushes at BatchSize events or every
+	// FlushInterval, a failed flush is retried after RetryBackoff doubling up
+	// to a minute.
+	StatusLog struct {
+		Writers       int
+		BatchSize     int
+		FlushInterval time.Duration
+		RetryBackoff  time.Duration
+	}
+
+	Provider struct {
+		Name string
+		Type ProviderType
+		// TPS caps the messages sent per second to the provider across all
+		// workers, 0 means no limit. Burst is the size of the token bucket.
+		TPS   float64
+		Burst int
+		HTTP  HTTPProviderConfig
+		SMPP  SMPPProviderConfig
+		DLR   DLR
+	}
+
+	// DLR describes the delivery receipts a provider posts to /v1/dlr/<name>.
+	// The fields are dot separated paths into a json body, or form and query
+	// keys. Receipts must carry Token, a provider without one refuses receipts
+	// over http.
+	DLR struct {
+		Token       string
+		IDField     string
+		StatusField string
+	}
+
+	// Routing picks the providers of a job, the first rule that matches wins
+	// and jobs no rule matches use every provider in the configured order.
+	Routing struct {
+		Rules   []RoutingRule
+		Breaker CircuitBreaker
+	}
+
+	// RoutingRule matches a job when every field that is set matches. Providers
+	// are tried in order, the next one is used when one fails.
+	RoutingRule struct {
+		Prefix     string   `json:"prefix"`
+		CustomerID int      `json:"customer_id"`
+		Priority   int      `json:"priority"`
+		Providers  []string `json:"providers"`
+	}
+
+	// CircuitBreaker stops sending to a provider for OpenDuration once at least
+	// MinRequests were sent to it within Window and ErrorRate of them failed.
+	CircuitBreaker struct {
+		ErrorRate    float64
+		MinRequests  int
+		Window       time.Duration
+		OpenDuration time.Duration
+	}
+
+	// HTTPProviderConfig describes the HTTP API of an upstream aggregator.
+	// BodyTemplate is a text/template rendered with the job, response fields are
+	// dot separated paths into the JSON response body, e.g. "data.message_id".
+	HTTPProviderConfig struct {
+		URL         string
+		Method      string
+		ContentType string
+		AuthHeader  string
+		AuthValue   string
+		// BodyTemplate can use .ID, .Phone, .Message and .CustomerID and the json
+		// and urlquery functions to escape them
+		BodyTemplate string
+		Timeout      time.Duration
+
+		IDField        string
+		StatusField    string
+		ErrorCodeField string
+		// SuccessStatuses are the values of StatusField that mean the message was
+		// accepted, every response is a success when StatusField is empty
+		SuccessStatuses []string
+		// PermanentErrorCodes are the error codes that are not worth retrying
+		PermanentErrorCodes []string
+	}
+
+	// SMPPProviderConfig describes an SMPP 3.4 transceiver session to a carrier
+	// SMSC. Simulator starts the in-process SMSC simulator on Addr instead.
+	SMPPProviderConfig struct {
+		Addr                string
+		SystemID            string
+		Password            string
+		SystemType          string
+		SourceAddr          string
+		EnquireLinkInterval time.Duration
+		ResponseTimeout     time.Duration
+		ReconnectDelay      time.Duration
+		Window              int
+		Simulator           bool
+	}
 )
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"arvan/message-gateway/internal/constant"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -15,6 +19,42 @@ func Load() (*Config, error) {
 	viper.SetConfigName(".env")
 	viper.AllowEmptyEnv(true)
 	viper.SetDefault("APP_ENV", LocalEnv)
+	viper.SetDefault("AUTH_MODE", AuthKey)
+	viper.SetDefault("SCHEDULER_FREE_WEIGHT", 1)
+	viper.SetDefault("SCHEDULER_PRO_WEIGHT", 2)
+	viper.SetDefault("SCHEDULER_ENTERPRISE_WEIGHT", 4)
+	viper.SetDefault("SCHEDULER_AGING_THRESHOLD", 5*time.Second)
+	viper.SetDefault("DELIVERY_MAX_ATTEMPTS", 3)
+	viper.SetDefault("DELIVERY_REFUND_POLICY", RefundOnFailure)
+	viper.SetDefault("DLQ_REDRIVE_ENABLED", false)
+	viper.SetDefault("DLQ_REDRIVE_INTERVAL", 30*time.Second)
+	viper.SetDefault("DLQ_MAX_ATTEMPTS", 10)
+	viper.SetDefault("DLQ_BACKOFF", 10*time.Second)
+	viper.SetDefault("DLQ_BATCH_SIZE", 100)
+	viper.SetDefault("STATUS_LOG_WRITERS", 4)
+	viper.SetDefault("STATUS_LOG_BATCH_SIZE", 1000)
+	viper.SetDefault("STATUS_LOG_FLUSH_INTERVAL", time.Second)
+	viper.SetDefault("STATUS_LOG_RETRY_BACKOFF", time.Second)
+	viper.SetDefault("PROVIDER_TYPE", StubProvider)
+	viper.SetDefault("PROVIDER_TPS", 0)
+	viper.SetDefault("PROVIDER_HTTP_METHOD", "POST")
+	viper.SetDefault("PROVIDER_HTTP_CONTENT_TYPE", "application/json")
+	viper.SetDefault("PROVIDER_HTTP_AUTH_HEADER", "Authorization")
+	viper.SetDefault("PROVIDER_HTTP_BODY_TEMPLATE", `{"to":{{json .Phone}},"text":{{json .Message}},"reference":{{json .ID}}}`)
+	viper.SetDefault("PROVIDER_HTTP_TIMEOUT", 10*time.Second)
+	viper.SetDefault("PROVIDER_HTTP_ID_FIELD", "message_id")
+	viper.SetDefault("PROVIDER_SMPP_ADDR", "localhost:2775")
+	viper.SetDefault("PROVIDER_SMPP_ENQUIRE_LINK_INTERVAL", 30*time.Second)
+	viper.SetDefault("PROVIDER_SMPP_RESPONSE_TIMEOUT", 5*time.Second)
+	viper.SetDefault("PROVIDER_SMPP_RECONNECT_DELAY", 5*time.Second)
+	viper.SetDefault("PROVIDER_SMPP_WINDOW", 10)
+	viper.SetDefault("PROVIDER_SMPP_SIMULATOR", false)
+	viper.SetDefault("PROVIDER_DLR_ID_FIELD", "message_id")
+	viper.SetDefault("PROVIDER_DLR_STATUS_FIELD", "status")
+	viper.SetDefault("CIRCUIT_BREAKER_ERROR_RATE", 0.5)
+	viper.SetDefault("CIRCUIT_BREAKER_MIN_REQUESTS", 20)
+	viper.SetDefault("CIRCUIT_BREAKER_WINDOW", 30*time.Second)
+	viper.SetDefault("CIRCUIT_BREAKER_OPEN_DURATION", 30*time.Second)
 	viper.AutomaticEnv()
 	if err := viper.ReadInConfig(); err != nil {
 		if !errors.As(err, &viper.ConfigFileNotFoundError{}) {
@@ -27,6 +67,39 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("parsing LOG_LEVEL: %w", err)
 	}
 
+	authMode := AuthMode(viper.GetString("AUTH_MODE"))
+	if authMode != AuthKey && authMode != AuthGateway {
+		return nil, fmt.Errorf("parsing AUTH_MODE: unknown mode %q", authMode)
+	}
+	if viper.GetBool("AUTH_LEGACY_PLAN_KEYS") && authMode != AuthGateway {
+		return nil, fmt.Errorf("AUTH_LEGACY_PLAN_KEYS needs AUTH_MODE=gateway, plan keys do not belong to a customer")
+	}
+
+	// a job gets at least one try, less would fail it on its first error
+	if viper.GetInt("DELIVERY_MAX_ATTEMPTS") < 1 {
+		return nil, fmt.Errorf("DELIVERY_MAX_ATTEMPTS must be at least 1")
+	}
+
+	refundPolicy := RefundPolicy(viper.GetString("DELIVERY_REFUND_POLICY"))
+	if refundPolicy != RefundNever && refundPolicy != RefundOnFailure {
+		return nil, fmt.Errorf("parsing DELIVERY_REFUND_POLICY: unknown policy %q", refundPolicy)
+	}
+
+	if viper.GetInt("STATUS_LOG_WRITERS") <= 0 || viper.GetInt("STATUS_LOG_BATCH_SIZE") <= 0 ||
+		viper.GetDuration("STATUS_LOG_FLUSH_INTERVAL") <= 0 || viper.GetDuration("STATUS_LOG_RETRY_BACKOFF") <= 0 {
+		return nil, fmt.Errorf("STATUS_LOG_WRITERS, STATUS_LOG_BATCH_SIZE, STATUS_LOG_FLUSH_INTERVAL and STATUS_LOG_RETRY_BACKOFF must be positive")
+	}
+
+	providers, err := readProviders()
+	if err != nil {
+		return nil, err
+	}
+
+	routing, err := readRouting(providers)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
 		AppEnv:      AppEnv(viper.GetString("APP_ENV")),
 		LogLevel:    logLvl,
@@ -34,6 +107,11 @@ func Load() (*Config, error) {
 		HTTP: HTTP{
 			Port: viper.GetInt("HTTP_PORT"),
 		},
+		Auth: Auth{
+			Mode:           authMode,
+			AdminToken:     viper.GetString("ADMIN_TOKEN"),
+			LegacyPlanKeys: viper.GetBool("AUTH_LEGACY_PLAN_KEYS"),
+		},
 		Database: Database{
 			Postgres: Postgres{
 				Host:     viper.GetString("POSTGRES_HOST"),
@@ -60,5 +138,185 @@ func Load() (*Config, error) {
 			Host: viper.GetString("KAFKA_HOST"),
 			Port: viper.GetInt("KAFKA_PORT"),
 		},
+		Scheduler: Scheduler{
+			Weights: map[int]int{
+				constant.PriorityFree:       viper.GetInt("SCHEDULER_FREE_WEIGHT"),
+				constant.PriorityPro:        viper.GetInt("SCHEDULER_PRO_WEIGHT"),
+				constant.PriorityEnterprise: viper.GetInt("SCHEDULER_ENTERPRISE_WEIGHT"),
+			},
+			AgingThreshold: viper.GetDuration("SCHEDULER_AGING_THRESHOLD"),
+		},
+		Delivery: Delivery{
+			MaxAttempts:  viper.GetInt("DELIVERY_MAX_ATTEMPTS"),
+			RefundPolicy: refundPolicy,
+		},
+		Dlq: Dlq{
+			RedriveEnabled:  viper.GetBool("DLQ_REDRIVE_ENABLED"),
+			RedriveInterval: viper.GetDuration("DLQ_REDRIVE_INTERVAL"),
+			MaxAttempts:     viper.GetInt("DLQ_MAX_ATTEMPTS"),
+			Backoff:         viper.GetDuration("DLQ_BACKOFF"),
+			BatchSize:       viper.GetInt("DLQ_BATCH_SIZE"),
+		},
+		StatusLog: StatusLog{
+			Writers:       viper.GetInt("STATUS_LOG_WRITERS"),
+			BatchSize:     viper.GetInt("STATUS_LOG_BATCH_SIZE"),
+			FlushInterval: viper.GetDuration("STATUS_LOG_FLUSH_INTERVAL"),
+			RetryBackoff:  viper.GetDuration("STATUS_LOG_RETRY_BACKOFF"),
+		},
+		Providers: providers,
+		Routing:   routing,
+	}, nil
+}
+
+// readProviders reads the providers named in PROVIDERS, every one from the
+// PROVIDER_<NAME>_ variables falling back to the PROVIDER_ ones. Without
+// PROVIDERS there is a single provider named default read from PROVIDER_.
+func readProviders() ([]Provider, error) {
+	names := splitList(viper.GetString("PROVIDERS"))
+	if len(names) == 0 {
+		provider, err := readProvider("default", "")
+		if err != nil {
+			return nil, err
+		}
+		return []Provider{provider}, nil
+	}
+
+	providers := make([]Provider, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			return nil, fmt.Errorf("parsing PROVIDERS: duplicate provider %q", name)
+		}
+		seen[name] = true
+
+		provider, err := readProvider(name, strings.ToUpper(name)+"_")
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+
+	return providers, nil
+}
+
+func readProvider(name, prefix string) (Provider, error) {
+	key := func(suffix string) string {
+		if prefix != "" && viper.IsSet("PROVIDER_"+prefix+suffix) {
+			return "PROVIDER_" + prefix + suffix
+		}
+		return "PROVIDER_" + suffix
+	}
+
+	providerType := ProviderType(viper.GetString(key("TYPE")))
+	if providerType != StubProvider && providerType != HTTPProvider && providerType != SMPPProvider {
+		return Provider{}, fmt.Errorf("parsing %s: unknown provider %q", key("TYPE"), providerType)
+	}
+	if providerType == HTTPProvider && viper.GetString(key("HTTP_URL")) == "" {
+		return Provider{}, fmt.Errorf("%s is required for the http provider", key("HTTP_URL"))
+	}
+
+	if providerType == SMPPProvider {
+		for _, name := range []string{"SMPP_ENQUIRE_LINK_INTERVAL", "SMPP_RESPONSE_TIMEOUT", "SMPP_RECONNECT_DELAY"} {
+			if viper.GetDuration(key(name)) <= 0 {
+				return Provider{}, fmt.Errorf("%s must be positive for the smpp provider", key(name))
+			}
+		}
+	}
+
+	tps := viper.GetFloat64(key("TPS"))
+	burst := viper.GetInt(key("BURST"))
+	if burst <= 0 {
+		burst = max(1, int(tps))
+	}
+
+	return Provider{
+		Name:  name,
+		Type:  providerType,
+		TPS:   tps,
+		Burst: burst,
+		HTTP: HTTPProviderConfig{
+			URL:                 viper.GetString(key("HTTP_URL")),
+			Method:              viper.GetString(key("HTTP_METHOD")),
+			ContentType:         viper.GetString(key("HTTP_CONTENT_TYPE")),
+			AuthHeader:          viper.GetString(key("HTTP_AUTH_HEADER")),
+			AuthValue:           viper.GetString(key("HTTP_AUTH_VALUE")),
+			BodyTemplate:        viper.GetString(key("HTTP_BODY_TEMPLATE")),
+			Timeout:             viper.GetDuration(key("HTTP_TIMEOUT")),
+			IDField:             viper.GetString(key("HTTP_ID_FIELD")),
+			StatusField:         viper.GetString(key("HTTP_STATUS_FIELD")),
+			ErrorCodeField:      viper.GetString(key("HTTP_ERROR_CODE_FIELD")),
+			SuccessStatuses:     splitList(viper.GetString(key("HTTP_SUCCESS_STATUSES"))),
+			PermanentErrorCodes: splitList(viper.GetString(key("HTTP_PERMANENT_ERROR_CODES"))),
+		},
+		SMPP: SMPPProviderConfig{
+			Addr:                viper.GetString(key("SMPP_ADDR")),
+			SystemID:            viper.GetString(key("SMPP_SYSTEM_ID")),
+			Password:            viper.GetString(key("SMPP_PASSWORD")),
+			SystemType:          viper.GetString(key("SMPP_SYSTEM_TYPE")),
+			SourceAddr:          viper.GetString(key("SMPP_SOURCE_ADDR")),
+			EnquireLinkInterval: viper.GetDuration(key("SMPP_ENQUIRE_LINK_INTERVAL")),
+			ResponseTimeout:     viper.GetDuration(key("SMPP_RESPONSE_TIMEOUT")),
+			ReconnectDelay:      viper.GetDuration(key("SMPP_RECONNECT_DELAY")),
+			Window:              viper.GetInt(key("SMPP_WINDOW")),
+			Simulator:           viper.GetBool(key("SMPP_SIMULATOR")),
+		},
+		DLR: DLR{
+			Token:       viper.GetString(key("DLR_TOKEN")),
+			IDField:     viper.GetString(key("DLR_ID_FIELD")),
+			StatusField: viper.GetString(key("DLR_STATUS_FIELD")),
+		},
 	}, nil
 }
+
+// readRouting parses ROUTING_RULES, a json array of RoutingRule, and checks
+// that the rules only name configured providers.
+func readRouting(providers []Provider) (Routing, error) {
+	routing := Routing{
+		Breaker: CircuitBreaker{
+			ErrorRate:    viper.GetFloat64("CIRCUIT_BREAKER_ERROR_RATE"),
+			MinRequests:  viper.GetInt("CIRCUIT_BREAKER_MIN_REQUESTS"),
+			Window:       viper.GetDuration("CIRCUIT_BREAKER_WINDOW"),
+			OpenDuration: viper.GetDuration("CIRCUIT_BREAKER_OPEN_DURATION"),
+		},
+	}
+	// a rate of 0 would open the breaker of a provider that never failed
+	if rate := routing.Breaker.ErrorRate; rate <= 0 || rate > 1 {
+		return Routing{}, fmt.Errorf("parsing CIRCUIT_BREAKER_ERROR_RATE: %v is not in (0, 1]", rate)
+	}
+
+	raw := viper.GetString("ROUTING_RULES")
+	if raw == "" {
+		return routing, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &routing.Rules); err != nil {
+		return Routing{}, fmt.Errorf("parsing ROUTING_RULES: %w", err)
+	}
+
+	known := make(map[string]bool, len(providers))
+	for _, provider := range providers {
+		known[provider.Name] = true
+	}
+	for i, rule := range routing.Rules {
+		if len(rule.Providers) == 0 {
+			return Routing{}, fmt.Errorf("parsing ROUTING_RULES: rule %d has no providers", i)
+		}
+		for _, name := range rule.Providers {
+			if !known[name] {
+				return Routing{}, fmt.Errorf("parsing ROUTING_RULES: rule %d uses unknown provider %q", i, name)
+			}
+		}
+	}
+
+	return routing, nil
+}
+
+// splitList splits a comma separated env value, empty items are dropped
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -7,26 +7,54 @@ import (
 )
 
 const (
-	RedisPlanKey       = "arvan:plans"
-	TopicAccepted      = "sms.accepted"
-	TopicStatus        = "sms.status"
-	KafkaProducerAcks  = kafka.RequireAll
-	KafkaWorkerBufSize = 100000
-	KafkaRetryBackoff  = 500 * time.Millisecond
-	DBTxTimeout        = 2 * time.Second
+	// every server drops a key published here from its cache
+	RedisApiKeysChannel = "arvan:api_keys:invalidate"
+	TopicAccepted       = "sms.accepted"
+	TopicStatus         = "sms.status"
+	KafkaProducerAcks   = kafka.RequireAll
+	DBTxTimeout         = 2 * time.Second
+
+	// cached api keys are read again after ApiKeyCacheTTL in case an
+	// invalidation was lost, key ids that were not found are remembered for
+	// ApiKeyNotFoundTTL, at most ApiKeyNotFoundCacheSize of them
+	ApiKeyCacheTTL          = 5 * time.Minute
+	ApiKeyNotFoundTTL       = 10 * time.Second
+	ApiKeyNotFoundCacheSize = 10000
 
 	DefaultPageSize    = 20
 	DefaultCurrentPage = 1
+	MaxPageSize        = 100
+	// longest free text searched in the message list
+	MaxSearchLength = 100
+	// rows written between two flushes of an sms log export
+	ExportFlushRows      = 1000
+	MaxApiKeyLabelLength = 100
 
 	// Kafka
-	KafkaGroupID = "sms-processor-group"
+	KafkaGroupID        = "sms-processor-group"
+	KafkaWebhookGroupID = "sms-webhook-group"
+	KafkaCommitInterval = time.Second
 
-	// Timeouts and retries
+	// Timeouts
 	KafkaWriteTimeout = 5 * time.Second
-	KafkaWriteRetries = 3
 
 	UserIdKey   = "user_id"
 	PriorityKey = "priority"
+	// the key of a self-service request, admin requests have none
+	ApiKeyKey = "api_key"
+	// set by the send handlers once the customer was charged for the request
+	ChargedKey = "charged"
+
+	// Plan priorities as stored in the plans table
+	PriorityFree       = 1
+	PriorityPro        = 2
+	PriorityEnterprise = 3
+
+	// every sms is charged 10 rials
+	SmsCost = 10
+
+	// maximum number of recipients accepted by a single bulk send
+	MaxBulkSize = 1000
 
 	// Redis balance cache settings
 	BalanceKeyPrefix     = "balance:"
@@ -34,7 +62,78 @@ const (
 	BalanceSyncInterval  = 800 * time.Millisecond
 	BalanceQueueSize     = 100000
 	BalanceWriterWorkers = 6
+	// marks a refund credited in redis until its ledger row records it
+	RefundKeyPrefix = "refund:"
+	RefundKeyTTL    = 24 * time.Hour
+	// ledger rows that are still not credited after the delay are credited
+	// again while their refund key guards them
+	RefundReconcileInterval  = time.Minute
+	RefundReconcileDelay     = time.Minute
+	RefundReconcileBatchSize = 100
+
+	// Idempotency-Key records of the send endpoints
+	IdempotencyKeyPrefix = "idempotency:"
+	IdempotencyTTL       = 24 * time.Hour
+	// a reservation outlives any send request, so a crashed request only
+	// blocks its key this long
+	IdempotencyInProgressTTL = time.Minute
+
+	// Scheduled delivery, messages wait in a redis sorted set scored by send_at
+	RedisScheduledSetKey     = "sms:scheduled"
+	RedisScheduledPayloadKey = "sms:scheduled:payloads"
+	ScheduleMaxAhead         = 30 * 24 * time.Hour
+	ScheduleReleaseInterval  = time.Second
+	ScheduleReleaseBatchSize = 500
+
+	// Webhook delivery
+	WebhookTimeout         = 5 * time.Second
+	WebhookMaxAttempts     = 5
+	WebhookRetryBackoff    = time.Second
+	WebhookCacheTTL        = time.Minute
+	WebhookDispatchWorkers = 20
+	// events buffered per dispatch worker
+	WebhookDispatchQueueSize = 50
+	// a worker that can neither deliver nor store an event tries it again
+	// after the backoff instead of committing its offset
+	WebhookDispatchErrorBackoff = time.Second
+	// failed events are retried from webhook_retries, outside of the workers
+	WebhookRetryInterval  = time.Second
+	WebhookRetryBatchSize = 100
+	// longer than a post, a dispatcher that dies leaves its rows to the others after it
+	WebhookRetryClaimLease = 30 * time.Second
+
+	// SMS provider calls
+	ProviderSendTimeout     = 10 * time.Second
+	ProviderThrottleBackoff = time.Second
+	// longest a worker waits for a token of a provider's TPS limit
+	ProviderLimiterMaxWait = time.Second
+
+	// Delivery receipts, the provider message ids of sent messages are cached
+	// for as long as carriers usually report on them
+	RedisProviderMessageKeyPrefix = "dlr:"
+	ProviderMessageCacheTTL       = 72 * time.Hour
+	// the provider_messages rows outlive the cache for the late receipts
+	ProviderMessagePurgeInterval = time.Hour
+	ProviderMessageRetention     = 7 * 24 * time.Hour
+	// receipts that were faster than recording the send are looked up again
+	ReceiptLookupRetries = 5
+	ReceiptLookupBackoff = time.Second
+
+	// Status consumer, the last status of recent messages is kept in memory to
+	// check transitions, older ones are read from clickhouse
+	StatusStateTTL           = time.Hour
+	StatusStateSweepInterval = time.Minute
+	StatusLogMaxRetryBackoff = time.Minute
+	StatusLogInsertTimeout   = 10 * time.Second
+
+	// a claimed kafka_dlq row is skipped by other replicas until its lease ends
+	DlqClaimLease = time.Minute
 
-	// Kafka producer worker pool
-	KafkaWriteWorkerPool = 50
+	// Outbox relay, accepted messages are published from the outbox table
+	OutboxRelayInterval  = 100 * time.Millisecond
+	OutboxRelayBatchSize = 500
+	OutboxPurgeInterval  = time.Hour
+	OutboxRetention      = 24 * time.Hour
+	// longer than a kafka write, a relay that dies leaves its rows to the others after it
+	OutboxClaimLease = 30 * time.Second
 )
@@ -2,8 +2,46 @@ package constant
 
 import "github.com/pkg/errors"
 
-const InsufficientBalanceErrMsg = "insufficient balance"
+const (
+	InsufficientBalanceErrMsg     = "insufficient balance"
+	InvalidSendAtErrMsg           = "send_at is too far in the future"
+	ScheduledSmsNotFoundErrMsg    = "scheduled sms not found"
+	SmsNotFoundErrMsg             = "sms not found"
+	ApiKeyNotFoundErrMsg          = "api key not found"
+	PlanNotFoundErrMsg            = "plan not found"
+	InvalidApiKeyLabelErrMsg      = "api key label is too long"
+	WebhookNotFoundErrMsg         = "webhook not found"
+	InvalidWebhookUrlErrMsg       = "webhook url must be an absolute http or https url"
+	WebhookHostNotAllowedErrMsg   = "webhook url must resolve to public addresses only"
+	UnknownProviderErrMsg         = "unknown provider"
+	InvalidDlrTokenErrMsg         = "invalid delivery receipt token"
+	DlrDisabledErrMsg             = "delivery receipts are disabled for this provider, its dlr token is not set"
+	InvalidDlrErrMsg              = "delivery receipt has no message id"
+	ProviderMessageNotFoundErrMsg = "provider message not found"
+	InvalidStatusErrMsg           = "unknown message status"
+	InvalidStatusTransitionErrMsg = "impossible message status transition"
+	InvalidSmsLogFilterErrMsg     = "invalid sms log filter"
+	InvalidExportFormatErrMsg     = "export format must be csv or ndjson"
+)
 
 var (
-	InsufficientBalanceErr = errors.New(InsufficientBalanceErrMsg)
+	InsufficientBalanceErr     = errors.New(InsufficientBalanceErrMsg)
+	InvalidSendAtErr           = errors.New(InvalidSendAtErrMsg)
+	ScheduledSmsNotFoundErr    = errors.New(ScheduledSmsNotFoundErrMsg)
+	SmsNotFoundErr             = errors.New(SmsNotFoundErrMsg)
+	ApiKeyNotFoundErr          = errors.New(ApiKeyNotFoundErrMsg)
+	PlanNotFoundErr            = errors.New(PlanNotFoundErrMsg)
+	InvalidApiKeyLabelErr      = errors.New(InvalidApiKeyLabelErrMsg)
+	WebhookNotFoundErr         = errors.New(WebhookNotFoundErrMsg)
+	InvalidWebhookUrlErr       = errors.New(InvalidWebhookUrlErrMsg)
+	WebhookHostNotAllowedErr   = errors.New(WebhookHostNotAllowedErrMsg)
+	UnknownProviderErr         = errors.New(UnknownProviderErrMsg)
+	InvalidDlrTokenErr         = errors.New(InvalidDlrTokenErrMsg)
+	DlrDisabledErr             = errors.New(DlrDisabledErrMsg)
+	InvalidDlrErr              = errors.New(InvalidDlrErrMsg)
+	ProviderMessageNotFoundErr = errors.New(ProviderMessageNotFoundErrMsg)
+	InvalidStatusErr           = errors.New(InvalidStatusErrMsg)
+	InvalidStatusTransitionErr = errors.New(InvalidStatusTransitionErrMsg)
+	InvalidSmsLogFilterErr     = errors.New(InvalidSmsLogFilterErrMsg)
+	InvalidExportFormatErr     = errors.New(InvalidExportFormatErrMsg)
 )
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// ApiKeyPrefix starts every key issued by the gateway, the key id and the
+// secret follow it separated by underscores.
+const ApiKeyPrefix = "mgw_"
+
+// ApiKey authenticates the requests of a customer, the plan of the key sets
+// their priority. Only a salted hash of the secret is stored, KeyID finds the
+// key and is safe to show.
+type ApiKey struct {
+	ID         int64      `json:"-"`
+	CustomerID int        `json:"customer_id"`
+	PlanID     int64      `json:"plan_id"`
+	Priority   int        `json:"priority"`
+	KeyID      string     `json:"key_id"`
+	Salt       string     `json:"-"`
+	KeyHash    string     `json:"-"`
+	Label      string     `json:"label"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IssuedApiKey is a new key with its secret, the only time it is returned.
+type IssuedApiKey struct {
+	ApiKey
+	Key string `json:"key"`
+}
+
+// HashApiKey hashes a secret with its salt.
+func HashApiKey(salt, secret string) string {
+	sum := sha256.Sum256([]byte(salt + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseApiKey splits a key into its id and secret. Keys issued before they
+// had an id are found by their unsalted hash and have no salt.
+func ParseApiKey(key string) (keyId, secret string) {
+	if rest, ok := strings.CutPrefix(key, ApiKeyPrefix); ok {
+		if keyId, secret, ok := strings.Cut(rest, "_"); ok && keyId != "" && secret != "" {
+			return keyId, secret
+		}
+	}
+	return HashApiKey("", key), key
+}
+
+// Matches reports whether secret is the secret of the key.
+func (k ApiKey) Matches(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashApiKey(k.Salt, secret)), []byte(k.KeyHash)) == 1
+}
+
+func (k ApiKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
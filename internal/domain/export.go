@@ -0,0 +1,20 @@
+package domain
+
+// ExportFormat is the encoding of an sms log export.
+type ExportFormat string
+
+const (
+	ExportFormatCSV    ExportFormat = "csv"
+	ExportFormatNDJSON ExportFormat = "ndjson"
+)
+
+func (f ExportFormat) Valid() bool {
+	return f == ExportFormatCSV || f == ExportFormatNDJSON
+}
+
+func (f ExportFormat) ContentType() string {
+	if f == ExportFormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
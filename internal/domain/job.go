@@ -3,10 +3,25 @@ package domain
 import "time"
 
 type Job struct {
+	// ID is the message id minted when the sms was accepted, it stays the same
+	// for every status event of the message
 	ID         string
 	CustomerID int
 	Priority   int
 	Phone      string
 	Message    string
 	CreatedAt  time.Time
+	// Attempts counts the failed provider calls of the job
+	Attempts int
+	// Throttles counts how often the job was delayed by provider limits, it
+	// does not use up attempts
+	Throttles int
+	// NotBefore delays a throttled job, the queue manager does not hand it
+	// out before then
+	NotBefore time.Time `json:"-"`
+	// Status is the last status the consumer published for the job
+	Status Status `json:"-"`
+	// Done is called once the job reached a terminal outcome, the consumer uses
+	// it to commit the kafka offset the job was read from
+	Done func() `json:"-"`
 }
@@ -1,8 +1,25 @@
 package domain
 
+import "time"
+
 type KafkaMessage struct {
 	Key      string
 	Payload  []byte
 	Topic    string
 	Attempts int
 }
+
+// DlqMessage is a kafka message that is parked in the kafka_dlq table.
+type DlqMessage struct {
+	ID int64
+	KafkaMessage
+	CreatedAt     time.Time
+	LastAttemptAt *time.Time
+}
+
+// OutboxMessage is a kafka message waiting in the outbox table for the relay.
+type OutboxMessage struct {
+	ID int64
+	KafkaMessage
+	CreatedAt time.Time
+}
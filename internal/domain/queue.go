@@ -4,6 +4,9 @@ type CustomerQueue interface {
 	Enqueue(job Job) error
 	Dequeue() (Job, error)
 	Len() int
+	// Ready reports whether a job can be dequeued now, delayed jobs count in
+	// Len but are not ready before their NotBefore
+	Ready() bool
 	IsEmpty() bool
 }
 
@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+// ProviderMessage links the id a provider gave a sent message to the message,
+// delivery receipts only carry the provider's id.
+type ProviderMessage struct {
+	Provider          string
+	ProviderMessageID string
+	MessageID         string
+	CustomerID        int
+	Phone             string
+	Priority          int
+	CreatedAt         time.Time
+	SentAt            time.Time
+}
+
+// Job rebuilds the job of the message for its status events, the text of the
+// message is not kept.
+func (pm ProviderMessage) Job() Job {
+	return Job{
+		ID:         pm.MessageID,
+		CustomerID: pm.CustomerID,
+		Priority:   pm.Priority,
+		Phone:      pm.Phone,
+		CreatedAt:  pm.CreatedAt,
+	}
+}
+
+// Receipt is a delivery receipt of a provider, Status is one of the final
+// statuses delivered, undelivered or expired and Stat the status the provider sent.
+type Receipt struct {
+	Provider          string
+	ProviderMessageID string
+	Status            Status
+	Stat              string
+}
@@ -3,10 +3,68 @@ package domain
 import "time"
 
 type Sms struct {
-	MessageId  string    `json:"message_id"`
-	CustomerId int       `json:"customer_id"`
-	Priority   int       `json:"priority"`
-	To         string    `json:"to"`
-	Message    string    `json:"message"`
-	CreatedAt  time.Time `json:"created_at"`
+	MessageId  string     `json:"message_id"`
+	CustomerId int        `json:"customer_id"`
+	Priority   int        `json:"priority"`
+	To         string     `json:"to"`
+	Message    string     `json:"message"`
+	SendAt     *time.Time `json:"send_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (s Sms) ToJob() Job {
+	return Job{
+		ID:         s.MessageId,
+		CustomerID: s.CustomerId,
+		Phone:      s.To,
+		Message:    s.Message,
+		Priority:   s.Priority,
+		CreatedAt:  s.CreatedAt,
+	}
+}
+
+// SmsReceipt is returned to the customer once a message is accepted, so it can
+// be correlated with later status lookups.
+type SmsReceipt struct {
+	MessageId  string     `json:"message_id"`
+	Status     Status     `json:"status"`
+	Cost       int64      `json:"cost"`
+	Balance    int64      `json:"balance"`
+	AcceptedAt time.Time  `json:"accepted_at"`
+	SendAt     *time.Time `json:"send_at,omitempty"`
+}
+
+// CancelReceipt is returned when a scheduled message is cancelled and refunded.
+type CancelReceipt struct {
+	MessageId string `json:"message_id"`
+	Status    Status `json:"status"`
+	Refund    int64  `json:"refund"`
+	Balance   int64  `json:"balance"`
+}
+
+// QueuedSms is an accepted sms with the kafka messages that are written to the
+// outbox in the same transaction as its sms_logs row.
+type QueuedSms struct {
+	Sms    Sms
+	Outbox []KafkaMessage
+}
+
+// BulkItemResult reports what happened to one item of a bulk send, rejected
+// items carry the reason in Error and have no message id.
+type BulkItemResult struct {
+	Index       int    `json:"index"`
+	PhoneNumber string `json:"phone_number"`
+	Accepted    bool   `json:"accepted"`
+	MessageId   string `json:"message_id,omitempty"`
+	Status      Status `json:"status,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type BulkSmsReceipt struct {
+	Items      []BulkItemResult `json:"items"`
+	Accepted   int              `json:"accepted"`
+	Rejected   int              `json:"rejected"`
+	Cost       int64            `json:"cost"`
+	Balance    int64            `json:"balance"`
+	AcceptedAt time.Time        `json:"accepted_at"`
 }
@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// SmsLogFilter selects the messages of a customer in the message list, zero
+// fields do not filter. Messages come newest first, After continues a list
+// after the last message of the previous page.
+type SmsLogFilter struct {
+	Statuses []Status
+	Phone    string
+	From     time.Time
+	To       time.Time
+	Priority int
+	// Text matches messages containing it, case insensitive
+	Text  string
+	After *SmsLogCursor
+	Limit int
+}
+
+// SmsLogCursor is the position of a message in the message list.
+type SmsLogCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        string    `json:"i"`
+}
@@ -1,13 +1,171 @@
 package domain
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
+// Status is a state of a message, every status event moves the message along
+// the transitions below.
+type Status string
+
+const (
+	// StatusAccepted is a message that was charged and waits in the outbox
+	StatusAccepted Status = "accepted"
+	// StatusScheduled is a charged message waiting for its send_at
+	StatusScheduled Status = "scheduled"
+	// StatusQueued is a message waiting in the queue manager of the consumer
+	StatusQueued Status = "queued"
+	// StatusThrottled is a job a provider limit delayed, it waits in the queue
+	// manager until its retry time
+	StatusThrottled Status = "throttled"
+	StatusSending   Status = "sending"
+	// StatusSent is a message a provider accepted
+	StatusSent Status = "sent"
+	// final statuses reported by the carrier in delivery receipts
+	StatusDelivered   Status = "delivered"
+	StatusUndelivered Status = "undelivered"
+	StatusExpired     Status = "expired"
+	// StatusFailed is a message the providers rejected or that ran out of attempts
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+	StatusRefunded  Status = "refunded"
+)
+
+// a receipt can be published before the sent status of its message, so a
+// sending message can move to the receipt statuses too
+var transitions = map[Status][]Status{
+	StatusAccepted:    {StatusQueued, StatusFailed},
+	StatusScheduled:   {StatusAccepted, StatusCancelled},
+	StatusQueued:      {StatusSending, StatusFailed},
+	StatusSending:     {StatusSent, StatusThrottled, StatusFailed, StatusDelivered, StatusUndelivered, StatusExpired},
+	StatusThrottled:   {StatusSending, StatusFailed},
+	StatusSent:        {StatusDelivered, StatusUndelivered, StatusExpired},
+	StatusFailed:      {StatusRefunded},
+	StatusUndelivered: {StatusRefunded},
+}
+
+// legacyStatuses are the names used on sms.status before Status existed, they
+// are still found in the status log and in old events.
+var legacyStatuses = map[string]Status{
+	"init":       StatusAccepted,
+	"processing": StatusQueued,
+	"success":    StatusSent,
+}
+
+func (s Status) Valid() bool {
+	switch s {
+	case StatusAccepted, StatusScheduled, StatusQueued, StatusThrottled, StatusSending, StatusSent,
+		StatusDelivered, StatusUndelivered, StatusExpired, StatusFailed, StatusCancelled, StatusRefunded:
+		return true
+	default:
+		return false
+	}
+}
+
+// Initial reports whether a message can start with the status.
+func (s Status) Initial() bool {
+	return s == StatusAccepted || s == StatusScheduled
+}
+
+// CanTransitionTo reports whether a message in status s can move to next.
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseStatus returns the status with the given name, legacy names are mapped
+// to their current status.
+func ParseStatus(name string) Status {
+	if status, ok := legacyStatuses[name]; ok {
+		return status
+	}
+	return Status(name)
+}
+
+func (s *Status) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	*s = ParseStatus(name)
+	return nil
+}
+
+// StatusEvent is the payload of every message on the sms.status topic.
+type StatusEvent struct {
+	ID         string `json:"ID"`
+	CustomerID int    `json:"CustomerID"`
+	Phone      string `json:"Phone"`
+	Message    string `json:"Message"`
+	Priority   int    `json:"Priority"`
+	Status     Status `json:"status"`
+	// Reason says why a message failed or went back to the queue, e.g. the
+	// provider error or the stat of a delivery receipt
+	Reason string `json:"reason,omitempty"`
+	// ErrorCode is the code of the provider error or receipt that failed the
+	// message
+	ErrorCode string `json:"error_code,omitempty"`
+	// Provider, Segments and Cost are set from the send result once a provider
+	// took the message, receipts only name the provider
+	Provider  string    `json:"provider,omitempty"`
+	Segments  int       `json:"segments,omitempty"`
+	Cost      int64     `json:"cost,omitempty"`
+	Attempts  int       `json:"Attempts"`
+	CreatedAt time.Time `json:"CreatedAt"`
+	// Timestamp is when the message got the status
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func NewStatusEvent(job Job, status Status, reason string) StatusEvent {
+	return StatusEvent{
+		ID:         job.ID,
+		CustomerID: job.CustomerID,
+		Phone:      job.Phone,
+		Message:    job.Message,
+		Priority:   job.Priority,
+		Status:     status,
+		Reason:     reason,
+		Attempts:   job.Attempts,
+		CreatedAt:  job.CreatedAt,
+		Timestamp:  time.Now(),
+	}
+}
+
+// KafkaMessage is the event as it is written to the outbox, keyed by the
+// message id so the events of a message stay in order.
+func (e StatusEvent) KafkaMessage(topic string) (KafkaMessage, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return KafkaMessage{}, err
+	}
+
+	return KafkaMessage{
+		Key:     e.ID,
+		Payload: payload,
+		Topic:   topic,
+	}, nil
+}
+
+// SMSStatus is a logged status of a message, or the current status of a
+// message in the message list.
 type SMSStatus struct {
 	ID         string    `json:"ID"`
 	CustomerID int       `json:"CustomerID"`
 	Phone      string    `json:"Phone"`
 	Message    string    `json:"Message"`
 	Priority   int       `json:"Priority"`
-	Status     string    `json:"status"`
+	Status     Status    `json:"status"`
+	Provider   string    `json:"provider,omitempty"`
+	ErrorCode  string    `json:"error_code,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Segments   int       `json:"segments,omitempty"`
+	Cost       int64     `json:"cost,omitempty"`
+	Attempt    int       `json:"attempt"`
 	CreatedAt  time.Time `json:"CreatedAt"`
+	Timestamp  time.Time `json:"timestamp"`
 }
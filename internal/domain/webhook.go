@@ -0,0 +1,31 @@
+package domain
+
+import "time"
+
+type Webhook struct {
+	CustomerId int       `json:"customer_id"`
+	Url        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WebhookEvent is the body posted to a customer's callback url on every status transition.
+type WebhookEvent struct {
+	MessageId  string    `json:"message_id"`
+	CustomerId int       `json:"customer_id"`
+	Phone      string    `json:"phone"`
+	Status     Status    `json:"status"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// WebhookRetry is an event waiting in webhook_retries for its next attempt.
+type WebhookRetry struct {
+	ID            int64
+	CustomerId    int
+	MessageId     string
+	Payload       []byte
+	AttemptCount  int
+	LastError     string
+	NextAttemptAt time.Time
+}
@@ -92,7 +92,7 @@ func (c *ClickHouseClient) prepareConnection(dbName string) (*migrate.Migrate, e
 		return nil, err
 	}
 
-	driver, err := migrateCk.WithInstance(conn, &migrateCk.Config{})
+	driver, err := migrateCk.WithInstance(conn, &migrateCk.Config{MultiStatementEnabled: true})
 	if err != nil {
 		return nil, err
 	}
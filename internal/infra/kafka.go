@@ -3,9 +3,13 @@ package infra
 import (
 	"arvan/message-gateway/internal/config"
 	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"context"
 	"fmt"
 	"github.com/segmentio/kafka-go"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 func NewKafkaWriter(cfg config.Kafka, topic string) *kafka.Writer {
@@ -20,14 +24,29 @@ func NewKafkaWriter(cfg config.Kafka, topic string) *kafka.Writer {
 	}
 }
 
-func NewKafkaConsumer(cfg config.Kafka, topic string) *kafka.Reader {
+func NewKafkaConsumer(cfg config.Kafka, topic, groupID string) *kafka.Reader {
 	return kafka.NewReader(kafka.ReaderConfig{
 		Brokers:               []string{fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)},
 		Topic:                 topic,
-		GroupID:               constant.KafkaGroupID,
+		GroupID:               groupID,
 		MinBytes:              1e3,  // 1KB
 		MaxBytes:              10e6, // 10MB
 		MaxWait:               500 * time.Millisecond,
 		WatchPartitionChanges: true,
 	})
 }
+
+// WriteStatusEvent publishes a status event to the topic of writer, producers
+// that do not go through the outbox use it.
+func WriteStatusEvent(ctx context.Context, writer *kafka.Writer, event domain.StatusEvent) error {
+	km, err := event.KafkaMessage(writer.Topic)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal status event")
+	}
+
+	return writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(km.Key),
+		Value: km.Payload,
+		Time:  event.Timestamp,
+	})
+}
@@ -18,7 +18,7 @@ func NewRedisClient(ctx context.Context, cfg config.Redis, logger *log.Logger) (
 	})
 
 	_, err := rdb.Ping(ctx).Result()
-	logger.Info(fmt.Sprintf("redis is running on %s : %s on db %d", cfg.Host, cfg.Port, cfg.Database))
+	logger.Info(fmt.Sprintf("redis is running on %s : %d on db %d", cfg.Host, cfg.Port, cfg.Database))
 	if err != nil {
 		return nil, err
 	}
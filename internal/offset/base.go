@@ -0,0 +1,45 @@
+package offset
+
+import (
+	"context"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Tracker commits kafka offsets only up to the first message of a partition
+// that is still in flight, so messages completing out of order never get an
+// unfinished message committed.
+type Tracker struct {
+	mu         sync.Mutex
+	committer  committer
+	partitions map[partitionKey]*partitionState
+	logger     *logrus.Logger
+}
+
+type committer interface {
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+type partitionState struct {
+	// inFlight holds the tracked offsets that are not committable yet, in order
+	inFlight []int64
+	done     map[int64]bool
+	// watermark is the highest offset whose predecessors are all done, -1 when
+	// there is nothing new to commit
+	watermark int64
+}
+
+func NewTracker(committer committer, logger *logrus.Logger) *Tracker {
+	return &Tracker{
+		committer:  committer,
+		partitions: make(map[partitionKey]*partitionState),
+		logger:     logger,
+	}
+}
@@ -0,0 +1,108 @@
+package offset
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+// Track registers a fetched message as in flight. Messages of a partition must
+// be tracked before any later message of the same partition is marked done.
+func (t *Tracker) Track(m kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := partitionKey{topic: m.Topic, partition: m.Partition}
+	state, ok := t.partitions[key]
+	if !ok {
+		state = &partitionState{
+			done:      make(map[int64]bool),
+			watermark: -1,
+		}
+		t.partitions[key] = state
+	}
+
+	i := sort.Search(len(state.inFlight), func(i int) bool { return state.inFlight[i] >= m.Offset })
+	if i < len(state.inFlight) && state.inFlight[i] == m.Offset {
+		return
+	}
+	state.inFlight = append(state.inFlight, 0)
+	copy(state.inFlight[i+1:], state.inFlight[i:])
+	state.inFlight[i] = m.Offset
+}
+
+// Done marks a tracked message as finished and moves the watermark of its
+// partition past every leading message that is done.
+func (t *Tracker) Done(m kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.partitions[partitionKey{topic: m.Topic, partition: m.Partition}]
+	if !ok {
+		return
+	}
+
+	state.done[m.Offset] = true
+	for len(state.inFlight) > 0 && state.done[state.inFlight[0]] {
+		state.watermark = state.inFlight[0]
+		delete(state.done, state.inFlight[0])
+		state.inFlight = state.inFlight[1:]
+	}
+}
+
+// Commit commits the watermark of every partition that moved since the last commit.
+func (t *Tracker) Commit(ctx context.Context) error {
+	t.mu.Lock()
+	msgs := make([]kafka.Message, 0, len(t.partitions))
+	for key, state := range t.partitions {
+		if state.watermark < 0 {
+			continue
+		}
+		msgs = append(msgs, kafka.Message{
+			Topic:     key.topic,
+			Partition: key.partition,
+			Offset:    state.watermark,
+		})
+	}
+	t.mu.Unlock()
+
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	if err := t.committer.CommitMessages(ctx, msgs...); err != nil {
+		return errors.Wrap(err, "failed to commit offsets")
+	}
+
+	t.mu.Lock()
+	for _, msg := range msgs {
+		state := t.partitions[partitionKey{topic: msg.Topic, partition: msg.Partition}]
+		// a newer watermark may have been set while committing
+		if state.watermark == msg.Offset {
+			state.watermark = -1
+		}
+	}
+	t.mu.Unlock()
+
+	return nil
+}
+
+// Run commits the watermarks every interval until ctx is done.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Commit(ctx); err != nil {
+				t.logger.Errorf("offset tracker: %v", err)
+			}
+		}
+	}
+}
@@ -1,9 +1,32 @@
 package provider
 
-import "arvan/message-gateway/internal/domain"
+import (
+	"arvan/message-gateway/internal/config"
+	"arvan/message-gateway/internal/domain"
+	"arvan/message-gateway/pkg/smpp"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
 
 type SMSProvider interface {
-	Send(job domain.Job) error
+	// Send hands the job to the provider. Errors that are not a *Error are
+	// treated as retryable.
+	Send(ctx context.Context, job domain.Job) (SendResult, error)
+}
+
+// SendResult is what the provider reported for an accepted message.
+type SendResult struct {
+	// Provider is the name of the configured provider that took the message
+	Provider string
+	// ProviderMessageID is the id the provider uses in its delivery reports
+	ProviderMessageID string
+	Segments          int
+	// Cost is what the provider charged for the message
+	Cost       int64
+	AcceptedAt time.Time
 }
 
 type StubProvider struct{}
@@ -11,3 +34,52 @@ type StubProvider struct{}
 func NewStubProvider() SMSProvider {
 	return &StubProvider{}
 }
+
+// NewRouted creates every configured provider behind a Router.
+func NewRouted(ctx context.Context, cfg *config.Config, onReceipt ReceiptHandler, logger *logrus.Logger) (*Router, error) {
+	names := make([]string, 0, len(cfg.Providers))
+	providers := make(map[string]SMSProvider, len(cfg.Providers))
+	limits := make(map[string]config.Provider, len(cfg.Providers))
+	for _, providerCfg := range cfg.Providers {
+		provider, err := New(ctx, providerCfg, onReceipt, logger)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s: %w", providerCfg.Name, err)
+		}
+		names = append(names, providerCfg.Name)
+		providers[providerCfg.Name] = provider
+		limits[providerCfg.Name] = providerCfg
+	}
+
+	return NewRouter(names, providers, limits, cfg.Routing, logger), nil
+}
+
+// New returns the provider selected by cfg.Type. Providers that get delivery
+// receipts over their session pass them to onReceipt, the sessions live until
+// ctx is done.
+func New(ctx context.Context, cfg config.Provider, onReceipt ReceiptHandler, logger *logrus.Logger) (SMSProvider, error) {
+	switch cfg.Type {
+	case config.StubProvider:
+		return NewStubProvider(), nil
+	case config.HTTPProvider:
+		httpProvider, err := NewHTTPProvider(cfg.HTTP, nil)
+		if err != nil {
+			return nil, err
+		}
+		return httpProvider, nil
+	case config.SMPPProvider:
+		if cfg.SMPP.Simulator {
+			simulator, err := smpp.NewSimulator(cfg.SMPP.Addr, logger)
+			if err != nil {
+				return nil, err
+			}
+			go simulator.Serve(ctx)
+			logger.Infof("smsc simulator listening on %s", simulator.Addr())
+		}
+
+		smppProvider := NewSMPPProvider(cfg.Name, cfg.SMPP, onReceipt, logger)
+		smppProvider.Start(ctx)
+		return smppProvider, nil
+	default:
+		return nil, fmt.Errorf("unknown provider type %q", cfg.Type)
+	}
+}
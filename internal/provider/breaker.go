@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"arvan/message-gateway/internal/config"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker is a circuit breaker over fixed windows. Once open it lets a single
+// probe through after OpenDuration and closes again when the probe succeeds.
+type breaker struct {
+	mu  sync.Mutex
+	cfg config.CircuitBreaker
+
+	state       breakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probing     bool
+}
+
+func newBreaker(cfg config.CircuitBreaker) *breaker {
+	return &breaker{
+		cfg:         cfg,
+		windowStart: time.Now(),
+	}
+}
+
+// allow reports whether a request may be sent, and if not how long until the
+// breaker lets a probe through.
+func (b *breaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		wait := b.cfg.OpenDuration - time.Since(b.openedAt)
+		if wait > 0 {
+			return false, wait
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true, 0
+	case breakerHalfOpen:
+		if b.probing {
+			return false, b.cfg.OpenDuration
+		}
+		b.probing = true
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+// cancel gives back a half-open probe that was allowed but not sent, or
+// whose outcome does not count.
+func (b *breaker) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.probing = false
+	}
+}
+
+// record counts the outcome of an allowed request and returns the state
+// before and after it.
+func (b *breaker) record(success bool) (breakerState, breakerState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	from := b.state
+	now := time.Now()
+
+	switch b.state {
+	case breakerHalfOpen:
+		b.probing = false
+		if success {
+			b.reset(now)
+			b.state = breakerClosed
+		} else {
+			b.state = breakerOpen
+			b.openedAt = now
+		}
+	case breakerClosed:
+		if now.Sub(b.windowStart) > b.cfg.Window {
+			b.reset(now)
+		}
+		b.requests++
+		if !success {
+			b.failures++
+		}
+		if b.requests >= b.cfg.MinRequests && float64(b.failures) >= b.cfg.ErrorRate*float64(b.requests) {
+			b.state = breakerOpen
+			b.openedAt = now
+		}
+	}
+
+	return from, b.state
+}
+
+func (b *breaker) reset(now time.Time) {
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+}
@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type ErrorClass int
+
+const (
+	// Retryable errors are temporary, the job is tried again and counts as an attempt
+	Retryable ErrorClass = iota
+	// Permanent errors fail the job right away, e.g. an invalid number
+	Permanent
+	// Throttled means the provider refused to take the job now, it is tried
+	// again after RetryAfter without counting as an attempt
+	Throttled
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case Permanent:
+		return "permanent"
+	case Throttled:
+		return "throttled"
+	default:
+		return "retryable"
+	}
+}
+
+// Error is a classified provider error.
+type Error struct {
+	Class ErrorClass
+	// Code is the provider specific error code, if any
+	Code       string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("provider: %s error %s: %v", e.Class, e.Code, e.Err)
+	}
+	return fmt.Sprintf("provider: %s error: %v", e.Class, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func NewRetryableError(code string, err error) error {
+	return &Error{Class: Retryable, Code: code, Err: err}
+}
+
+func NewPermanentError(code string, err error) error {
+	return &Error{Class: Permanent, Code: code, Err: err}
+}
+
+func NewThrottledError(retryAfter time.Duration, err error) error {
+	return &Error{Class: Throttled, RetryAfter: retryAfter, Err: err}
+}
+
+// Classify returns the class of a Send error, unclassified errors are retryable.
+func Classify(err error) ErrorClass {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return perr.Class
+	}
+	return Retryable
+}
+
+// RetryAfter returns how long to wait before sending again after err, it is
+// zero unless the provider said so.
+func RetryAfter(err error) time.Duration {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return perr.RetryAfter
+	}
+	return 0
+}
+
+// ErrorCode returns the provider's code of a Send error, or an empty string.
+func ErrorCode(err error) string {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return perr.Code
+	}
+	return ""
+}
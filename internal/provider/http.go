@@ -0,0 +1,179 @@
+package provider
+
+import (
+	"arvan/message-gateway/internal/config"
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HTTPProvider sends jobs to an upstream aggregator described by
+// config.HTTPProviderConfig, so a new vendor only needs configuration.
+type HTTPProvider struct {
+	cfg    config.HTTPProviderConfig
+	client *http.Client
+	body   *template.Template
+}
+
+// templateJob is what the body template is rendered with.
+type templateJob struct {
+	ID         string
+	Phone      string
+	Message    string
+	CustomerID int
+}
+
+// NewHTTPProvider parses the body template of cfg. A nil client uses one with
+// the configured timeout.
+func NewHTTPProvider(cfg config.HTTPProviderConfig, client *http.Client) (*HTTPProvider, error) {
+	body, err := template.New("body").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"urlquery": url.QueryEscape,
+	}).Parse(cfg.BodyTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse provider body template")
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Timeout}
+	}
+
+	return &HTTPProvider{
+		cfg:    cfg,
+		client: client,
+		body:   body,
+	}, nil
+}
+
+// Send maps the response to an error class: 429 is throttled, other 4xx are
+// permanent and 5xx or transport errors are retryable. A 2xx response whose
+// status field is not a success status fails with its error code, which is
+// permanent only when listed in PermanentErrorCodes.
+func (h *HTTPProvider) Send(ctx context.Context, job domain.Job) (SendResult, error) {
+	var body bytes.Buffer
+	if err := h.body.Execute(&body, templateJob{
+		ID:         job.ID,
+		Phone:      job.Phone,
+		Message:    job.Message,
+		CustomerID: job.CustomerID,
+	}); err != nil {
+		return SendResult{}, NewPermanentError("", errors.Wrap(err, "failed to render provider body"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, h.cfg.Method, h.cfg.URL, &body)
+	if err != nil {
+		return SendResult{}, NewPermanentError("", errors.Wrap(err, "failed to build provider request"))
+	}
+	req.Header.Set("Content-Type", h.cfg.ContentType)
+	if h.cfg.AuthHeader != "" && h.cfg.AuthValue != "" {
+		req.Header.Set(h.cfg.AuthHeader, h.cfg.AuthValue)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return SendResult{}, NewRetryableError("", errors.Wrap(err, "provider request failed"))
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return SendResult{}, NewRetryableError("", errors.Wrap(err, "failed to read provider response"))
+	}
+
+	var fields map[string]interface{}
+	if len(raw) > 0 {
+		// vendors may answer errors with a non json body, the status code still classifies them
+		_ = json.Unmarshal(raw, &fields)
+	}
+	errorCode := Lookup(fields, h.cfg.ErrorCodeField)
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return SendResult{}, NewThrottledError(retryAfter(resp.Header.Get("Retry-After")), fmt.Errorf("provider returned %d", resp.StatusCode))
+	case resp.StatusCode >= 500:
+		return SendResult{}, NewRetryableError(errorCode, fmt.Errorf("provider returned %d", resp.StatusCode))
+	case resp.StatusCode >= 400:
+		return SendResult{}, NewPermanentError(errorCode, fmt.Errorf("provider returned %d", resp.StatusCode))
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return SendResult{}, NewRetryableError(errorCode, fmt.Errorf("provider returned %d", resp.StatusCode))
+	}
+
+	if h.cfg.StatusField != "" {
+		status := Lookup(fields, h.cfg.StatusField)
+		if !slices.Contains(h.cfg.SuccessStatuses, status) {
+			cause := fmt.Errorf("provider returned status %q", status)
+			if slices.Contains(h.cfg.PermanentErrorCodes, errorCode) {
+				return SendResult{}, NewPermanentError(errorCode, cause)
+			}
+			return SendResult{}, NewRetryableError(errorCode, cause)
+		}
+	}
+
+	segments := Segments(job.Message)
+	return SendResult{
+		ProviderMessageID: Lookup(fields, h.cfg.IDField),
+		Segments:          segments,
+		Cost:              int64(segments) * constant.SmsCost,
+		AcceptedAt:        time.Now(),
+	}, nil
+}
+
+// Lookup returns the value at a dot separated path of a decoded json object as
+// a string, or an empty string when the path does not exist.
+func Lookup(fields map[string]interface{}, path string) string {
+	if path == "" || fields == nil {
+		return ""
+	}
+
+	var value interface{} = fields
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		if value, ok = obj[key]; !ok {
+			return ""
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an http date.
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
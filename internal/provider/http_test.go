@@ -0,0 +1,221 @@
+package provider
+
+import (
+	"arvan/message-gateway/internal/config"
+	"arvan/message-gateway/internal/domain"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPProviderSend(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		header    map[string]string
+		body      string
+		wantErr   bool
+		wantClass ErrorClass
+		wantCode  string
+		wantRetry time.Duration
+		wantID    string
+	}{
+		{
+			name:   "accepted",
+			status: http.StatusOK,
+			body:   `{"status":"ok","data":{"message_id":"p-1"}}`,
+			wantID: "p-1",
+		},
+		{
+			name:   "numeric message id",
+			status: http.StatusCreated,
+			body:   `{"status":"ok","data":{"message_id":12345}}`,
+			wantID: "12345",
+		},
+		{
+			name:      "too many requests",
+			status:    http.StatusTooManyRequests,
+			header:    map[string]string{"Retry-After": "3"},
+			wantErr:   true,
+			wantClass: Throttled,
+			wantRetry: 3 * time.Second,
+		},
+		{
+			name:      "server error",
+			status:    http.StatusBadGateway,
+			body:      `{"error":{"code":"E500"}}`,
+			wantErr:   true,
+			wantClass: Retryable,
+			wantCode:  "E500",
+		},
+		{
+			name:      "client error",
+			status:    http.StatusBadRequest,
+			body:      `{"error":{"code":"E400"}}`,
+			wantErr:   true,
+			wantClass: Permanent,
+			wantCode:  "E400",
+		},
+		{
+			name:      "client error without json body",
+			status:    http.StatusUnauthorized,
+			body:      `unauthorized`,
+			wantErr:   true,
+			wantClass: Permanent,
+		},
+		{
+			name:      "rejected with a permanent code",
+			status:    http.StatusOK,
+			body:      `{"status":"failed","error":{"code":"INVALID_NUMBER"}}`,
+			wantErr:   true,
+			wantClass: Permanent,
+			wantCode:  "INVALID_NUMBER",
+		},
+		{
+			name:      "rejected with another code",
+			status:    http.StatusOK,
+			body:      `{"status":"failed","error":{"code":"BUSY"}}`,
+			wantErr:   true,
+			wantClass: Retryable,
+			wantCode:  "BUSY",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("method = %s, want POST", r.Method)
+				}
+				if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+					t.Errorf("content type = %q, want application/json", ct)
+				}
+				if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+					t.Errorf("authorization = %q, want Bearer token", auth)
+				}
+				raw, _ := io.ReadAll(r.Body)
+				if err := json.Unmarshal(raw, &got); err != nil {
+					t.Errorf("request body %q is not json: %v", raw, err)
+				}
+
+				for key, value := range tt.header {
+					w.Header().Set(key, value)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			p := newTestHTTPProvider(t, server.URL)
+			job := domain.Job{ID: "m-1", CustomerID: 7, Phone: "989121234567", Message: `say "hi"`}
+			result, err := p.Send(context.Background(), job)
+
+			if got["to"] != job.Phone || got["text"] != job.Message || got["ref"] != job.ID {
+				t.Errorf("request body = %v, want the job rendered into it", got)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Send succeeded, want a %s error", tt.wantClass)
+				}
+				if class := Classify(err); class != tt.wantClass {
+					t.Fatalf("class = %s, want %s (%v)", class, tt.wantClass, err)
+				}
+				var perr *Error
+				if !errors.As(err, &perr) || perr.Code != tt.wantCode {
+					t.Fatalf("error = %v, want code %q", err, tt.wantCode)
+				}
+				if retry := RetryAfter(err); retry != tt.wantRetry {
+					t.Fatalf("retry after = %s, want %s", retry, tt.wantRetry)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			if result.ProviderMessageID != tt.wantID {
+				t.Fatalf("provider message id = %q, want %q", result.ProviderMessageID, tt.wantID)
+			}
+			if result.Segments != 1 || result.AcceptedAt.IsZero() {
+				t.Fatalf("result = %+v, want one segment and an accepted time", result)
+			}
+		})
+	}
+}
+
+func TestHTTPProviderTransportError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	_, err := newTestHTTPProvider(t, url).Send(context.Background(), domain.Job{ID: "m-1", Phone: "989121234567"})
+	if err == nil {
+		t.Fatal("Send to a closed server succeeded")
+	}
+	if class := Classify(err); class != Retryable {
+		t.Fatalf("class = %s, want retryable", class)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	fields := map[string]interface{}{
+		"id":   "a",
+		"n":    float64(42),
+		"ok":   true,
+		"null": nil,
+		"data": map[string]interface{}{"message": map[string]interface{}{"id": "nested"}},
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "id", want: "a"},
+		{path: "n", want: "42"},
+		{path: "ok", want: "true"},
+		{path: "null", want: ""},
+		{path: "data.message.id", want: "nested"},
+		{path: "data.missing", want: ""},
+		{path: "id.deeper", want: ""},
+		{path: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := Lookup(fields, tt.path); got != tt.want {
+				t.Fatalf("Lookup(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestHTTPProvider(t *testing.T, url string) *HTTPProvider {
+	t.Helper()
+
+	p, err := NewHTTPProvider(config.HTTPProviderConfig{
+		URL:                 url,
+		Method:              http.MethodPost,
+		ContentType:         "application/json",
+		AuthHeader:          "Authorization",
+		AuthValue:           "Bearer token",
+		BodyTemplate:        `{"to":{{json .Phone}},"text":{{json .Message}},"ref":{{json .ID}}}`,
+		Timeout:             time.Second,
+		IDField:             "data.message_id",
+		StatusField:         "status",
+		ErrorCodeField:      "error.code",
+		SuccessStatuses:     []string{"ok"},
+		PermanentErrorCodes: []string{"INVALID_NUMBER"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewHTTPProvider: %v", err)
+	}
+
+	return p
+}
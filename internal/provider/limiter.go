@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket limits the sends to a provider to rate per second with bursts
+// of up to burst messages. It is shared by every worker.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns nil when rate is not positive, a nil bucket never limits.
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait takes a token, waiting for it when the next one is due within maxWait.
+// Otherwise it takes nothing and returns false with the time until a token is free.
+func (b *tokenBucket) wait(ctx context.Context, maxWait time.Duration) (bool, time.Duration) {
+	if b == nil {
+		return true, 0
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.mu.Unlock()
+		return true, 0
+	}
+
+	delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if delay > maxWait {
+		b.mu.Unlock()
+		return false, delay
+	}
+	// reserve the next token, the bucket goes negative until it is due
+	b.tokens--
+	b.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true, 0
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return false, delay
+	}
+}
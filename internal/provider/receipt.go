@@ -0,0 +1,30 @@
+package provider
+
+import (
+	"arvan/message-gateway/internal/domain"
+	"arvan/message-gateway/pkg/smpp"
+	"context"
+	"strings"
+)
+
+// ReceiptHandler resolves a delivery receipt to its message. It returns
+// constant.ProviderMessageNotFoundErr while the send is not recorded yet.
+type ReceiptHandler func(ctx context.Context, receipt domain.Receipt) error
+
+// ReceiptStatus maps the status of a delivery receipt to a final message
+// status, undeliverable messages are failed. It understands the SMPP receipt
+// stats and their spelled out forms, intermediate statuses map to an empty
+// status.
+func ReceiptStatus(stat string) domain.Status {
+	switch strings.ToUpper(strings.TrimSpace(stat)) {
+	case smpp.StatDelivered, "DELIVERED":
+		return domain.StatusDelivered
+	case smpp.StatExpired:
+		return domain.StatusExpired
+	case smpp.StatUndeliverable, smpp.StatRejected, smpp.StatDeleted, smpp.StatUnknown,
+		"UNDELIVERED", "UNDELIVERABLE", "REJECTED", "FAILED":
+		return domain.StatusUndelivered
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,138 @@
+package provider
+
+import (
+	"arvan/message-gateway/internal/config"
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Router is an SMSProvider over several named providers. A job is sent to
+// the providers of the first routing rule it matches, moving on to the next
+// one on retryable or throttled errors. Providers whose circuit breaker is
+// open or whose TPS limit is used up are skipped.
+type Router struct {
+	providers map[string]routedProvider
+	order     []string
+	rules     []config.RoutingRule
+	logger    *logrus.Logger
+}
+
+type routedProvider struct {
+	provider SMSProvider
+	breaker  *breaker
+	limiter  *tokenBucket
+}
+
+// NewRouter routes over providers, names lists them in the default order and
+// limits holds the TPS limit of every provider.
+func NewRouter(
+	names []string,
+	providers map[string]SMSProvider,
+	limits map[string]config.Provider,
+	routing config.Routing,
+	logger *logrus.Logger,
+) *Router {
+	routed := make(map[string]routedProvider, len(providers))
+	for name, provider := range providers {
+		routed[name] = routedProvider{
+			provider: provider,
+			breaker:  newBreaker(routing.Breaker),
+			limiter:  newTokenBucket(limits[name].TPS, limits[name].Burst),
+		}
+	}
+
+	return &Router{
+		providers: routed,
+		order:     names,
+		rules:     routing.Rules,
+		logger:    logger,
+	}
+}
+
+func (r *Router) Send(ctx context.Context, job domain.Job) (SendResult, error) {
+	var (
+		lastErr error
+		wait    time.Duration
+	)
+
+	for _, name := range r.route(job) {
+		routed := r.providers[name]
+
+		allowed, retryIn := routed.breaker.allow()
+		if !allowed {
+			if wait == 0 || retryIn < wait {
+				wait = retryIn
+			}
+			continue
+		}
+
+		if ok, retryIn := routed.limiter.wait(ctx, constant.ProviderLimiterMaxWait); !ok {
+			// the probe of a half-open breaker was not sent, give it back
+			routed.breaker.cancel()
+			lastErr = NewThrottledError(retryIn, fmt.Errorf("tps limit of %s reached", name))
+			continue
+		}
+
+		result, err := routed.provider.Send(ctx, job)
+		class := Classify(err)
+
+		if class == Throttled {
+			// tps pushback says nothing about the health of the provider, a
+			// half-open probe is given back for the next request
+			routed.breaker.cancel()
+		} else {
+			// a permanent error is about the message, not the provider
+			from, to := routed.breaker.record(err == nil || class == Permanent)
+			if from != to {
+				r.logger.Warnf("provider router: circuit breaker of %s is %s", name, to)
+			}
+		}
+
+		if err == nil {
+			result.Provider = name
+			return result, nil
+		}
+		if class == Permanent || ctx.Err() != nil {
+			return SendResult{}, err
+		}
+
+		r.logger.Debugf("provider router: %s failed for job %s, trying the next provider: %v", name, job.ID, err)
+		lastErr = err
+	}
+
+	if lastErr != nil {
+		if Classify(lastErr) == Throttled && wait > 0 && RetryAfter(lastErr) > wait {
+			return SendResult{}, NewThrottledError(wait, lastErr)
+		}
+		return SendResult{}, lastErr
+	}
+
+	// every provider of the route has an open breaker
+	return SendResult{}, NewThrottledError(wait, fmt.Errorf("no provider available for job %s", job.ID))
+}
+
+// route returns the providers of the first rule the job matches.
+func (r *Router) route(job domain.Job) []string {
+	phone := strings.TrimPrefix(job.Phone, "+")
+
+	for _, rule := range r.rules {
+		if rule.Prefix != "" && !strings.HasPrefix(phone, strings.TrimPrefix(rule.Prefix, "+")) {
+			continue
+		}
+		if rule.CustomerID != 0 && rule.CustomerID != job.CustomerID {
+			continue
+		}
+		if rule.Priority != 0 && rule.Priority != job.Priority {
+			continue
+		}
+		return rule.Providers
+	}
+
+	return r.order
+}
@@ -0,0 +1,42 @@
+package provider
+
+// gsm7 holds the characters of the GSM 03.38 basic character set, a message
+// with any other character is sent as UCS-2.
+const gsm7 = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extended characters take two septets.
+const gsm7Extended = "^{}\\[~]|€\f"
+
+// Segments returns the number of SMS parts the message is split into.
+func Segments(message string) int {
+	septets := 0
+	for _, r := range message {
+		switch {
+		case containsRune(gsm7, r):
+			septets++
+		case containsRune(gsm7Extended, r):
+			septets += 2
+		default:
+			return parts(len([]rune(message)), 70, 67)
+		}
+	}
+
+	return parts(septets, 160, 153)
+}
+
+func parts(length, single, multi int) int {
+	if length <= single {
+		return 1
+	}
+	return (length + multi - 1) / multi
+}
+
+func containsRune(s string, r rune) bool {
+	for _, c := range s {
+		if c == r {
+			return true
+		}
+	}
+	return false
+}
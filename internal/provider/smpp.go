@@ -0,0 +1,153 @@
+package provider
+
+import (
+	"arvan/message-gateway/internal/config"
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"arvan/message-gateway/pkg/smpp"
+	"context"
+	"fmt"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// SMPPProvider submits jobs over an SMPP transceiver session and passes the
+// delivery receipts of the SMSC to the receipt handler.
+type SMPPProvider struct {
+	name      string
+	cfg       config.SMPPProviderConfig
+	client    *smpp.Client
+	onReceipt ReceiptHandler
+	logger    *logrus.Logger
+}
+
+func NewSMPPProvider(name string, cfg config.SMPPProviderConfig, onReceipt ReceiptHandler, logger *logrus.Logger) *SMPPProvider {
+	p := &SMPPProvider{
+		name:      name,
+		cfg:       cfg,
+		onReceipt: onReceipt,
+		logger:    logger,
+	}
+	p.client = smpp.NewClient(smpp.Config{
+		Addr:                cfg.Addr,
+		SystemID:            cfg.SystemID,
+		Password:            cfg.Password,
+		SystemType:          cfg.SystemType,
+		EnquireLinkInterval: cfg.EnquireLinkInterval,
+		ResponseTimeout:     cfg.ResponseTimeout,
+		ReconnectDelay:      cfg.ReconnectDelay,
+		Window:              cfg.Window,
+	}, p.deliver, logger)
+
+	return p
+}
+
+// Start keeps the session bound until ctx is done.
+func (s *SMPPProvider) Start(ctx context.Context) {
+	go s.client.Run(ctx)
+}
+
+func (s *SMPPProvider) Send(ctx context.Context, job domain.Job) (SendResult, error) {
+	dataCoding, message := smpp.EncodeMessage(job.Message)
+
+	sourceTON, sourceNPI := byte(1), byte(1)
+	if !numeric(s.cfg.SourceAddr) {
+		// alphanumeric sender id
+		sourceTON, sourceNPI = 5, 0
+	}
+
+	id, err := s.client.Submit(ctx, smpp.ShortMessage{
+		SourceTON:          sourceTON,
+		SourceNPI:          sourceNPI,
+		SourceAddr:         s.cfg.SourceAddr,
+		DestTON:            1,
+		DestNPI:            1,
+		DestAddr:           job.Phone,
+		RegisteredDelivery: 1,
+		DataCoding:         dataCoding,
+		Message:            message,
+	})
+	if err != nil {
+		return SendResult{}, s.classify(err)
+	}
+
+	segments := Segments(job.Message)
+	return SendResult{
+		ProviderMessageID: id,
+		Segments:          segments,
+		Cost:              int64(segments) * constant.SmsCost,
+		AcceptedAt:        time.Now(),
+	}, nil
+}
+
+func (s *SMPPProvider) classify(err error) error {
+	var statusErr smpp.StatusError
+	switch {
+	case errors.Is(err, smpp.ErrNotBound):
+		return NewThrottledError(s.cfg.ReconnectDelay, err)
+	case errors.As(err, &statusErr):
+		code := fmt.Sprintf("0x%08X", statusErr.Status)
+		switch statusErr.Status {
+		case smpp.StatusThrottled, smpp.StatusMsgQFul:
+			return NewThrottledError(0, err)
+		case smpp.StatusInvDstAdr, smpp.StatusInvSrcAdr, smpp.StatusInvMsgLen, smpp.StatusInvDstTON, smpp.StatusInvDstNPI:
+			return NewPermanentError(code, err)
+		default:
+			return NewRetryableError(code, err)
+		}
+	default:
+		return NewRetryableError("", err)
+	}
+}
+
+// deliver is called for every deliver_sm of the session.
+func (s *SMPPProvider) deliver(sm smpp.ShortMessage) {
+	receipt, ok := smpp.ParseDeliveryReceipt(sm)
+	if !ok {
+		s.logger.Debugf("smpp: ignoring mobile originated message from %s", sm.SourceAddr)
+		return
+	}
+
+	status := ReceiptStatus(receipt.Stat)
+	if status == "" || s.onReceipt == nil {
+		return
+	}
+
+	go s.report(domain.Receipt{
+		Provider:          s.name,
+		ProviderMessageID: receipt.ID,
+		Status:            status,
+		Stat:              receipt.Stat,
+	})
+}
+
+// report hands the receipt to the handler, a receipt that was faster than
+// recording the send is tried again a few times.
+func (s *SMPPProvider) report(receipt domain.Receipt) {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), constant.KafkaWriteTimeout)
+		err := s.onReceipt(ctx, receipt)
+		cancel()
+		if err == nil {
+			return
+		}
+
+		if !errors.Is(err, constant.ProviderMessageNotFoundErr) || attempt >= constant.ReceiptLookupRetries {
+			s.logger.Warnf("smpp: dropping %s receipt of %s: %v", receipt.Status, receipt.ProviderMessageID, err)
+			return
+		}
+		time.Sleep(constant.ReceiptLookupBackoff)
+	}
+}
+
+func numeric(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) && r != '+' {
+			return false
+		}
+	}
+	return true
+}
@@ -1,29 +1,59 @@
 package provider
 
 import (
+	"arvan/message-gateway/internal/constant"
 	"arvan/message-gateway/internal/domain"
+	"context"
 	"fmt"
 	"math/rand"
 	"time"
+
+	"github.com/google/uuid"
 )
 
-func (s *StubProvider) Send(job domain.Job) error {
+func (s *StubProvider) Send(ctx context.Context, job domain.Job) (SendResult, error) {
 	// Simulate latency 50-200ms
 	lat := 50 + rand.Intn(151)
-	time.Sleep(time.Duration(lat) * time.Millisecond)
+	if err := sleep(ctx, time.Duration(lat)*time.Millisecond); err != nil {
+		return SendResult{}, NewRetryableError("", err)
+	}
 
-	// 10% failure
-	if rand.Float32() < 0.1 {
-		return fmt.Errorf("provider: simulated failure for job %s", job.ID)
+	// 10% failure, mostly temporary
+	if p := rand.Float32(); p < 0.1 {
+		switch {
+		case p < 0.01:
+			return SendResult{}, NewThrottledError(time.Second, fmt.Errorf("simulated throttling for job %s", job.ID))
+		case p < 0.03:
+			return SendResult{}, NewPermanentError("invalid_destination", fmt.Errorf("simulated rejection for job %s", job.ID))
+		default:
+			return SendResult{}, NewRetryableError("", fmt.Errorf("simulated failure for job %s", job.ID))
+		}
 	}
 
 	// 20% process may take longer than usual
 	if rand.Float32() < 0.2 {
-		time.Sleep(time.Duration(rand.Intn(10)) * time.Second)
-		return nil
+		if err := sleep(ctx, time.Duration(rand.Intn(10))*time.Second); err != nil {
+			return SendResult{}, NewRetryableError("", err)
+		}
 	}
 
 	// print success message
 	fmt.Printf("Sms sent successfully for job %s. receiver :%d \n", job.ID, job.CustomerID)
-	return nil
+
+	segments := Segments(job.Message)
+	return SendResult{
+		ProviderMessageID: uuid.NewString(),
+		Segments:          segments,
+		Cost:              int64(segments) * constant.SmsCost,
+		AcceptedAt:        time.Now(),
+	}, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
 }
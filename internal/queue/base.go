@@ -1,14 +1,18 @@
 package queue
 
 import (
+	"arvan/message-gateway/internal/config"
 	"arvan/message-gateway/internal/domain"
 	"sync"
+	"time"
 )
 
 type customerQueue struct {
 	mu   sync.Mutex
 	jobs []domain.Job
-	id   int
+	// delayed holds the jobs whose NotBefore is still ahead, ordered by it
+	delayed []domain.Job
+	id      int
 }
 
 func NewCustomerQueue(customerID int) domain.CustomerQueue {
@@ -18,26 +22,44 @@ func NewCustomerQueue(customerID int) domain.CustomerQueue {
 	}
 }
 
+// customerState holds the deficit round robin bookkeeping of an active customer.
+type customerState struct {
+	priority   int
+	deficit    int
+	lastServed time.Time
+	promoted   bool
+}
+
 type QueueManager struct {
 	queues        sync.Map
 	activeMu      sync.Mutex
 	activeList    []int
 	activeSet     map[int]bool
+	states        map[int]*customerState
+	starved       []int
+	lastAgingScan time.Time
 	lockedMu      sync.Mutex
-	locked        map[int]bool
+	inFlight      map[int]int
 	roundRobinIdx int
 
+	weights        map[int]int
+	agingThreshold time.Duration
+
 	NewJobSignal chan struct{}
 }
 
-func NewQueueManager() domain.QueueManager {
+func NewQueueManager(cfg config.Scheduler) domain.QueueManager {
 	return &QueueManager{
-		queues:        sync.Map{},
-		activeList:    make([]int, 0),
-		activeSet:     make(map[int]bool),
-		locked:        make(map[int]bool),
-		NewJobSignal:  make(chan struct{}, 1),
-		roundRobinIdx: 0,
+		queues:         sync.Map{},
+		activeList:     make([]int, 0),
+		activeSet:      make(map[int]bool),
+		states:         make(map[int]*customerState),
+		starved:        make([]int, 0),
+		inFlight:       make(map[int]int),
+		weights:        cfg.Weights,
+		agingThreshold: cfg.AgingThreshold,
+		NewJobSignal:   make(chan struct{}, 1),
+		roundRobinIdx:  0,
 	}
 }
 
@@ -3,18 +3,37 @@ package queue
 import (
 	"arvan/message-gateway/internal/domain"
 	"fmt"
+	"sort"
+	"time"
 )
 
 func (q *customerQueue) Enqueue(job domain.Job) error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	q.jobs = append(q.jobs, job)
+
+	if !job.NotBefore.After(time.Now()) {
+		q.jobs = append(q.jobs, job)
+		return nil
+	}
+
+	i := sort.Search(len(q.delayed), func(i int) bool { return q.delayed[i].NotBefore.After(job.NotBefore) })
+	q.delayed = append(q.delayed, domain.Job{})
+	copy(q.delayed[i+1:], q.delayed[i:])
+	q.delayed[i] = job
 	return nil
 }
 
+// Dequeue returns a delayed job that became due before the waiting ones, it
+// was already in line before it was delayed.
 func (q *customerQueue) Dequeue() (domain.Job, error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
+
+	if q.dueLocked(time.Now()) {
+		job := q.delayed[0]
+		q.delayed = q.delayed[1:]
+		return job, nil
+	}
 	if len(q.jobs) == 0 {
 		return domain.Job{}, fmt.Errorf("empty")
 	}
@@ -26,7 +45,17 @@ func (q *customerQueue) Dequeue() (domain.Job, error) {
 func (q *customerQueue) Len() int {
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	return len(q.jobs)
+	return len(q.jobs) + len(q.delayed)
+}
+
+func (q *customerQueue) Ready() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs) > 0 || q.dueLocked(time.Now())
+}
+
+func (q *customerQueue) dueLocked(now time.Time) bool {
+	return len(q.delayed) > 0 && !q.delayed[0].NotBefore.After(now)
 }
 
 func (q *customerQueue) IsEmpty() bool {
@@ -2,6 +2,7 @@ package queue
 
 import (
 	"arvan/message-gateway/internal/domain"
+	"time"
 )
 
 func (qm *QueueManager) Enqueue(customerID int, job domain.Job) error {
@@ -16,7 +17,10 @@ func (qm *QueueManager) Enqueue(customerID int, job domain.Job) error {
 	if !qm.activeSet[customerID] {
 		qm.activeList = append(qm.activeList, customerID)
 		qm.activeSet[customerID] = true
+		qm.states[customerID] = &customerState{lastServed: time.Now()}
 	}
+	// a customer is scheduled with the priority of its most recent job
+	qm.states[customerID].priority = job.Priority
 	qm.activeMu.Unlock()
 
 	select {
@@ -54,6 +58,22 @@ func (qm *QueueManager) Len(customerID int) int {
 	return q.Len()
 }
 
+// ready reports whether the customer has a job that is not delayed
+func (qm *QueueManager) ready(customerID int) bool {
+	value, ok := qm.queues.Load(customerID)
+	if !ok {
+		return false
+	}
+	return value.(domain.CustomerQueue).Ready()
+}
+
+// SelectNextCustomer picks the next customer to serve using deficit round robin.
+// Every time the cursor reaches a customer it is granted a quantum equal to the
+// weight of its priority, and it keeps being selected until the quantum is spent.
+// The weight also caps how many of the customer's jobs may be in flight at once,
+// so higher plans get proportionally more worker slots. Customers that have not
+// been served for longer than the aging threshold are selected out of turn.
+// Customers whose jobs are all delayed are skipped until one is due.
 func (qm *QueueManager) SelectNextCustomer() (int, bool) {
 	qm.activeMu.Lock()
 	defer qm.activeMu.Unlock()
@@ -62,24 +82,19 @@ func (qm *QueueManager) SelectNextCustomer() (int, bool) {
 		return 0, false
 	}
 
+	now := time.Now()
+	if cust, ok := qm.selectStarved(now); ok {
+		return cust, true
+	}
+
 	maximum := len(qm.activeList)
 	attempts := 0
 
-	for attempts < maximum {
+	for attempts < maximum && len(qm.activeList) > 0 {
 		if qm.roundRobinIdx >= len(qm.activeList) {
 			qm.roundRobinIdx = 0
 		}
 		cust := qm.activeList[qm.roundRobinIdx]
-		qm.roundRobinIdx++
-
-		qm.lockedMu.Lock()
-		locked := qm.locked[cust]
-		qm.lockedMu.Unlock()
-
-		if locked {
-			attempts++
-			continue
-		}
 
 		// check if queue still has jobs (avoid empty queues)
 		if qm.Len(cust) == 0 {
@@ -87,22 +102,106 @@ func (qm *QueueManager) SelectNextCustomer() (int, bool) {
 			continue
 		}
 
-		qm.lockedMu.Lock()
-		qm.locked[cust] = true
-		qm.lockedMu.Unlock()
+		state := qm.states[cust]
+		if !qm.ready(cust) || !qm.acquire(cust, state) {
+			// every job of this customer is delayed or all of its slots are
+			// busy, keep its deficit for the next round
+			qm.roundRobinIdx++
+			attempts++
+			continue
+		}
+
+		if state.deficit <= 0 {
+			state.deficit = qm.weight(state.priority)
+		}
+		state.deficit--
+		if state.deficit == 0 {
+			qm.roundRobinIdx++
+		}
 
+		qm.markServed(state, now)
 		return cust, true
 	}
 
 	return 0, false
 }
 
+// UnlockCustomer releases one of the in-flight slots taken by SelectNextCustomer.
 func (qm *QueueManager) UnlockCustomer(customerID int) {
 	qm.lockedMu.Lock()
-	delete(qm.locked, customerID)
+	if qm.inFlight[customerID] <= 1 {
+		delete(qm.inFlight, customerID)
+	} else {
+		qm.inFlight[customerID]--
+	}
 	qm.lockedMu.Unlock()
 }
 
+// selectStarved serves customers whose last service is older than the aging
+// threshold. Active customers are scanned at most twice per threshold and the
+// starved ones are kept in a list that is drained before the regular round.
+func (qm *QueueManager) selectStarved(now time.Time) (int, bool) {
+	if qm.agingThreshold <= 0 {
+		return 0, false
+	}
+
+	if now.Sub(qm.lastAgingScan) >= qm.agingThreshold/2 {
+		qm.lastAgingScan = now
+		for _, cust := range qm.activeList {
+			state := qm.states[cust]
+			if !state.promoted && now.Sub(state.lastServed) >= qm.agingThreshold {
+				state.promoted = true
+				qm.starved = append(qm.starved, cust)
+			}
+		}
+	}
+
+	for i := 0; i < len(qm.starved); i++ {
+		cust := qm.starved[i]
+		state, ok := qm.states[cust]
+		if !ok || !state.promoted {
+			// customer went idle or was served in turn since it was promoted
+			qm.starved = append(qm.starved[:i], qm.starved[i+1:]...)
+			i--
+			continue
+		}
+
+		if !qm.ready(cust) || !qm.acquire(cust, state) {
+			continue
+		}
+
+		qm.starved = append(qm.starved[:i], qm.starved[i+1:]...)
+		qm.markServed(state, now)
+		return cust, true
+	}
+
+	return 0, false
+}
+
+func (qm *QueueManager) acquire(customerID int, state *customerState) bool {
+	qm.lockedMu.Lock()
+	defer qm.lockedMu.Unlock()
+
+	if qm.inFlight[customerID] >= qm.weight(state.priority) {
+		return false
+	}
+	qm.inFlight[customerID]++
+	return true
+}
+
+func (qm *QueueManager) markServed(state *customerState, now time.Time) {
+	state.lastServed = now
+	state.promoted = false
+}
+
+func (qm *QueueManager) weight(priority int) int {
+	w, ok := qm.weights[priority]
+	if !ok || w < 1 {
+		return 1
+	}
+	return w
+}
+
 func (qm *QueueManager) removeFromActive(customerID int) {
 	qm.activeMu.Lock()
 	defer qm.activeMu.Unlock()
@@ -120,6 +219,7 @@ func (qm *QueueManager) removeFromActiveUnlocked(customerID int) {
 		}
 	}
 	delete(qm.activeSet, customerID)
+	delete(qm.states, customerID)
 	if qm.roundRobinIdx >= len(qm.activeList) && len(qm.activeList) > 0 {
 		qm.roundRobinIdx = 0
 	}
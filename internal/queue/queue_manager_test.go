@@ -0,0 +1,299 @@
+package queue
+
+import (
+	"arvan/message-gateway/internal/config"
+	"arvan/message-gateway/internal/domain"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var testWeights = map[int]int{
+	1: 1,
+	2: 2,
+	3: 4,
+}
+
+// fill enqueues n jobs of the given priority for the customer.
+func fill(t *testing.T, qm domain.QueueManager, customerID, priority, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		job := domain.Job{ID: strconv.Itoa(customerID) + "-" + strconv.Itoa(i), CustomerID: customerID, Priority: priority}
+		if err := qm.Enqueue(customerID, job); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+}
+
+// serve selects a customer, takes one of its jobs and releases its slot the
+// way a worker does.
+func serve(t *testing.T, qm domain.QueueManager) (int, bool) {
+	t.Helper()
+
+	customerID, ok := qm.SelectNextCustomer()
+	if !ok {
+		return 0, false
+	}
+	if _, err := qm.Dequeue(customerID); err != nil {
+		t.Fatalf("Dequeue(%d): %v", customerID, err)
+	}
+	qm.UnlockCustomer(customerID)
+	return customerID, true
+}
+
+func TestSelectNextCustomerWeights(t *testing.T) {
+	tests := []struct {
+		name string
+		// priorities of the customers 1, 2, ...
+		priorities []int
+		selections int
+		want       map[int]int
+	}{
+		{
+			name:       "same plan",
+			priorities: []int{1, 1},
+			selections: 20,
+			want:       map[int]int{1: 10, 2: 10},
+		},
+		{
+			name:       "free and pro",
+			priorities: []int{1, 2},
+			selections: 30,
+			want:       map[int]int{1: 10, 2: 20},
+		},
+		{
+			name:       "every plan",
+			priorities: []int{1, 2, 3},
+			selections: 70,
+			want:       map[int]int{1: 10, 2: 20, 3: 40},
+		},
+		{
+			name:       "unknown priority weighs one",
+			priorities: []int{9, 3},
+			selections: 50,
+			want:       map[int]int{1: 10, 2: 40},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qm := NewQueueManager(config.Scheduler{Weights: testWeights})
+			for i, priority := range tt.priorities {
+				fill(t, qm, i+1, priority, tt.selections)
+			}
+
+			got := make(map[int]int)
+			for i := 0; i < tt.selections; i++ {
+				customerID, ok := serve(t, qm)
+				if !ok {
+					t.Fatalf("selection %d found no customer", i)
+				}
+				got[customerID]++
+			}
+
+			for customerID, want := range tt.want {
+				if got[customerID] != want {
+					t.Fatalf("served = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectNextCustomerInFlightCap(t *testing.T) {
+	tests := []struct {
+		name     string
+		priority int
+		want     int
+	}{
+		{name: "free", priority: 1, want: 1},
+		{name: "pro", priority: 2, want: 2},
+		{name: "enterprise", priority: 3, want: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qm := NewQueueManager(config.Scheduler{Weights: testWeights})
+			fill(t, qm, 1, tt.priority, 10)
+
+			// slots are only given back by UnlockCustomer
+			for i := 0; i < tt.want; i++ {
+				if _, ok := qm.SelectNextCustomer(); !ok {
+					t.Fatalf("selection %d found no customer, want %d slots", i, tt.want)
+				}
+			}
+			if _, ok := qm.SelectNextCustomer(); ok {
+				t.Fatalf("customer got more than %d slots", tt.want)
+			}
+
+			qm.UnlockCustomer(1)
+			if customerID, ok := qm.SelectNextCustomer(); !ok || customerID != 1 {
+				t.Fatalf("SelectNextCustomer after unlock = (%d, %v), want (1, true)", customerID, ok)
+			}
+		})
+	}
+}
+
+func TestSelectNextCustomerAging(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		wantAged  bool
+	}{
+		{name: "starved customer is served out of turn", threshold: 20 * time.Millisecond, wantAged: true},
+		{name: "aging disabled", threshold: 0, wantAged: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the enterprise customer 1 has a quantum of 100 selections, the free
+			// customer 2 only gets its turn after it without aging
+			qm := NewQueueManager(config.Scheduler{
+				Weights:        map[int]int{1: 1, 3: 100},
+				AgingThreshold: tt.threshold,
+			})
+			fill(t, qm, 1, 3, 200)
+			fill(t, qm, 2, 1, 10)
+
+			if customerID, _ := serve(t, qm); customerID != 1 {
+				t.Fatalf("first selection = %d, want 1", customerID)
+			}
+			time.Sleep(2 * tt.threshold)
+
+			aged := false
+			for i := 0; i < 3; i++ {
+				if customerID, _ := serve(t, qm); customerID == 2 {
+					aged = true
+				}
+			}
+			if aged != tt.wantAged {
+				t.Fatalf("customer 2 served out of turn = %v, want %v", aged, tt.wantAged)
+			}
+		})
+	}
+}
+
+func TestSelectNextCustomerDrainsQueues(t *testing.T) {
+	qm := NewQueueManager(config.Scheduler{Weights: testWeights})
+	fill(t, qm, 1, 1, 3)
+	fill(t, qm, 2, 3, 5)
+
+	served := 0
+	for {
+		if _, ok := serve(t, qm); !ok {
+			break
+		}
+		served++
+	}
+
+	if served != 8 {
+		t.Fatalf("served %d jobs, want 8", served)
+	}
+	if qm.Len(1) != 0 || qm.Len(2) != 0 {
+		t.Fatalf("jobs left: %d and %d", qm.Len(1), qm.Len(2))
+	}
+}
+
+func TestSelectNextCustomerDelayedJobs(t *testing.T) {
+	tests := []struct {
+		name string
+		// delays of the jobs of customer 1, in enqueue order
+		delays []time.Duration
+		// wantReady is whether customer 1 is selected before any delay ends
+		wantReady bool
+		// wantOrder are the ids of customer 1's jobs in the order they are
+		// served once every delay ended
+		wantOrder []string
+	}{
+		{
+			name:      "only delayed jobs",
+			delays:    []time.Duration{30 * time.Millisecond},
+			wantReady: false,
+			wantOrder: []string{"0"},
+		},
+		{
+			name:      "due delayed job goes before waiting ones",
+			delays:    []time.Duration{0, 30 * time.Millisecond, 0},
+			wantReady: true,
+			wantOrder: []string{"0", "1", "2"},
+		},
+		{
+			name:      "delayed jobs come out by their time",
+			delays:    []time.Duration{40 * time.Millisecond, 20 * time.Millisecond},
+			wantReady: false,
+			wantOrder: []string{"1", "0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qm := NewQueueManager(config.Scheduler{Weights: testWeights})
+			now := time.Now()
+			for i, delay := range tt.delays {
+				job := domain.Job{ID: strconv.Itoa(i), CustomerID: 1, Priority: 3}
+				if delay > 0 {
+					job.NotBefore = now.Add(delay)
+				}
+				if err := qm.Enqueue(1, job); err != nil {
+					t.Fatalf("Enqueue: %v", err)
+				}
+			}
+			if qm.Len(1) != len(tt.delays) {
+				t.Fatalf("Len = %d, want %d, delayed jobs count", qm.Len(1), len(tt.delays))
+			}
+
+			var order []string
+			if customerID, ok := qm.SelectNextCustomer(); ok != tt.wantReady {
+				t.Fatalf("SelectNextCustomer before the delays = (%d, %v), want ready %v", customerID, ok, tt.wantReady)
+			} else if ok {
+				job, err := qm.Dequeue(customerID)
+				if err != nil {
+					t.Fatalf("Dequeue: %v", err)
+				}
+				qm.UnlockCustomer(customerID)
+				order = append(order, job.ID)
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			for {
+				customerID, ok := qm.SelectNextCustomer()
+				if !ok {
+					break
+				}
+				job, err := qm.Dequeue(customerID)
+				if err != nil {
+					t.Fatalf("Dequeue: %v", err)
+				}
+				qm.UnlockCustomer(customerID)
+				order = append(order, job.ID)
+			}
+
+			if len(order) != len(tt.wantOrder) {
+				t.Fatalf("served %v, want %v", order, tt.wantOrder)
+			}
+			for i := range order {
+				if order[i] != tt.wantOrder[i] {
+					t.Fatalf("served %v, want %v", order, tt.wantOrder)
+				}
+			}
+		})
+	}
+}
+
+func TestDelayedCustomerDoesNotBlockOthers(t *testing.T) {
+	qm := NewQueueManager(config.Scheduler{Weights: testWeights})
+	if err := qm.Enqueue(1, domain.Job{ID: "late", CustomerID: 1, Priority: 3, NotBefore: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	fill(t, qm, 2, 1, 3)
+
+	for i := 0; i < 3; i++ {
+		if customerID, ok := serve(t, qm); !ok || customerID != 2 {
+			t.Fatalf("selection %d = (%d, %v), want (2, true)", i, customerID, ok)
+		}
+	}
+	if _, ok := qm.SelectNextCustomer(); ok {
+		t.Fatal("a customer with only a delayed job was selected")
+	}
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"arvan/message-gateway/internal/repository/entity"
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewApiKeyRepository(db *gorm.DB) *apiKeyRepository {
+	return &apiKeyRepository{
+		db: db,
+	}
+}
+
+// withPlan selects the keys with the priority of their plan.
+func withPlan(ctx context.Context, db *gorm.DB) *gorm.DB {
+	return db.WithContext(ctx).
+		Model(&entity.ApiKey{}).
+		Select("api_keys.*, plans.priority").
+		Joins("JOIN plans ON plans.id = api_keys.plan_id")
+}
+
+func getApiKey(ctx context.Context, db *gorm.DB, query string, args ...interface{}) (domain.ApiKey, error) {
+	var row entity.ApiKey
+	err := withPlan(ctx, db).Where(query, args...).Take(&row).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.ApiKey{}, constant.ApiKeyNotFoundErr
+		}
+		return domain.ApiKey{}, errors.Wrap(err, "failed to get api key")
+	}
+
+	return row.ToDomain(), nil
+}
+
+// GetApiKeyByKeyId finds a key that is not revoked.
+func (ar *apiKeyRepository) GetApiKeyByKeyId(ctx context.Context, keyId string) (domain.ApiKey, error) {
+	return getApiKey(ctx, ar.db, "api_keys.key_id = ? AND api_keys.revoked_at IS NULL", keyId)
+}
+
+// ListApiKeys returns the keys of the customer newest first, revoked ones too.
+func (ar *apiKeyRepository) ListApiKeys(ctx context.Context, customerId int) ([]domain.ApiKey, error) {
+	var rows []entity.ApiKey
+	err := withPlan(ctx, ar.db).
+		Where("api_keys.customer_id = ?", customerId).
+		Order("api_keys.created_at DESC, api_keys.id DESC").
+		Find(&rows).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list api keys")
+	}
+
+	keys := make([]domain.ApiKey, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, row.ToDomain())
+	}
+
+	return keys, nil
+}
+
+func (ar *apiKeyRepository) CreateApiKey(ctx context.Context, key domain.ApiKey) (domain.ApiKey, error) {
+	row := entity.NewApiKey(key)
+	if err := ar.db.WithContext(ctx).Create(&row).Error; err != nil {
+		return domain.ApiKey{}, errors.Wrap(err, "failed to create api key")
+	}
+
+	return getApiKey(ctx, ar.db, "api_keys.id = ?", row.ID)
+}
+
+func (ar *apiKeyRepository) UpdateApiKeyLabel(ctx context.Context, customerId int, keyId, label string) (domain.ApiKey, error) {
+	result := ar.db.WithContext(ctx).
+		Model(&entity.ApiKey{}).
+		Where("customer_id = ? AND key_id = ?", customerId, keyId).
+		Updates(map[string]interface{}{"label": label, "updated_at": time.Now().UTC()})
+	if result.Error != nil {
+		return domain.ApiKey{}, errors.Wrap(result.Error, "failed to label api key")
+	}
+	if result.RowsAffected == 0 {
+		return domain.ApiKey{}, constant.ApiKeyNotFoundErr
+	}
+
+	return getApiKey(ctx, ar.db, "api_keys.key_id = ?", keyId)
+}
+
+// RevokeApiKey revokes a key of the customer, revoking it again keeps the
+// first revocation time.
+func (ar *apiKeyRepository) RevokeApiKey(ctx context.Context, customerId int, keyId string) (domain.ApiKey, error) {
+	now := time.Now().UTC()
+	result := ar.db.WithContext(ctx).
+		Model(&entity.ApiKey{}).
+		Where("customer_id = ? AND key_id = ?", customerId, keyId).
+		Updates(map[string]interface{}{
+			"revoked_at": gorm.Expr("COALESCE(revoked_at, ?)", now),
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return domain.ApiKey{}, errors.Wrap(result.Error, "failed to revoke api key")
+	}
+	if result.RowsAffected == 0 {
+		return domain.ApiKey{}, constant.ApiKeyNotFoundErr
+	}
+
+	return getApiKey(ctx, ar.db, "api_keys.key_id = ?", keyId)
+}
+
+// RotateApiKey revokes an active key of the customer and stores next with the
+// plan and label of the revoked key in one transaction.
+func (ar *apiKeyRepository) RotateApiKey(ctx context.Context, customerId int, keyId string, next domain.ApiKey) (domain.ApiKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, constant.DBTxTimeout)
+	defer cancel()
+
+	var rotated domain.ApiKey
+	err := ar.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var old entity.ApiKey
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("customer_id = ? AND key_id = ? AND revoked_at IS NULL", customerId, keyId).
+			Take(&old).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return constant.ApiKeyNotFoundErr
+			}
+			return errors.Wrap(err, "failed to lock api key")
+		}
+
+		now := time.Now().UTC()
+		if err := tx.Model(&old).Updates(map[string]interface{}{"revoked_at": now, "updated_at": now}).Error; err != nil {
+			return errors.Wrap(err, "failed to revoke api key")
+		}
+
+		next.CustomerID = old.CustomerID
+		next.PlanID = old.PlanID
+		next.Label = old.Label
+		row := entity.NewApiKey(next)
+		if err := tx.Create(&row).Error; err != nil {
+			return errors.Wrap(err, "failed to create api key")
+		}
+
+		rotated, err = getApiKey(ctx, tx, "api_keys.id = ?", row.ID)
+		return err
+	})
+	if err != nil {
+		return domain.ApiKey{}, err
+	}
+
+	return rotated, nil
+}
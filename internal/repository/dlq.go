@@ -1,11 +1,16 @@
 package repository
 
 import (
+	"arvan/message-gateway/internal/constant"
 	"arvan/message-gateway/internal/domain"
 	"arvan/message-gateway/internal/repository/entity"
 	"context"
-	"gorm.io/gorm"
+	"database/sql"
+	"sort"
 	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
 )
 
 type dlqRepository struct {
@@ -22,11 +27,112 @@ func (dr *dlqRepository) InsertDLQ(ctx context.Context, km domain.KafkaMessage)
 	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 
+	now := time.Now()
 	return gorm.G[entity.KafkaDlq](dr.db).Create(ctx, &entity.KafkaDlq{
 		Topic:         km.Topic,
 		Key:           km.Key,
 		Payload:       km.Payload,
 		AttemptCount:  km.Attempts,
-		LastAttemptAt: time.Now(),
+		CreatedAt:     now,
+		LastAttemptAt: &now,
 	})
 }
+
+func (dr *dlqRepository) ListDLQ(ctx context.Context, limit int) ([]domain.DlqMessage, error) {
+	rows, err := gorm.G[entity.KafkaDlq](dr.db).
+		Order("id ASC").
+		Limit(limit).
+		Find(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list dlq")
+	}
+
+	messages := make([]domain.DlqMessage, 0, len(rows))
+	for _, row := range rows {
+		messages = append(messages, row.ToDomain())
+	}
+
+	return messages, nil
+}
+
+// ClaimDLQ leases up to limit rows that are due for another attempt and passes
+// each to handle. The lease is taken in a short transaction and handle runs
+// outside of it, so a slow broker holds neither a connection nor row locks.
+// Rows handled successfully are deleted, the others get their attempt counted
+// and their lease released. A row is due once attempt_count is below
+// maxAttempts and backoff * 2^attempt_count has passed since its last attempt,
+// force ignores the backoff. Rows leased by another replica are skipped until
+// their lease expires.
+func (dr *dlqRepository) ClaimDLQ(
+	ctx context.Context,
+	limit, maxAttempts int,
+	backoff time.Duration,
+	force bool,
+	handle func(ctx context.Context, msg domain.DlqMessage) error,
+) (int, int, error) {
+	due := "TRUE"
+	if !force {
+		due = "last_attempt_at IS NULL OR last_attempt_at + make_interval(secs => @backoff * power(2, attempt_count)) <= now()"
+	}
+
+	var rows []entity.KafkaDlq
+	if err := dr.db.WithContext(ctx).Raw(`
+		UPDATE kafka_dlq SET claimed_until = now() + make_interval(secs => @lease)
+		WHERE id IN (
+			SELECT id FROM kafka_dlq
+			WHERE attempt_count < @max_attempts
+			  AND (claimed_until IS NULL OR claimed_until < now())
+			  AND (`+due+`)
+			ORDER BY id
+			LIMIT @limit
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		sql.Named("lease", constant.DlqClaimLease.Seconds()),
+		sql.Named("max_attempts", maxAttempts),
+		sql.Named("backoff", backoff.Seconds()),
+		sql.Named("limit", limit),
+	).Scan(&rows).Error; err != nil {
+		return 0, 0, errors.Wrap(err, "failed to claim dlq rows")
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+
+	succeeded, failed := 0, 0
+	for _, row := range rows {
+		if err := handle(ctx, row.ToDomain()); err != nil {
+			failed++
+			if err := dr.db.WithContext(ctx).Model(&entity.KafkaDlq{}).
+				Where("id = ?", row.ID).
+				Updates(map[string]interface{}{
+					"attempt_count":   gorm.Expr("attempt_count + 1"),
+					"last_attempt_at": time.Now(),
+					"claimed_until":   nil,
+				}).Error; err != nil {
+				return succeeded, failed, errors.Wrapf(err, "failed to count attempt of dlq row %d", row.ID)
+			}
+			continue
+		}
+
+		succeeded++
+		if err := dr.db.WithContext(ctx).Delete(&entity.KafkaDlq{}, row.ID).Error; err != nil {
+			return succeeded, failed, errors.Wrapf(err, "failed to delete dlq row %d", row.ID)
+		}
+	}
+
+	return succeeded, failed, nil
+}
+
+// PurgeDLQ deletes the rows that reached maxAttempts, or every row when maxAttempts is 0.
+func (dr *dlqRepository) PurgeDLQ(ctx context.Context, maxAttempts int) (int, error) {
+	query := gorm.G[entity.KafkaDlq](dr.db).Where("1 = 1")
+	if maxAttempts > 0 {
+		query = gorm.G[entity.KafkaDlq](dr.db).Where("attempt_count >= ?", maxAttempts)
+	}
+
+	rows, err := query.Delete(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge dlq")
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,52 @@
+package entity
+
+import (
+	"arvan/message-gateway/internal/domain"
+	"time"
+)
+
+type ApiKey struct {
+	ID         int64 `gorm:"primary_key"`
+	CustomerID int
+	PlanID     int64
+	KeyID      string
+	Salt       string
+	KeyHash    string
+	Label      string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	RevokedAt  *time.Time
+	// read from the plan of the key
+	Priority int `gorm:"->"`
+}
+
+func (ApiKey) TableName() string {
+	return "api_keys"
+}
+
+func NewApiKey(key domain.ApiKey) ApiKey {
+	return ApiKey{
+		CustomerID: key.CustomerID,
+		PlanID:     key.PlanID,
+		KeyID:      key.KeyID,
+		Salt:       key.Salt,
+		KeyHash:    key.KeyHash,
+		Label:      key.Label,
+	}
+}
+
+func (k ApiKey) ToDomain() domain.ApiKey {
+	return domain.ApiKey{
+		ID:         k.ID,
+		CustomerID: k.CustomerID,
+		PlanID:     k.PlanID,
+		Priority:   k.Priority,
+		KeyID:      k.KeyID,
+		Salt:       k.Salt,
+		KeyHash:    k.KeyHash,
+		Label:      k.Label,
+		CreatedAt:  k.CreatedAt,
+		UpdatedAt:  k.UpdatedAt,
+		RevokedAt:  k.RevokedAt,
+	}
+}
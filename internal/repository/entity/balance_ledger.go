@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+type BalanceLedger struct {
+	ID         int64 `gorm:"primary_key"`
+	CustomerId int
+	MessageId  string
+	Amount     int64
+	Reason     string
+	CreatedAt  time.Time
+	CreditedAt *time.Time
+}
+
+func (BalanceLedger) TableName() string {
+	return "balance_ledger"
+}
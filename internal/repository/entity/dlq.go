@@ -1,16 +1,35 @@
 package entity
 
-import "time"
+import (
+	"arvan/message-gateway/internal/domain"
+	"time"
+)
 
 type KafkaDlq struct {
+	ID            int64 `gorm:"primary_key"`
 	Topic         string
 	Key           string
 	Payload       []byte
 	AttemptCount  int
-	Priority      int
-	LastAttemptAt time.Time
+	CreatedAt     time.Time
+	LastAttemptAt *time.Time
+	ClaimedUntil  *time.Time
 }
 
 func (KafkaDlq) TableName() string {
 	return "kafka_dlq"
 }
+
+func (k KafkaDlq) ToDomain() domain.DlqMessage {
+	return domain.DlqMessage{
+		ID: k.ID,
+		KafkaMessage: domain.KafkaMessage{
+			Key:      k.Key,
+			Payload:  k.Payload,
+			Topic:    k.Topic,
+			Attempts: k.AttemptCount,
+		},
+		CreatedAt:     k.CreatedAt,
+		LastAttemptAt: k.LastAttemptAt,
+	}
+}
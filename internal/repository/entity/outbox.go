@@ -0,0 +1,42 @@
+package entity
+
+import (
+	"arvan/message-gateway/internal/domain"
+	"time"
+)
+
+type Outbox struct {
+	ID        int64 `gorm:"primary_key"`
+	Topic     string
+	Key       string
+	Payload   []byte
+	CreatedAt time.Time
+	SentAt    *time.Time
+	// another relay skips the row until then
+	ClaimedUntil *time.Time
+}
+
+func (Outbox) TableName() string {
+	return "outbox"
+}
+
+func (o Outbox) ToDomain() domain.OutboxMessage {
+	return domain.OutboxMessage{
+		ID: o.ID,
+		KafkaMessage: domain.KafkaMessage{
+			Key:     o.Key,
+			Payload: o.Payload,
+			Topic:   o.Topic,
+		},
+		CreatedAt: o.CreatedAt,
+	}
+}
+
+func NewOutbox(km domain.KafkaMessage, createdAt time.Time) Outbox {
+	return Outbox{
+		Topic:     km.Topic,
+		Key:       km.Key,
+		Payload:   km.Payload,
+		CreatedAt: createdAt,
+	}
+}
@@ -0,0 +1,49 @@
+package entity
+
+import (
+	"arvan/message-gateway/internal/domain"
+	"time"
+)
+
+type ProviderMessage struct {
+	Provider          string `gorm:"primary_key"`
+	ProviderMessageID string `gorm:"primary_key"`
+	MessageID         string
+	CustomerID        int
+	Phone             string
+	Priority          int
+	CreatedAt         time.Time
+	SentAt            time.Time
+	FinalStatus       *string
+	FinalAt           *time.Time
+}
+
+func (ProviderMessage) TableName() string {
+	return "provider_messages"
+}
+
+func (pm ProviderMessage) ToDomain() domain.ProviderMessage {
+	return domain.ProviderMessage{
+		Provider:          pm.Provider,
+		ProviderMessageID: pm.ProviderMessageID,
+		MessageID:         pm.MessageID,
+		CustomerID:        pm.CustomerID,
+		Phone:             pm.Phone,
+		Priority:          pm.Priority,
+		CreatedAt:         pm.CreatedAt,
+		SentAt:            pm.SentAt,
+	}
+}
+
+func NewProviderMessage(pm domain.ProviderMessage) ProviderMessage {
+	return ProviderMessage{
+		Provider:          pm.Provider,
+		ProviderMessageID: pm.ProviderMessageID,
+		MessageID:         pm.MessageID,
+		CustomerID:        pm.CustomerID,
+		Phone:             pm.Phone,
+		Priority:          pm.Priority,
+		CreatedAt:         pm.CreatedAt,
+		SentAt:            pm.SentAt,
+	}
+}
@@ -26,8 +26,15 @@ type SMSStatusLog struct {
 	Message    string    `gorm:"message"`
 	Status     string    `gorm:"status"`
 	Priority   int       `gorm:"priority"`
+	Provider   string    `gorm:"provider"`
+	ErrorCode  string    `gorm:"error_code"`
+	Reason     string    `gorm:"reason"`
+	Segments   int       `gorm:"segments"`
+	Cost       int64     `gorm:"cost"`
+	Attempt    int       `gorm:"attempt"`
 	CreatedAt  time.Time `gorm:"created_at"`
 	Timestamp  time.Time `gorm:"timestamp"`
+	EventTime  time.Time `gorm:"event_time"`
 }
 
 func (SMSStatusLog) TableName() string {
@@ -41,7 +48,55 @@ func (s SMSStatusLog) ToDomain() domain.SMSStatus {
 		Priority:   s.Priority,
 		Phone:      s.Phone,
 		Message:    s.Message,
-		Status:     s.Status,
+		Status:     domain.ParseStatus(s.Status),
+		Provider:   s.Provider,
+		ErrorCode:  s.ErrorCode,
+		Reason:     s.Reason,
+		Segments:   s.Segments,
+		Cost:       s.Cost,
+		Attempt:    s.Attempt,
 		CreatedAt:  s.CreatedAt,
+		Timestamp:  s.EventTime,
+	}
+}
+
+// SMSLatestStatus is a row of sms_latest_status with its aggregates merged.
+type SMSLatestStatus struct {
+	Id         string
+	CustomerID int
+	Phone      string
+	Message    string
+	Status     string
+	Priority   int
+	Provider   string
+	ErrorCode  string
+	Reason     string
+	Segments   int
+	Cost       int64
+	Attempt    int
+	CreatedAt  time.Time
+	Timestamp  time.Time
+}
+
+func (SMSLatestStatus) TableName() string {
+	return "sms_latest_status"
+}
+
+func (s SMSLatestStatus) ToDomain() domain.SMSStatus {
+	return domain.SMSStatus{
+		ID:         s.Id,
+		CustomerID: s.CustomerID,
+		Priority:   s.Priority,
+		Phone:      s.Phone,
+		Message:    s.Message,
+		Status:     domain.ParseStatus(s.Status),
+		Provider:   s.Provider,
+		ErrorCode:  s.ErrorCode,
+		Reason:     s.Reason,
+		Segments:   s.Segments,
+		Cost:       s.Cost,
+		Attempt:    s.Attempt,
+		CreatedAt:  s.CreatedAt,
+		Timestamp:  s.Timestamp,
 	}
 }
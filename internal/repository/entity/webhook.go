@@ -0,0 +1,84 @@
+package entity
+
+import (
+	"arvan/message-gateway/internal/domain"
+	"time"
+)
+
+type Webhook struct {
+	CustomerId int `gorm:"primary_key"`
+	Url        string
+	Secret     string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+func (w Webhook) ToDomain() domain.Webhook {
+	return domain.Webhook{
+		CustomerId: w.CustomerId,
+		Url:        w.Url,
+		Secret:     w.Secret,
+		CreatedAt:  w.CreatedAt,
+		UpdatedAt:  w.UpdatedAt,
+	}
+}
+
+type WebhookDlq struct {
+	ID           int64 `gorm:"primary_key"`
+	CustomerId   int
+	MessageId    string
+	Url          string
+	Payload      []byte
+	AttemptCount int
+	LastError    string
+	CreatedAt    time.Time
+}
+
+func (WebhookDlq) TableName() string {
+	return "webhook_dlq"
+}
+
+type WebhookRetry struct {
+	ID            int64 `gorm:"primary_key"`
+	CustomerId    int
+	MessageId     string
+	Payload       []byte
+	AttemptCount  int
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	// another dispatcher skips the row until then
+	ClaimedUntil *time.Time
+}
+
+func (WebhookRetry) TableName() string {
+	return "webhook_retries"
+}
+
+func (w WebhookRetry) ToDomain() domain.WebhookRetry {
+	return domain.WebhookRetry{
+		ID:            w.ID,
+		CustomerId:    w.CustomerId,
+		MessageId:     w.MessageId,
+		Payload:       w.Payload,
+		AttemptCount:  w.AttemptCount,
+		LastError:     w.LastError,
+		NextAttemptAt: w.NextAttemptAt,
+	}
+}
+
+func NewWebhookRetry(retry domain.WebhookRetry, createdAt time.Time) WebhookRetry {
+	return WebhookRetry{
+		CustomerId:    retry.CustomerId,
+		MessageId:     retry.MessageId,
+		Payload:       retry.Payload,
+		AttemptCount:  retry.AttemptCount,
+		LastError:     retry.LastError,
+		NextAttemptAt: retry.NextAttemptAt,
+		CreatedAt:     createdAt,
+	}
+}
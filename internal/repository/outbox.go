@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"arvan/message-gateway/internal/repository/entity"
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) *outboxRepository {
+	return &outboxRepository{
+		db: db,
+	}
+}
+
+func (or *outboxRepository) InsertOutbox(ctx context.Context, messages []domain.KafkaMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	rows := make([]entity.Outbox, len(messages))
+	for i, km := range messages {
+		rows[i] = entity.NewOutbox(km, now)
+	}
+
+	return gorm.G[entity.Outbox](or.db).CreateInBatches(ctx, &rows, 500)
+}
+
+// ClaimOutbox leases up to limit unsent rows in id order and passes them to
+// publish. The lease is taken in a short transaction and publish runs outside
+// of it, so a slow broker holds neither a connection nor row locks. The rows
+// are marked as sent only when publish succeeds, otherwise their lease is
+// released and the next claim picks them up again. Rows leased by another
+// relay are skipped until their lease expires. A row is only claimed when no
+// older unsent row of its topic and key is left out of the claim, so the rows
+// of one key are never published by two relays at once or out of order.
+func (or *outboxRepository) ClaimOutbox(
+	ctx context.Context,
+	limit int,
+	publish func(ctx context.Context, messages []domain.OutboxMessage) error,
+) (int, error) {
+	var rows []entity.Outbox
+	if err := or.db.WithContext(ctx).Raw(`
+		WITH candidates AS (
+			SELECT id, topic, key FROM outbox
+			WHERE sent_at IS NULL
+			  AND (claimed_until IS NULL OR claimed_until < now())
+			ORDER BY id
+			LIMIT @limit
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE outbox SET claimed_until = now() + make_interval(secs => @lease)
+		WHERE id IN (
+			SELECT c.id FROM candidates c
+			WHERE NOT EXISTS (
+				SELECT 1 FROM outbox o
+				WHERE o.sent_at IS NULL
+				  AND o.topic = c.topic
+				  AND o.key = c.key
+				  AND o.id < c.id
+				  AND o.id NOT IN (SELECT id FROM candidates)
+			)
+		)
+		RETURNING *`,
+		sql.Named("lease", constant.OutboxClaimLease.Seconds()),
+		sql.Named("limit", limit),
+	).Scan(&rows).Error; err != nil {
+		return 0, errors.Wrap(err, "failed to claim outbox rows")
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+
+	messages := make([]domain.OutboxMessage, len(rows))
+	ids := make([]int64, len(rows))
+	for i, row := range rows {
+		messages[i] = row.ToDomain()
+		ids[i] = row.ID
+	}
+
+	if err := publish(ctx, messages); err != nil {
+		if releaseErr := or.db.WithContext(ctx).Model(&entity.Outbox{}).
+			Where("id IN ?", ids).
+			Update("claimed_until", nil).Error; releaseErr != nil {
+			return 0, errors.Wrapf(err, "failed to release outbox rows: %v", releaseErr)
+		}
+		return 0, err
+	}
+
+	if err := or.db.WithContext(ctx).Model(&entity.Outbox{}).
+		Where("id IN ?", ids).
+		Update("sent_at", time.Now()).Error; err != nil {
+		return 0, errors.Wrap(err, "failed to mark outbox rows as sent")
+	}
+
+	return len(rows), nil
+}
+
+// PurgeSentOutbox deletes the rows that were sent before the given time.
+func (or *outboxRepository) PurgeSentOutbox(ctx context.Context, before time.Time) (int, error) {
+	rows, err := gorm.G[entity.Outbox](or.db).
+		Where("sent_at IS NOT NULL AND sent_at < ?", before).
+		Delete(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge outbox")
+	}
+
+	return rows, nil
+}
@@ -1,10 +1,12 @@
 package repository
 
 import (
+	"arvan/message-gateway/internal/constant"
 	"arvan/message-gateway/internal/domain"
 	"arvan/message-gateway/internal/repository/entity"
 	"context"
 
+	"github.com/pkg/errors"
 	"gorm.io/gorm"
 )
 
@@ -32,3 +34,29 @@ func (pr *PlanRepository) GetAllPlans(ctx context.Context) ([]domain.Plan, error
 
 	return plans, nil
 }
+
+func (pr *PlanRepository) GetPlanByName(ctx context.Context, name string) (domain.Plan, error) {
+	plan, err := gorm.G[entity.Plan](pr.db).Where("name = ?", name).First(ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Plan{}, constant.PlanNotFoundErr
+		}
+		return domain.Plan{}, errors.Wrap(err, "failed to get plan")
+	}
+
+	return plan.ToDomain(), nil
+}
+
+// GetPlanByApiKey finds a plan by the api key it had before keys belonged to
+// customers.
+func (pr *PlanRepository) GetPlanByApiKey(ctx context.Context, apiKey string) (domain.Plan, error) {
+	plan, err := gorm.G[entity.Plan](pr.db).Where("api_key = ?", apiKey).First(ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Plan{}, constant.PlanNotFoundErr
+		}
+		return domain.Plan{}, errors.Wrap(err, "failed to get plan")
+	}
+
+	return plan.ToDomain(), nil
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"arvan/message-gateway/internal/domain"
+	"arvan/message-gateway/internal/repository/entity"
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type providerMessageRepository struct {
+	db *gorm.DB
+}
+
+func NewProviderMessageRepository(db *gorm.DB) *providerMessageRepository {
+	return &providerMessageRepository{
+		db: db,
+	}
+}
+
+// InsertProviderMessage keeps the first mapping of a provider message id, a
+// provider that reuses ids does not point receipts to another message.
+func (pr *providerMessageRepository) InsertProviderMessage(ctx context.Context, message domain.ProviderMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	row := entity.NewProviderMessage(message)
+	err := pr.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to insert provider message")
+	}
+
+	return nil
+}
+
+func (pr *providerMessageRepository) GetProviderMessage(ctx context.Context, provider, providerMessageId string) (domain.ProviderMessage, error) {
+	row, err := gorm.G[entity.ProviderMessage](pr.db).
+		Where("provider = ? AND provider_message_id = ?", provider, providerMessageId).
+		First(ctx)
+	if err != nil {
+		return domain.ProviderMessage{}, err
+	}
+
+	return row.ToDomain(), nil
+}
+
+// FinishProviderMessage records the final status of a message and reports
+// whether it was the first one. The mapping is written again when it is
+// missing, e.g. when its insert failed after the send.
+func (pr *providerMessageRepository) FinishProviderMessage(ctx context.Context, message domain.ProviderMessage, status domain.Status) (bool, error) {
+	now := time.Now()
+	row := entity.NewProviderMessage(message)
+	finalStatus := string(status)
+	row.FinalStatus = &finalStatus
+	row.FinalAt = &now
+
+	result := pr.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "provider"}, {Name: "provider_message_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"final_status", "final_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "provider_messages.final_status IS NULL"},
+		}},
+	}).Create(&row)
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "failed to finish provider message")
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// ReopenProviderMessage clears the final status, the next receipt of the
+// message is handled again.
+func (pr *providerMessageRepository) ReopenProviderMessage(ctx context.Context, message domain.ProviderMessage) error {
+	err := pr.db.WithContext(ctx).Model(&entity.ProviderMessage{}).
+		Where("provider = ? AND provider_message_id = ?", message.Provider, message.ProviderMessageID).
+		Updates(map[string]interface{}{"final_status": nil, "final_at": nil}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to reopen provider message")
+	}
+
+	return nil
+}
+
+// PurgeProviderMessages deletes the mappings of the messages sent before the
+// given time.
+func (pr *providerMessageRepository) PurgeProviderMessages(ctx context.Context, before time.Time) (int, error) {
+	rows, err := gorm.G[entity.ProviderMessage](pr.db).
+		Where("sent_at < ?", before).
+		Delete(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge provider messages")
+	}
+
+	return rows, nil
+}
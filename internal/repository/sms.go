@@ -5,11 +5,12 @@ import (
 	"arvan/message-gateway/internal/domain"
 	"arvan/message-gateway/internal/repository/entity"
 	"context"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
-	"time"
+	"strings"
 )
 
 type smsRepository struct {
@@ -72,58 +73,220 @@ func (sr *smsRepository) DeductBalanceAndSaveSms(ctx context.Context, customerId
 	return msgId, nil
 }
 
-func (sr *smsRepository) InsertSMSStatus(ctx context.Context, jobID string, customerID int, phone, message, status string, priority int, createdAt time.Time, timestamp time.Time) error {
-	err := gorm.G[entity.SMSStatusLog](sr.clickhouse).Create(ctx, &entity.SMSStatusLog{
-		CustomerID: customerID,
-		Id:         jobID,
-		Phone:      phone,
-		Message:    message,
-		Status:     status,
-		Priority:   priority,
-		CreatedAt:  createdAt,
-		Timestamp:  timestamp,
-	})
+// InsertSMSStatuses writes the events in a single native insert, clickhouse
+// gets them as one block.
+func (sr *smsRepository) InsertSMSStatuses(ctx context.Context, events []domain.StatusEvent) error {
+	db, err := sr.clickhouse.DB()
+	if err != nil {
+		return errors.Wrap(err, "failed to get clickhouse connection")
+	}
 
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return errors.Wrap(err, "failed to insert SMS status")
+		return errors.Wrap(err, "failed to begin sms status batch")
 	}
+	defer tx.Rollback()
 
-	return nil
-}
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (id, customer_id, phone, message, status, priority, provider, error_code, reason, segments, cost, attempt, created_at, timestamp, event_time)",
+		entity.SMSStatusLog{}.TableName(),
+	))
+	if err != nil {
+		return errors.Wrap(err, "failed to prepare sms status batch")
+	}
+	defer stmt.Close()
 
-func (sr *smsRepository) GetAllSmsLog(ctx context.Context, customerId, limit, offset int) ([]domain.SMSStatus, int64, error) {
-	total, err := gorm.G[entity.SMSStatusLog](sr.clickhouse).
-		Where("customer_id = ?", customerId).
-		Count(ctx, "id")
+	for _, event := range events {
+		_, err := stmt.ExecContext(ctx,
+			event.ID,
+			int32(event.CustomerID),
+			event.Phone,
+			event.Message,
+			string(event.Status),
+			int32(event.Priority),
+			event.Provider,
+			event.ErrorCode,
+			event.Reason,
+			uint16(event.Segments),
+			event.Cost,
+			uint16(event.Attempts),
+			event.CreatedAt,
+			event.Timestamp,
+			event.Timestamp,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to append sms status")
+		}
+	}
 
-	if err != nil {
-		return nil, 0, errors.Wrap(err, "failed to get all sms logs")
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to insert sms statuses")
 	}
 
+	return nil
+}
+
+// GetLatestStatus returns the last logged status of a message, or an empty
+// status when nothing is logged for it.
+func (sr *smsRepository) GetLatestStatus(ctx context.Context, messageId string) (domain.Status, error) {
 	logs, err := gorm.G[entity.SMSStatusLog](sr.clickhouse).
-		Where("customer_id = ?", customerId).
-		Order("created_at DESC").
-		Limit(limit).
-		Offset(offset).
+		Where("id = ?", messageId).
+		Order("event_time DESC").
+		Limit(1).
 		Find(ctx)
 	if err != nil {
-		return nil, 0, errors.Wrap(err, "failed to get all sms logs")
+		return "", errors.Wrap(err, "failed to get latest sms status")
+	}
+	if len(logs) == 0 {
+		return "", nil
 	}
 
-	var smsList []domain.SMSStatus
-	for _, log := range logs {
-		smsList = append(smsList, log.ToDomain())
+	return domain.ParseStatus(logs[0].Status), nil
+}
+
+// latestStatusQuery merges the rows of sms_latest_status that are not merged
+// in the background yet, every message comes back once with its current status.
+// The key conditions go in the inner WHERE, the ones on aggregated columns in
+// the outer one, the caller adds the order.
+const latestStatusQuery = `
+SELECT *
+FROM (
+    SELECT id,
+           customer_id,
+           created_at,
+           any(phone)              AS phone,
+           max(message)            AS message,
+           max(priority)           AS priority,
+           argMaxMerge(status)     AS status,
+           argMaxMerge(error_code) AS error_code,
+           argMaxMerge(reason)     AS reason,
+           max(provider)           AS provider,
+           max(segments)           AS segments,
+           max(cost)               AS cost,
+           max(attempt)            AS attempt,
+           max(timestamp)          AS timestamp
+    FROM sms_latest_status
+    WHERE %s
+    GROUP BY customer_id, created_at, id
+)
+WHERE %s`
+
+// latestStatusFilter builds latestStatusQuery for the messages of the customer
+// that match the filter, Limit is left to the caller.
+func latestStatusFilter(customerId int, filter domain.SmsLogFilter) (string, []interface{}) {
+	keyConds := []string{"customer_id = ?"}
+	keyArgs := []interface{}{customerId}
+	if !filter.From.IsZero() {
+		keyConds = append(keyConds, "created_at >= ?")
+		keyArgs = append(keyArgs, filter.From)
+	}
+	if !filter.To.IsZero() {
+		keyConds = append(keyConds, "created_at < ?")
+		keyArgs = append(keyArgs, filter.To)
+	}
+	if filter.After != nil {
+		keyConds = append(keyConds, "(created_at, id) < (?, ?)")
+		keyArgs = append(keyArgs, filter.After.CreatedAt, filter.After.ID)
 	}
 
-	return smsList, total, nil
+	conds := []string{"1"}
+	var args []interface{}
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = string(status)
+		}
+		conds = append(conds, "status IN ?")
+		args = append(args, statuses)
+	}
+	if filter.Phone != "" {
+		conds = append(conds, "phone = ?")
+		args = append(args, filter.Phone)
+	}
+	if filter.Priority != 0 {
+		conds = append(conds, "priority = ?")
+		args = append(args, filter.Priority)
+	}
+	if filter.Text != "" {
+		conds = append(conds, "positionCaseInsensitiveUTF8(message, ?) > 0")
+		args = append(args, filter.Text)
+	}
+
+	query := fmt.Sprintf(latestStatusQuery, strings.Join(keyConds, " AND "), strings.Join(conds, " AND "))
+	return query, append(keyArgs, args...)
+}
+
+// GetAllSmsLog lists the messages of the customer that match the filter with
+// their current status, newest first. It returns the cursor of the last
+// message when there are more.
+func (sr *smsRepository) GetAllSmsLog(ctx context.Context, customerId int, filter domain.SmsLogFilter) ([]domain.SMSStatus, *domain.SmsLogCursor, error) {
+	query, args := latestStatusFilter(customerId, filter)
+	query += "\nORDER BY created_at DESC, id DESC\nLIMIT ?"
+	// one more row tells whether there is a next page
+	args = append(args, filter.Limit+1)
+
+	var rows []entity.SMSLatestStatus
+	if err := sr.clickhouse.WithContext(ctx).Raw(query, args...).Scan(&rows).Error; err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get all sms logs")
+	}
+
+	var next *domain.SmsLogCursor
+	if len(rows) > filter.Limit {
+		rows = rows[:filter.Limit]
+		last := rows[len(rows)-1]
+		next = &domain.SmsLogCursor{CreatedAt: last.CreatedAt, ID: last.Id}
+	}
+
+	smsList := make([]domain.SMSStatus, 0, len(rows))
+	for _, row := range rows {
+		smsList = append(smsList, row.ToDomain())
+	}
+
+	return smsList, next, nil
 }
-func (sr *smsRepository) ViewSmsTimeLine(ctx context.Context, messageId string) ([]domain.SMSStatus, error) {
+
+// StreamSmsLog passes the messages of the customer that match the filter to
+// each in the order they were accepted, row by row as clickhouse sends them,
+// so exports of any size are never held in memory. Limit and After are
+// ignored, an error from each stops the stream and is returned as is.
+func (sr *smsRepository) StreamSmsLog(ctx context.Context, customerId int, filter domain.SmsLogFilter, each func(domain.SMSStatus) error) error {
+	filter.After = nil
+	query, args := latestStatusFilter(customerId, filter)
+	query += "\nORDER BY created_at ASC, id ASC"
+
+	db := sr.clickhouse.WithContext(ctx)
+	rows, err := db.Raw(query, args...).Rows()
+	if err != nil {
+		return errors.Wrap(err, "failed to stream sms logs")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row entity.SMSLatestStatus
+		if err := db.ScanRows(rows, &row); err != nil {
+			return errors.Wrap(err, "failed to scan sms log")
+		}
+		if err := each(row.ToDomain()); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrap(rows.Err(), "failed to stream sms logs")
+}
+
+// ViewSmsTimeLine returns every status of the message in order, the lookup by
+// id is served by the sms_status_log_by_id projection. A message of another
+// customer is not found.
+func (sr *smsRepository) ViewSmsTimeLine(ctx context.Context, customerId int, messageId string) ([]domain.SMSStatus, error) {
 	logs, err := gorm.G[entity.SMSStatusLog](sr.clickhouse).
-		Where("id = ?", messageId).
-		Order("created_at DESC").
+		Where("id = ? AND customer_id = ?", messageId, customerId).
+		Order("event_time ASC").
 		Find(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get all sms logs")
+		return nil, errors.Wrap(err, "failed to get sms timeline")
+	}
+	if len(logs) == 0 {
+		return nil, constant.SmsNotFoundErr
 	}
 
 	var smsList []domain.SMSStatus
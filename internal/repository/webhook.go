@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"arvan/message-gateway/internal/repository/entity"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type webhookRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) *webhookRepository {
+	return &webhookRepository{
+		db: db,
+	}
+}
+
+func (wr *webhookRepository) UpsertWebhook(ctx context.Context, customerId int, url, secret string) (domain.Webhook, error) {
+	now := time.Now()
+	webhook := entity.Webhook{
+		CustomerId: customerId,
+		Url:        url,
+		Secret:     secret,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	err := wr.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "customer_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"url", "secret", "updated_at"}),
+	}).Create(&webhook).Error
+	if err != nil {
+		return domain.Webhook{}, errors.Wrap(err, "failed to save webhook")
+	}
+
+	return webhook.ToDomain(), nil
+}
+
+func (wr *webhookRepository) GetWebhook(ctx context.Context, customerId int) (domain.Webhook, error) {
+	webhook, err := gorm.G[entity.Webhook](wr.db).
+		Where("customer_id = ?", customerId).
+		First(ctx)
+	if err != nil {
+		return domain.Webhook{}, err
+	}
+
+	return webhook.ToDomain(), nil
+}
+
+func (wr *webhookRepository) DeleteWebhook(ctx context.Context, customerId int) (int, error) {
+	rows, err := gorm.G[entity.Webhook](wr.db).
+		Where("customer_id = ?", customerId).
+		Delete(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to delete webhook")
+	}
+
+	return rows, nil
+}
+
+func (wr *webhookRepository) InsertWebhookRetry(ctx context.Context, retry domain.WebhookRetry) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	row := entity.NewWebhookRetry(retry, time.Now())
+	if err := gorm.G[entity.WebhookRetry](wr.db).Create(ctx, &row); err != nil {
+		return errors.Wrap(err, "failed to insert webhook retry")
+	}
+
+	return nil
+}
+
+// HasWebhookRetries reports whether an event of the message waits for a retry.
+func (wr *webhookRepository) HasWebhookRetries(ctx context.Context, messageId string) (bool, error) {
+	var exists bool
+	if err := wr.db.WithContext(ctx).Raw(
+		"SELECT EXISTS (SELECT 1 FROM webhook_retries WHERE message_id = ?)", messageId,
+	).Scan(&exists).Error; err != nil {
+		return false, errors.Wrap(err, "failed to check webhook retries")
+	}
+
+	return exists, nil
+}
+
+// ClaimWebhookRetries leases up to limit rows that are due for their next
+// attempt. Only the oldest row of a message is claimed, its later events wait
+// until it is delivered or dead lettered. Rows leased by another dispatcher
+// are skipped until their lease expires.
+func (wr *webhookRepository) ClaimWebhookRetries(ctx context.Context, limit int) ([]domain.WebhookRetry, error) {
+	var rows []entity.WebhookRetry
+	if err := wr.db.WithContext(ctx).Raw(`
+		UPDATE webhook_retries SET claimed_until = now() + make_interval(secs => @lease)
+		WHERE id IN (
+			SELECT r.id FROM webhook_retries r
+			WHERE r.next_attempt_at <= now()
+			  AND (r.claimed_until IS NULL OR r.claimed_until < now())
+			  AND NOT EXISTS (
+				SELECT 1 FROM webhook_retries o
+				WHERE o.message_id = r.message_id AND o.id < r.id
+			  )
+			ORDER BY r.id
+			LIMIT @limit
+			FOR UPDATE OF r SKIP LOCKED
+		)
+		RETURNING *`,
+		sql.Named("lease", constant.WebhookRetryClaimLease.Seconds()),
+		sql.Named("limit", limit),
+	).Scan(&rows).Error; err != nil {
+		return nil, errors.Wrap(err, "failed to claim webhook retries")
+	}
+
+	retries := make([]domain.WebhookRetry, len(rows))
+	for i, row := range rows {
+		retries[i] = row.ToDomain()
+	}
+
+	return retries, nil
+}
+
+// RescheduleWebhookRetry counts a failed attempt of the row and releases its
+// lease until its next attempt.
+func (wr *webhookRepository) RescheduleWebhookRetry(ctx context.Context, retry domain.WebhookRetry) error {
+	err := wr.db.WithContext(ctx).Model(&entity.WebhookRetry{}).
+		Where("id = ?", retry.ID).
+		Updates(map[string]interface{}{
+			"attempt_count":   retry.AttemptCount,
+			"last_error":      retry.LastError,
+			"next_attempt_at": retry.NextAttemptAt,
+			"claimed_until":   nil,
+		}).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to reschedule webhook retry %d", retry.ID)
+	}
+
+	return nil
+}
+
+func (wr *webhookRepository) DeleteWebhookRetry(ctx context.Context, id int64) error {
+	if err := wr.db.WithContext(ctx).Delete(&entity.WebhookRetry{}, id).Error; err != nil {
+		return errors.Wrapf(err, "failed to delete webhook retry %d", id)
+	}
+
+	return nil
+}
+
+// DeadLetterWebhookRetry moves a row that ran out of attempts to webhook_dlq.
+func (wr *webhookRepository) DeadLetterWebhookRetry(ctx context.Context, webhook domain.Webhook, retry domain.WebhookRetry) error {
+	return wr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&entity.WebhookDlq{
+			CustomerId:   retry.CustomerId,
+			MessageId:    retry.MessageId,
+			Url:          webhook.Url,
+			Payload:      retry.Payload,
+			AttemptCount: retry.AttemptCount,
+			LastError:    retry.LastError,
+			CreatedAt:    time.Now(),
+		}).Error; err != nil {
+			return errors.Wrap(err, "failed to insert webhook dlq")
+		}
+
+		if err := tx.Delete(&entity.WebhookRetry{}, retry.ID).Error; err != nil {
+			return errors.Wrapf(err, "failed to delete webhook retry %d", retry.ID)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,152 @@
+package apikey
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// GetApiKey finds an active key by its id.
+func (as *apiKeyService) GetApiKey(ctx context.Context, keyId string) (domain.ApiKey, error) {
+	return as.apiKeyRepository.GetApiKeyByKeyId(ctx, keyId)
+}
+
+// LegacyPlan finds the plan of an api key issued before keys belonged to
+// customers.
+func (as *apiKeyService) LegacyPlan(ctx context.Context, apiKey string) (domain.Plan, error) {
+	return as.planRepository.GetPlanByApiKey(ctx, apiKey)
+}
+
+// PlanId finds the plan a new key is issued for by its name.
+func (as *apiKeyService) PlanId(ctx context.Context, name string) (int64, error) {
+	plan, err := as.planRepository.GetPlanByName(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	return plan.ID, nil
+}
+
+func (as *apiKeyService) List(ctx context.Context, customerId int) ([]domain.ApiKey, error) {
+	return as.apiKeyRepository.ListApiKeys(ctx, customerId)
+}
+
+// Create issues a key for the customer on the plan, the secret is only
+// returned here.
+func (as *apiKeyService) Create(ctx context.Context, customerId int, planId int64, label string) (domain.IssuedApiKey, error) {
+	label, err := validLabel(label)
+	if err != nil {
+		return domain.IssuedApiKey{}, err
+	}
+
+	key, next, err := generate()
+	if err != nil {
+		return domain.IssuedApiKey{}, err
+	}
+	next.CustomerID = customerId
+	next.PlanID = planId
+	next.Label = label
+
+	created, err := as.apiKeyRepository.CreateApiKey(ctx, next)
+	if err != nil {
+		return domain.IssuedApiKey{}, err
+	}
+
+	return domain.IssuedApiKey{ApiKey: created, Key: key}, nil
+}
+
+func (as *apiKeyService) Label(ctx context.Context, customerId int, keyId, label string) (domain.ApiKey, error) {
+	label, err := validLabel(label)
+	if err != nil {
+		return domain.ApiKey{}, err
+	}
+	return as.apiKeyRepository.UpdateApiKeyLabel(ctx, customerId, keyId, label)
+}
+
+// Rotate replaces an active key with a new one on the same plan and label,
+// the old key stops working right away.
+func (as *apiKeyService) Rotate(ctx context.Context, customerId int, keyId string) (domain.IssuedApiKey, error) {
+	key, next, err := generate()
+	if err != nil {
+		return domain.IssuedApiKey{}, err
+	}
+
+	rotated, err := as.apiKeyRepository.RotateApiKey(ctx, customerId, keyId, next)
+	if err != nil {
+		return domain.IssuedApiKey{}, err
+	}
+
+	if err := as.invalidate(ctx, keyId); err != nil {
+		return domain.IssuedApiKey{}, err
+	}
+
+	return domain.IssuedApiKey{ApiKey: rotated, Key: key}, nil
+}
+
+// Revoke stops a key on every server. Revoking a revoked key publishes the
+// invalidation again, so a failed publish is fixed by retrying.
+func (as *apiKeyService) Revoke(ctx context.Context, customerId int, keyId string) (domain.ApiKey, error) {
+	revoked, err := as.apiKeyRepository.RevokeApiKey(ctx, customerId, keyId)
+	if err != nil {
+		return domain.ApiKey{}, err
+	}
+
+	if err := as.invalidate(ctx, keyId); err != nil {
+		return domain.ApiKey{}, err
+	}
+
+	return revoked, nil
+}
+
+// invalidate tells every server to drop the key from its cache.
+func (as *apiKeyService) invalidate(ctx context.Context, keyId string) error {
+	if err := as.redisClient.Publish(ctx, constant.RedisApiKeysChannel, keyId).Err(); err != nil {
+		as.logger.Errorf("failed to publish invalidation of api key %s: %v", keyId, err)
+		return errors.Wrap(err, "failed to invalidate api key")
+	}
+	return nil
+}
+
+// generate makes a new key and the row storing it, only the salted hash of
+// the secret is kept.
+func generate() (string, domain.ApiKey, error) {
+	keyId, err := randomHex(8)
+	if err != nil {
+		return "", domain.ApiKey{}, errors.Wrap(err, "failed to generate api key id")
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", domain.ApiKey{}, errors.Wrap(err, "failed to generate api key secret")
+	}
+	salt, err := randomHex(16)
+	if err != nil {
+		return "", domain.ApiKey{}, errors.Wrap(err, "failed to generate api key salt")
+	}
+
+	return domain.ApiKeyPrefix + keyId + "_" + secret, domain.ApiKey{
+		KeyID:   keyId,
+		Salt:    salt,
+		KeyHash: domain.HashApiKey(salt, secret),
+	}, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func validLabel(label string) (string, error) {
+	label = strings.TrimSpace(label)
+	if utf8.RuneCountInString(label) > constant.MaxApiKeyLabelLength {
+		return "", constant.InvalidApiKeyLabelErr
+	}
+	return label, nil
+}
@@ -0,0 +1,44 @@
+package apikey
+
+import (
+	"arvan/message-gateway/internal/domain"
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+type apiKeyService struct {
+	apiKeyRepository apiKeyRepository
+	planRepository   planRepository
+	redisClient      *redis.Client
+	logger           *logrus.Logger
+}
+
+type apiKeyRepository interface {
+	GetApiKeyByKeyId(ctx context.Context, keyId string) (domain.ApiKey, error)
+	ListApiKeys(ctx context.Context, customerId int) ([]domain.ApiKey, error)
+	CreateApiKey(ctx context.Context, key domain.ApiKey) (domain.ApiKey, error)
+	UpdateApiKeyLabel(ctx context.Context, customerId int, keyId, label string) (domain.ApiKey, error)
+	RevokeApiKey(ctx context.Context, customerId int, keyId string) (domain.ApiKey, error)
+	RotateApiKey(ctx context.Context, customerId int, keyId string, next domain.ApiKey) (domain.ApiKey, error)
+}
+
+type planRepository interface {
+	GetPlanByName(ctx context.Context, name string) (domain.Plan, error)
+	GetPlanByApiKey(ctx context.Context, apiKey string) (domain.Plan, error)
+}
+
+func NewApiKeyService(
+	apiKeyRepository apiKeyRepository,
+	planRepository planRepository,
+	redisClient *redis.Client,
+	logger *logrus.Logger,
+) *apiKeyService {
+	return &apiKeyService{
+		apiKeyRepository: apiKeyRepository,
+		planRepository:   planRepository,
+		redisClient:      redisClient,
+		logger:           logger,
+	}
+}
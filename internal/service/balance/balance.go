@@ -2,6 +2,7 @@ package balance
 
 import (
 	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
 	"arvan/message-gateway/internal/repository/entity"
 	"context"
 	"fmt"
@@ -10,49 +11,220 @@ import (
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func (bs *BalanceService) DeductBalanceAndQueueSms(
-	ctx context.Context,
-	customerId int,
-	message, receiver string,
-) (uuid.UUID, error) {
-	msgId := uuid.New()
-
+// DeductBalanceAndQueueSms charges the customer for one sms and waits until
+// the sms and its outbox messages are committed. It returns the balance left
+// after the deduction, the charge is given back when the sms is not persisted.
+func (bs *BalanceService) DeductBalanceAndQueueSms(ctx context.Context, item domain.QueuedSms) (int64, error) {
+	customerId := item.Sms.CustomerId
 	balanceKey := fmt.Sprintf("%s%d", constant.BalanceKeyPrefix, customerId)
 
-	result, err := bs.deductScript.Run(ctx, bs.redisClient, []string{balanceKey}, 10).Result()
+	result, err := bs.deductScript.Run(ctx, bs.redisClient, []string{balanceKey}, constant.SmsCost).Result()
 	if err != nil {
 		bs.logger.Errorf("redis balance deduction failed for customer %d: %v", customerId, err)
-		return uuid.Nil, errors.Wrap(err, "failed to deduct balance from redis")
+		return 0, errors.Wrap(err, "failed to deduct balance from redis")
 	}
 
 	newBalance, ok := result.(int64)
 	if !ok {
 		bs.logger.Errorf("unexpected redis result type for customer %d: %T", customerId, result)
-		return uuid.Nil, errors.New("unexpected redis result type")
+		return 0, errors.New("unexpected redis result type")
 	}
 
 	if newBalance < 0 {
-		return uuid.Nil, constant.InsufficientBalanceErr
+		return 0, constant.InsufficientBalanceErr
+	}
+
+	if err := bs.persist(ctx, customerId, []domain.QueuedSms{item}); err != nil {
+		return 0, err
+	}
+
+	return newBalance, nil
+}
+
+// DeductBalanceAndQueueBulkSms charges the customer for a batch of sms in one
+// atomic redis call. The batch is paid for as a whole or not at all, a balance
+// that does not cover every item returns InsufficientBalanceErr. The items are
+// persisted in a single transaction before it returns.
+func (bs *BalanceService) DeductBalanceAndQueueBulkSms(
+	ctx context.Context,
+	customerId int,
+	items []domain.QueuedSms,
+) (int64, error) {
+	balanceKey := fmt.Sprintf("%s%d", constant.BalanceKeyPrefix, customerId)
+
+	amounts := make([]interface{}, len(items))
+	for i := range items {
+		amounts[i] = constant.SmsCost
+	}
+
+	newBalance, err := bs.bulkScript.Run(ctx, bs.redisClient, []string{balanceKey}, amounts...).Int64()
+	if err != nil {
+		bs.logger.Errorf("redis bulk balance deduction failed for customer %d: %v", customerId, err)
+		return 0, errors.Wrap(err, "failed to deduct bulk balance from redis")
+	}
+
+	if newBalance < 0 {
+		return 0, constant.InsufficientBalanceErr
+	}
+
+	if err := bs.persist(ctx, customerId, items); err != nil {
+		return 0, err
+	}
+
+	return newBalance, nil
+}
+
+// persist hands the charged items to the batch writers and waits for the
+// commit. When the write fails the charge is given back in redis.
+func (bs *BalanceService) persist(ctx context.Context, customerId int, items []domain.QueuedSms) error {
+	if len(items) == 0 {
+		return nil
 	}
 
 	update := &BalanceUpdate{
-		MsgID:      msgId,
 		CustomerID: customerId,
-		ToNumber:   receiver,
-		Body:       message,
+		Items:      items,
 		Timestamp:  time.Now().UTC(),
+		done:       make(chan error, 1),
 	}
 
 	select {
 	case bs.pendingWrites <- update:
 	default:
-		bs.logger.Warnf("batch write queue full, may have delayed persistence for customer %d", customerId)
+		bs.logger.Warnf("batch write queue full, writing directly for customer %d", customerId)
 		go bs.writeSingleUpdate(update)
 	}
 
-	return msgId, nil
+	err := <-update.done
+	if err == nil {
+		return nil
+	}
+
+	balanceKey := fmt.Sprintf("%s%d", constant.BalanceKeyPrefix, customerId)
+	amount := int64(len(items)) * constant.SmsCost
+	if restoreErr := bs.redisClient.IncrBy(ctx, balanceKey, amount).Err(); restoreErr != nil {
+		bs.logger.Errorf("CRITICAL: failed to give back %d to customer %d after a failed write: %v", amount, customerId, restoreErr)
+	}
+
+	return errors.Wrap(err, "failed to persist sms")
+}
+
+// Refund gives amount back to the customer for a message and returns the new
+// balance. A message is refunded at most once whatever the reason, so retried
+// refunds are harmless. The refund is recorded in the balance ledger before the
+// balance is credited in redis, and the ledger row is marked once it is.
+func (bs *BalanceService) Refund(ctx context.Context, customerId int, messageId string, amount int64, reason string) (int64, error) {
+	balanceKey := fmt.Sprintf("%s%d", constant.BalanceKeyPrefix, customerId)
+
+	ledger := entity.BalanceLedger{
+		CustomerId: customerId,
+		MessageId:  messageId,
+		Amount:     amount,
+		Reason:     reason,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := bs.db.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "message_id"}}, DoNothing: true}).
+		Create(&ledger).Error; err != nil {
+		bs.logger.Errorf("refund failed for customer %d message %s: %v", customerId, messageId, err)
+		return 0, errors.Wrap(err, "failed to insert ledger row")
+	}
+
+	// an earlier refund of the message may have been recorded but not credited yet
+	if err := bs.db.WithContext(ctx).Where("message_id = ?", messageId).Take(&ledger).Error; err != nil {
+		return 0, errors.Wrap(err, "failed to get ledger row")
+	}
+	if ledger.CreditedAt != nil {
+		balance, err := bs.redisClient.Get(ctx, balanceKey).Int64()
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to get redis balance")
+		}
+		return balance, nil
+	}
+
+	// the refund key keeps a retry from crediting twice when the ledger row
+	// could not be marked below
+	refundKey := constant.RefundKeyPrefix + messageId
+	newBalance, err := bs.refundScript.Run(
+		ctx,
+		bs.redisClient,
+		[]string{balanceKey, refundKey},
+		ledger.Amount,
+		int64(constant.RefundKeyTTL/time.Second),
+	).Int64()
+	if err != nil {
+		bs.logger.Errorf("refund failed for customer %d message %s: %v", customerId, messageId, err)
+		return 0, errors.Wrap(err, "failed to refund balance in redis")
+	}
+
+	err = bs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.BalanceLedger{}).
+			Where("id = ?", ledger.ID).
+			Update("credited_at", time.Now().UTC()).Error; err != nil {
+			return errors.Wrap(err, "failed to mark ledger row credited")
+		}
+
+		if err := tx.Model(&entity.Balance{}).
+			Where("customer_id = ?", customerId).
+			Update("balance_bigint", newBalance).Error; err != nil {
+			return errors.Wrap(err, "failed to persist refunded balance")
+		}
+
+		return nil
+	})
+	if err != nil {
+		bs.logger.Errorf("refund of customer %d message %s is credited but not recorded: %v", customerId, messageId, err)
+		return 0, err
+	}
+
+	return newBalance, nil
+}
+
+// ReconcileRefunds credits the refunds that were recorded in the ledger but
+// not credited in redis, e.g. after a redis error, until ctx is done. Only the
+// rows whose refund key has not expired are retried, so a refund credited
+// before its row could be marked is not credited twice.
+func (bs *BalanceService) ReconcileRefunds(ctx context.Context) {
+	ticker := time.NewTicker(constant.RefundReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := bs.reconcileRefunds(ctx); err != nil {
+				bs.logger.Errorf("refund reconciler: %v", err)
+			}
+		}
+	}
+}
+
+func (bs *BalanceService) reconcileRefunds(ctx context.Context) error {
+	now := time.Now().UTC()
+
+	var rows []entity.BalanceLedger
+	if err := bs.db.WithContext(ctx).
+		Where("credited_at IS NULL AND created_at > ? AND created_at < ?",
+			now.Add(-constant.RefundKeyTTL), now.Add(-constant.RefundReconcileDelay)).
+		Order("id").
+		Limit(constant.RefundReconcileBatchSize).
+		Find(&rows).Error; err != nil {
+		return errors.Wrap(err, "failed to get uncredited ledger rows")
+	}
+
+	for _, row := range rows {
+		if _, err := bs.Refund(ctx, row.CustomerId, row.MessageId, row.Amount, row.Reason); err != nil {
+			bs.logger.Errorf("refund reconciler: refund of message %s is still not credited: %v", row.MessageId, err)
+			continue
+		}
+		bs.logger.Infof("refund reconciler: credited %d to customer %d for message %s", row.Amount, row.CustomerId, row.MessageId)
+	}
+
+	return nil
 }
 
 func (bs *BalanceService) InitializeBalanceCache(ctx context.Context) error {
@@ -120,11 +292,21 @@ func (bs *BalanceService) batchWriter(workerID int) {
 		case update := <-bs.pendingWrites:
 			batch = append(batch, update)
 
-			if len(batch) >= constant.BalanceSyncBatchSize {
-				bs.flushBatch(batch, workerID)
-				batch = batch[:0]
+			// callers wait for the commit, so take whatever is already queued
+			// and flush right away instead of waiting for the ticker
+		drain:
+			for len(batch) < constant.BalanceSyncBatchSize {
+				select {
+				case update := <-bs.pendingWrites:
+					batch = append(batch, update)
+				default:
+					break drain
+				}
 			}
 
+			bs.flushBatch(batch, workerID)
+			batch = batch[:0]
+
 		case <-ticker.C:
 			if len(batch) > 0 {
 				bs.flushBatch(batch, workerID)
@@ -144,19 +326,8 @@ func (bs *BalanceService) flushBatch(batch []*BalanceUpdate, workerID int) {
 	defer cancel()
 
 	err := bs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		smsLogs := make([]entity.SmsLog, len(batch))
-		for i, update := range batch {
-			smsLogs[i] = entity.SmsLog{
-				MessageId:  update.MsgID,
-				CustomerId: update.CustomerID,
-				ToNumber:   update.ToNumber,
-				Body:       update.Body,
-				CreatedAt:  update.Timestamp,
-			}
-		}
-
-		if err := tx.CreateInBatches(smsLogs, 500).Error; err != nil {
-			return errors.Wrap(err, "failed to batch insert sms logs")
+		if err := insertQueued(tx, batch); err != nil {
+			return err
 		}
 
 		customerIDs := make(map[int]bool)
@@ -186,9 +357,12 @@ func (bs *BalanceService) flushBatch(batch []*BalanceUpdate, workerID int) {
 
 	if err != nil {
 		bs.logger.Errorf("batch writer %d: write failed (%d records, %v elapsed): %v", workerID, len(batch), elapsed, err)
-		// TODO: retry logic or DLQ for failed batches
 	} else {
-		bs.logger.Infof("batch writer %d: successful (%d records synced to DB in %v)", workerID, len(batch), elapsed)
+		bs.logger.Debugf("batch writer %d: successful (%d records synced to DB in %v)", workerID, len(batch), elapsed)
+	}
+
+	for _, update := range batch {
+		update.done <- err
 	}
 }
 
@@ -197,16 +371,8 @@ func (bs *BalanceService) writeSingleUpdate(update *BalanceUpdate) {
 	defer cancel()
 
 	err := bs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		smsLog := entity.SmsLog{
-			MessageId:  update.MsgID,
-			CustomerId: update.CustomerID,
-			ToNumber:   update.ToNumber,
-			Body:       update.Body,
-			CreatedAt:  update.Timestamp,
-		}
-
-		if err := tx.Create(&smsLog).Error; err != nil {
-			return errors.Wrap(err, "failed to insert sms log")
+		if err := insertQueued(tx, []*BalanceUpdate{update}); err != nil {
+			return err
 		}
 
 		balanceKey := fmt.Sprintf("%s%d", constant.BalanceKeyPrefix, update.CustomerID)
@@ -227,4 +393,49 @@ func (bs *BalanceService) writeSingleUpdate(update *BalanceUpdate) {
 	if err != nil {
 		bs.logger.Errorf("single write failed for customer %d: %v", update.CustomerID, err)
 	}
+
+	update.done <- err
+}
+
+// insertQueued writes the sms_logs rows and the outbox rows of the updates, it
+// must run inside the caller's transaction so both are committed together.
+func insertQueued(tx *gorm.DB, updates []*BalanceUpdate) error {
+	var (
+		smsLogs []entity.SmsLog
+		outbox  []entity.Outbox
+	)
+
+	for _, update := range updates {
+		for _, item := range update.Items {
+			msgId, err := uuid.Parse(item.Sms.MessageId)
+			if err != nil {
+				return errors.Wrapf(err, "invalid message id %q", item.Sms.MessageId)
+			}
+
+			smsLogs = append(smsLogs, entity.SmsLog{
+				MessageId:  msgId,
+				CustomerId: update.CustomerID,
+				ToNumber:   item.Sms.To,
+				Body:       item.Sms.Message,
+				CreatedAt:  update.Timestamp,
+			})
+			for _, km := range item.Outbox {
+				outbox = append(outbox, entity.NewOutbox(km, update.Timestamp))
+			}
+		}
+	}
+
+	if len(smsLogs) > 0 {
+		if err := tx.CreateInBatches(smsLogs, 500).Error; err != nil {
+			return errors.Wrap(err, "failed to batch insert sms logs")
+		}
+	}
+
+	if len(outbox) > 0 {
+		if err := tx.CreateInBatches(outbox, 500).Error; err != nil {
+			return errors.Wrap(err, "failed to batch insert outbox")
+		}
+	}
+
+	return nil
 }
@@ -1,10 +1,10 @@
 package balance
 
 import (
+	"arvan/message-gateway/internal/domain"
 	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
@@ -19,14 +19,18 @@ type BalanceService struct {
 	wg            sync.WaitGroup
 	numWorkers    int
 	deductScript  *redis.Script
+	bulkScript    *redis.Script
+	refundScript  *redis.Script
 }
 
+// BalanceUpdate holds the messages a customer was charged for. They are
+// persisted to sms_logs together with their outbox rows and the result is
+// reported on done.
 type BalanceUpdate struct {
-	MsgID      uuid.UUID
 	CustomerID int
-	ToNumber   string
-	Body       string
+	Items      []domain.QueuedSms
 	Timestamp  time.Time
+	done       chan error
 }
 
 var deductBalanceLua = redis.NewScript(`
@@ -42,6 +46,36 @@ var deductBalanceLua = redis.NewScript(`
 	end
 `)
 
+// deductBulkBalanceLua charges the sum of the amounts in ARGV only when the
+// balance covers all of them. It returns the new balance, or -1 and charges
+// nothing when the balance is short.
+var deductBulkBalanceLua = redis.NewScript(`
+	local key = KEYS[1]
+	local balance = tonumber(redis.call('GET', key) or 0)
+	local total = 0
+
+	for _, amount in ipairs(ARGV) do
+		total = total + tonumber(amount)
+	end
+
+	if balance < total then
+		return -1
+	end
+
+	redis.call('DECRBY', key, total)
+	return balance - total
+`)
+
+// refundBalanceLua credits ARGV[1] to the balance once per refund key KEYS[2],
+// which expires after ARGV[2] seconds. It returns the balance either way.
+var refundBalanceLua = redis.NewScript(`
+	if redis.call('SET', KEYS[2], 1, 'NX', 'EX', tonumber(ARGV[2])) then
+		return redis.call('INCRBY', KEYS[1], tonumber(ARGV[1]))
+	end
+
+	return tonumber(redis.call('GET', KEYS[1]) or 0)
+`)
+
 func NewBalanceService(
 	redisClient *redis.Client,
 	db *gorm.DB,
@@ -56,6 +90,8 @@ func NewBalanceService(
 		pendingWrites: make(chan *BalanceUpdate, queueSize),
 		stopCh:        make(chan struct{}),
 		deductScript:  deductBalanceLua,
+		bulkScript:    deductBulkBalanceLua,
+		refundScript:  refundBalanceLua,
 		numWorkers:    numWorkers,
 	}
 
@@ -0,0 +1,46 @@
+package dlq
+
+import (
+	"arvan/message-gateway/internal/config"
+	"arvan/message-gateway/internal/domain"
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+type dlqService struct {
+	dlqRepository dlqRepository
+	kafkaWriter   *kafka.Writer
+	cfg           config.Dlq
+	logger        *logrus.Logger
+}
+
+type dlqRepository interface {
+	ListDLQ(ctx context.Context, limit int) ([]domain.DlqMessage, error)
+	ClaimDLQ(
+		ctx context.Context,
+		limit, maxAttempts int,
+		backoff time.Duration,
+		force bool,
+		handle func(ctx context.Context, msg domain.DlqMessage) error,
+	) (int, int, error)
+	PurgeDLQ(ctx context.Context, maxAttempts int) (int, error)
+}
+
+// NewDlqService expects a kafka writer without a topic, every row is
+// republished to the topic it was written for.
+func NewDlqService(
+	dlqRepository dlqRepository,
+	kafkaWriter *kafka.Writer,
+	cfg config.Dlq,
+	logger *logrus.Logger,
+) *dlqService {
+	return &dlqService{
+		dlqRepository: dlqRepository,
+		kafkaWriter:   kafkaWriter,
+		cfg:           cfg,
+		logger:        logger,
+	}
+}
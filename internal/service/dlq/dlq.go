@@ -0,0 +1,62 @@
+package dlq
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func (ds *dlqService) List(ctx context.Context, limit int) ([]domain.DlqMessage, error) {
+	return ds.dlqRepository.ListDLQ(ctx, limit)
+}
+
+// Replay republishes up to limit rows that are still below the max attempts.
+// Unless force is set only rows whose backoff has passed are picked.
+func (ds *dlqService) Replay(ctx context.Context, limit int, force bool) (int, int, error) {
+	return ds.dlqRepository.ClaimDLQ(ctx, limit, ds.cfg.MaxAttempts, ds.cfg.Backoff, force, ds.publish)
+}
+
+// Purge deletes the rows that reached the max attempts, or every row when all is set.
+func (ds *dlqService) Purge(ctx context.Context, all bool) (int, error) {
+	if all {
+		return ds.dlqRepository.PurgeDLQ(ctx, 0)
+	}
+	return ds.dlqRepository.PurgeDLQ(ctx, ds.cfg.MaxAttempts)
+}
+
+// Redrive replays due rows every RedriveInterval until ctx is done.
+func (ds *dlqService) Redrive(ctx context.Context) {
+	ticker := time.NewTicker(ds.cfg.RedriveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			succeeded, failed, err := ds.Replay(ctx, ds.cfg.BatchSize, false)
+			if err != nil {
+				ds.logger.Errorf("dlq re-driver: replay failed: %v", err)
+				continue
+			}
+			if succeeded > 0 || failed > 0 {
+				ds.logger.Infof("dlq re-driver: republished %d messages, %d failed", succeeded, failed)
+			}
+		}
+	}
+}
+
+func (ds *dlqService) publish(ctx context.Context, msg domain.DlqMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, constant.KafkaWriteTimeout)
+	defer cancel()
+
+	return ds.kafkaWriter.WriteMessages(ctx, kafka.Message{
+		Topic: msg.Topic,
+		Key:   []byte(msg.Key),
+		Value: msg.Payload,
+		Time:  time.Now(),
+	})
+}
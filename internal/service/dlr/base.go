@@ -0,0 +1,57 @@
+package dlr
+
+import (
+	"arvan/message-gateway/internal/config"
+	"arvan/message-gateway/internal/domain"
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+type dlrService struct {
+	providerMessageRepository providerMessageRepository
+	redisClient               *redis.Client
+	kafkaWriterSmsStatus      *kafka.Writer
+	providers                 map[string]config.DLR
+	refunder                  refunder
+	logger                    *logrus.Logger
+}
+
+// refunder refunds undelivered messages according to the refund policy
+type refunder interface {
+	RefundFailed(ctx context.Context, job domain.Job, status domain.Status)
+}
+
+type providerMessageRepository interface {
+	InsertProviderMessage(ctx context.Context, message domain.ProviderMessage) error
+	GetProviderMessage(ctx context.Context, provider, providerMessageId string) (domain.ProviderMessage, error)
+	FinishProviderMessage(ctx context.Context, message domain.ProviderMessage, status domain.Status) (bool, error)
+	ReopenProviderMessage(ctx context.Context, message domain.ProviderMessage) error
+	PurgeProviderMessages(ctx context.Context, before time.Time) (int, error)
+}
+
+func NewDlrService(
+	providerMessageRepository providerMessageRepository,
+	redisClient *redis.Client,
+	kafkaWriterSmsStatus *kafka.Writer,
+	providers []config.Provider,
+	refunder refunder,
+	logger *logrus.Logger,
+) *dlrService {
+	dlrs := make(map[string]config.DLR, len(providers))
+	for _, provider := range providers {
+		dlrs[provider.Name] = provider.DLR
+	}
+
+	return &dlrService{
+		providerMessageRepository: providerMessageRepository,
+		redisClient:               redisClient,
+		kafkaWriterSmsStatus:      kafkaWriterSmsStatus,
+		providers:                 dlrs,
+		refunder:                  refunder,
+		logger:                    logger,
+	}
+}
@@ -0,0 +1,161 @@
+package dlr
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"arvan/message-gateway/internal/infra"
+	"arvan/message-gateway/internal/provider"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Track records the provider message id of a sent message so its delivery
+// receipts can be resolved. Redis answers the receipts that come soon after
+// the send, postgres keeps the mapping for the late ones.
+func (ds *dlrService) Track(ctx context.Context, message domain.ProviderMessage) error {
+	if message.ProviderMessageID == "" {
+		return nil
+	}
+
+	marshalled, err := json.Marshal(message)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal provider message")
+	}
+
+	key := providerMessageKey(message.Provider, message.ProviderMessageID)
+	if err := ds.redisClient.Set(ctx, key, marshalled, constant.ProviderMessageCacheTTL).Err(); err != nil {
+		ds.logger.Warnf("dlr: caching provider message %s failed: %v", key, err)
+	}
+
+	return ds.providerMessageRepository.InsertProviderMessage(ctx, message)
+}
+
+// Receive handles a receipt posted by a provider. fields is the decoded json
+// body or the form values of the request, token is what the provider sent
+// to authenticate. Providers without a token do not accept receipts over
+// http. Intermediate statuses are accepted and ignored.
+func (ds *dlrService) Receive(ctx context.Context, providerName, token string, fields map[string]interface{}) error {
+	cfg, ok := ds.providers[providerName]
+	if !ok {
+		return constant.UnknownProviderErr
+	}
+	if cfg.Token == "" {
+		return constant.DlrDisabledErr
+	}
+	if subtle.ConstantTimeCompare([]byte(cfg.Token), []byte(token)) != 1 {
+		return constant.InvalidDlrTokenErr
+	}
+
+	providerMessageId := provider.Lookup(fields, cfg.IDField)
+	if providerMessageId == "" {
+		return constant.InvalidDlrErr
+	}
+
+	stat := provider.Lookup(fields, cfg.StatusField)
+	status := provider.ReceiptStatus(stat)
+	if status == "" {
+		return nil
+	}
+
+	return ds.Report(ctx, domain.Receipt{
+		Provider:          providerName,
+		ProviderMessageID: providerMessageId,
+		Status:            status,
+		Stat:              stat,
+	})
+}
+
+// Report resolves the receipt to its message and publishes the final status,
+// an undelivered message is refunded like a failed job when the refund policy
+// says so. Only the first final receipt of a message is published, providers
+// resend receipts until they get an answer.
+func (ds *dlrService) Report(ctx context.Context, receipt domain.Receipt) error {
+	message, err := ds.find(ctx, receipt.Provider, receipt.ProviderMessageID)
+	if err != nil {
+		return err
+	}
+
+	first, err := ds.providerMessageRepository.FinishProviderMessage(ctx, message, receipt.Status)
+	if err != nil {
+		return err
+	}
+	if !first {
+		ds.logger.Debugf("dlr: ignoring duplicate %s receipt of %s", receipt.Status, message.MessageID)
+		return nil
+	}
+
+	event := domain.NewStatusEvent(message.Job(), receipt.Status, receipt.Stat)
+	event.Provider = receipt.Provider
+	if receipt.Status != domain.StatusDelivered {
+		event.ErrorCode = receipt.Stat
+	}
+	if err := infra.WriteStatusEvent(ctx, ds.kafkaWriterSmsStatus, event); err != nil {
+		// let the retry of the provider publish it
+		if err := ds.providerMessageRepository.ReopenProviderMessage(ctx, message); err != nil {
+			ds.logger.Errorf("dlr: reopening %s after a failed publish failed: %v", message.MessageID, err)
+		}
+		return errors.Wrap(err, "failed to publish receipt status")
+	}
+
+	if receipt.Status == domain.StatusUndelivered {
+		ds.refunder.RefundFailed(ctx, message.Job(), receipt.Status)
+	}
+
+	return nil
+}
+
+// Purge deletes the provider messages older than their retention every
+// purge interval until ctx is done.
+func (ds *dlrService) Purge(ctx context.Context) {
+	ticker := time.NewTicker(constant.ProviderMessagePurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := ds.providerMessageRepository.PurgeProviderMessages(ctx, time.Now().Add(-constant.ProviderMessageRetention))
+			if err != nil {
+				ds.logger.Errorf("dlr: purge failed: %v", err)
+				continue
+			}
+			if purged > 0 {
+				ds.logger.Infof("dlr: purged %d provider messages", purged)
+			}
+		}
+	}
+}
+
+func (ds *dlrService) find(ctx context.Context, providerName, providerMessageId string) (domain.ProviderMessage, error) {
+	var message domain.ProviderMessage
+
+	cached, err := ds.redisClient.Get(ctx, providerMessageKey(providerName, providerMessageId)).Bytes()
+	if err == nil {
+		if err := json.Unmarshal(cached, &message); err == nil {
+			return message, nil
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		ds.logger.Warnf("dlr: redis lookup of %s failed: %v", providerMessageId, err)
+	}
+
+	message, err = ds.providerMessageRepository.GetProviderMessage(ctx, providerName, providerMessageId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.ProviderMessage{}, constant.ProviderMessageNotFoundErr
+		}
+		return domain.ProviderMessage{}, errors.Wrap(err, "failed to get provider message")
+	}
+
+	return message, nil
+}
+
+func providerMessageKey(providerName, providerMessageId string) string {
+	return constant.RedisProviderMessageKeyPrefix + providerName + ":" + providerMessageId
+}
@@ -0,0 +1,20 @@
+package export
+
+import (
+	"arvan/message-gateway/internal/domain"
+	"context"
+)
+
+type exportService struct {
+	smsRepository smsRepository
+}
+
+type smsRepository interface {
+	StreamSmsLog(ctx context.Context, customerId int, filter domain.SmsLogFilter, each func(domain.SMSStatus) error) error
+}
+
+func NewExportService(smsRepository smsRepository) *exportService {
+	return &exportService{
+		smsRepository: smsRepository,
+	}
+}
@@ -0,0 +1,112 @@
+package export
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var csvHeader = []string{
+	"id", "customer_id", "phone", "message", "priority", "status", "provider",
+	"error_code", "reason", "segments", "cost", "attempt", "created_at", "updated_at",
+}
+
+// flusher is implemented by http response writers, flushing sends the rows
+// written so far as a chunk.
+type flusher interface {
+	Flush()
+}
+
+// Export writes the messages of the customer accepted between from and to
+// into w in the given format while they are read, and returns the number of
+// rows written. A failure midway leaves a partial export in w.
+func (es *exportService) Export(ctx context.Context, customerId int, format domain.ExportFormat, from, to time.Time, w io.Writer) (int, error) {
+	if !format.Valid() {
+		return 0, constant.InvalidExportFormatErr
+	}
+
+	enc := newEncoder(format, w)
+	if err := enc.header(); err != nil {
+		return 0, errors.Wrap(err, "failed to write export header")
+	}
+
+	rows := 0
+	filter := domain.SmsLogFilter{From: from, To: to}
+	err := es.smsRepository.StreamSmsLog(ctx, customerId, filter, func(sms domain.SMSStatus) error {
+		if err := enc.row(sms); err != nil {
+			return errors.Wrap(err, "failed to write export row")
+		}
+		rows++
+		if rows%constant.ExportFlushRows == 0 {
+			return enc.flush(w)
+		}
+		return nil
+	})
+	if err != nil {
+		return rows, err
+	}
+
+	return rows, enc.flush(w)
+}
+
+type encoder struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func newEncoder(format domain.ExportFormat, w io.Writer) *encoder {
+	if format == domain.ExportFormatNDJSON {
+		return &encoder{json: json.NewEncoder(w)}
+	}
+	return &encoder{csv: csv.NewWriter(w)}
+}
+
+func (e *encoder) header() error {
+	if e.csv == nil {
+		return nil
+	}
+	return e.csv.Write(csvHeader)
+}
+
+func (e *encoder) row(sms domain.SMSStatus) error {
+	if e.csv == nil {
+		return e.json.Encode(sms)
+	}
+	return e.csv.Write([]string{
+		sms.ID,
+		strconv.Itoa(sms.CustomerID),
+		sms.Phone,
+		sms.Message,
+		strconv.Itoa(sms.Priority),
+		string(sms.Status),
+		sms.Provider,
+		sms.ErrorCode,
+		sms.Reason,
+		strconv.Itoa(sms.Segments),
+		strconv.FormatInt(sms.Cost, 10),
+		strconv.Itoa(sms.Attempt),
+		sms.CreatedAt.UTC().Format(time.RFC3339Nano),
+		sms.Timestamp.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// flush pushes the buffered csv rows into w and w on to its client.
+func (e *encoder) flush(w io.Writer) error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return errors.Wrap(err, "failed to write export rows")
+		}
+	}
+	if f, ok := w.(flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
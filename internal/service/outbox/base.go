@@ -0,0 +1,39 @@
+package outbox
+
+import (
+	"arvan/message-gateway/internal/domain"
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+type outboxService struct {
+	outboxRepository outboxRepository
+	kafkaWriter      *kafka.Writer
+	logger           *logrus.Logger
+}
+
+type outboxRepository interface {
+	ClaimOutbox(
+		ctx context.Context,
+		limit int,
+		publish func(ctx context.Context, messages []domain.OutboxMessage) error,
+	) (int, error)
+	PurgeSentOutbox(ctx context.Context, before time.Time) (int, error)
+}
+
+// NewOutboxService expects a kafka writer without a topic, every row is
+// published to the topic it was written for.
+func NewOutboxService(
+	outboxRepository outboxRepository,
+	kafkaWriter *kafka.Writer,
+	logger *logrus.Logger,
+) *outboxService {
+	return &outboxService{
+		outboxRepository: outboxRepository,
+		kafkaWriter:      kafkaWriter,
+		logger:           logger,
+	}
+}
@@ -0,0 +1,71 @@
+package outbox
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+// Relay publishes the outbox rows to kafka in insert order until ctx is done.
+// A row is marked as sent only after kafka acknowledged it, so a crash between
+// the two republishes the row and consumers see it at least once.
+func (ob *outboxService) Relay(ctx context.Context) {
+	ticker := time.NewTicker(constant.OutboxRelayInterval)
+	defer ticker.Stop()
+
+	purgeTicker := time.NewTicker(constant.OutboxPurgeInterval)
+	defer purgeTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-purgeTicker.C:
+			purged, err := ob.outboxRepository.PurgeSentOutbox(ctx, time.Now().Add(-constant.OutboxRetention))
+			if err != nil {
+				ob.logger.Errorf("outbox relay: purge failed: %v", err)
+				continue
+			}
+			if purged > 0 {
+				ob.logger.Infof("outbox relay: purged %d sent rows", purged)
+			}
+		case <-ticker.C:
+			for {
+				relayed, err := ob.outboxRepository.ClaimOutbox(ctx, constant.OutboxRelayBatchSize, ob.publish)
+				if err != nil {
+					ob.logger.Errorf("outbox relay: relay failed: %v", err)
+					break
+				}
+				if relayed < constant.OutboxRelayBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+func (ob *outboxService) publish(ctx context.Context, messages []domain.OutboxMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, constant.KafkaWriteTimeout)
+	defer cancel()
+
+	now := time.Now()
+	kmsgs := make([]kafka.Message, len(messages))
+	for i, msg := range messages {
+		kmsgs[i] = kafka.Message{
+			Topic: msg.Topic,
+			Key:   []byte(msg.Key),
+			Value: msg.Payload,
+			Time:  now,
+		}
+	}
+
+	if err := ob.kafkaWriter.WriteMessages(ctx, kmsgs...); err != nil {
+		return errors.Wrap(err, "failed to write messages")
+	}
+
+	return nil
+}
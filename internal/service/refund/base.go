@@ -0,0 +1,34 @@
+package refund
+
+import (
+	"arvan/message-gateway/internal/config"
+	"context"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+type refundService struct {
+	balanceService       balanceService
+	policy               config.RefundPolicy
+	kafkaWriterSmsStatus *kafka.Writer
+	logger               *logrus.Logger
+}
+
+type balanceService interface {
+	Refund(ctx context.Context, customerId int, messageId string, amount int64, reason string) (int64, error)
+}
+
+func NewRefundService(
+	balanceService balanceService,
+	policy config.RefundPolicy,
+	kafkaWriterSmsStatus *kafka.Writer,
+	logger *logrus.Logger,
+) *refundService {
+	return &refundService{
+		balanceService:       balanceService,
+		policy:               policy,
+		kafkaWriterSmsStatus: kafkaWriterSmsStatus,
+		logger:               logger,
+	}
+}
@@ -0,0 +1,29 @@
+package refund
+
+import (
+	"arvan/message-gateway/internal/config"
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"arvan/message-gateway/internal/infra"
+	"context"
+)
+
+// RefundFailed refunds a message that failed or was not delivered when the
+// refund policy says so and publishes its refunded status. status is the
+// status the message ended up in, it is kept as the reason of the refund.
+// Failures are logged, the message keeps its final status and a refund that
+// was recorded in the ledger is credited later by the refund reconciler.
+func (rs *refundService) RefundFailed(ctx context.Context, job domain.Job, status domain.Status) {
+	if rs.policy != config.RefundOnFailure {
+		return
+	}
+
+	if _, err := rs.balanceService.Refund(ctx, job.CustomerID, job.ID, constant.SmsCost, string(status)); err != nil {
+		rs.logger.Errorf("refund: refund of %s message %s failed: %v", status, job.ID, err)
+		return
+	}
+
+	if err := infra.WriteStatusEvent(ctx, rs.kafkaWriterSmsStatus, domain.NewStatusEvent(job, domain.StatusRefunded, "")); err != nil {
+		rs.logger.Errorf("refund: publish refunded status of %s failed: %v", job.ID, err)
+	}
+}
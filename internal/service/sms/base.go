@@ -1,57 +1,100 @@
 package sms
 
 import (
-	"arvan/message-gateway/internal/constant"
 	"arvan/message-gateway/internal/domain"
 	"context"
 
-	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"github.com/segmentio/kafka-go"
 	"github.com/sirupsen/logrus"
 )
 
 type smsService struct {
-	balanceService         balanceService
-	dlqRepository          dlqRepository
-	smsRepository          smsRepository
-	redisClient            *redis.Client
-	logger                 *logrus.Logger
-	kafkaWriterSmsAccepted *kafka.Writer
-	kafkaWriterSmsStatus   *kafka.Writer
-	kafkaWorkChan          chan domain.KafkaMessage
+	balanceService       balanceService
+	dlqRepository        dlqRepository
+	outboxRepository     outboxRepository
+	smsRepository        smsRepository
+	redisClient          *redis.Client
+	logger               *logrus.Logger
+	kafkaWriterSmsStatus *kafka.Writer
+	popDueScript         *redis.Script
+	cancelScript         *redis.Script
 }
 
 type balanceService interface {
-	DeductBalanceAndQueueSms(ctx context.Context, customerId int, message, receiver string) (uuid.UUID, error)
+	DeductBalanceAndQueueSms(ctx context.Context, item domain.QueuedSms) (int64, error)
+	DeductBalanceAndQueueBulkSms(ctx context.Context, customerId int, items []domain.QueuedSms) (int64, error)
+	Refund(ctx context.Context, customerId int, messageId string, amount int64, reason string) (int64, error)
 }
 
 type dlqRepository interface {
 	InsertDLQ(ctx context.Context, km domain.KafkaMessage) error
 }
 
+type outboxRepository interface {
+	InsertOutbox(ctx context.Context, messages []domain.KafkaMessage) error
+}
+
 type smsRepository interface {
-	GetAllSmsLog(ctx context.Context, customerId, limit, offset int) ([]domain.SMSStatus, int64, error)
-	ViewSmsTimeLine(ctx context.Context, messageId string) ([]domain.SMSStatus, error)
+	GetAllSmsLog(ctx context.Context, customerId int, filter domain.SmsLogFilter) ([]domain.SMSStatus, *domain.SmsLogCursor, error)
+	ViewSmsTimeLine(ctx context.Context, customerId int, messageId string) ([]domain.SMSStatus, error)
 }
 
+// popDueLua pops up to ARGV[2] scheduled messages whose score is not after ARGV[1]
+// and returns their payloads.
+var popDueLua = redis.NewScript(`
+	local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+	local payloads = {}
+
+	for _, id in ipairs(ids) do
+		redis.call('ZREM', KEYS[1], id)
+		local payload = redis.call('HGET', KEYS[2], id)
+		if payload then
+			redis.call('HDEL', KEYS[2], id)
+			table.insert(payloads, payload)
+		end
+	end
+
+	return payloads
+`)
+
+// cancelScheduledLua removes the scheduled message ARGV[1] when it belongs to
+// customer ARGV[2] and returns its payload, or nil when there is no such message.
+var cancelScheduledLua = redis.NewScript(`
+	local payload = redis.call('HGET', KEYS[2], ARGV[1])
+	if not payload then
+		return nil
+	end
+
+	local sms = cjson.decode(payload)
+	if tonumber(sms.customer_id) ~= tonumber(ARGV[2]) then
+		return nil
+	end
+
+	redis.call('ZREM', KEYS[1], ARGV[1])
+	redis.call('HDEL', KEYS[2], ARGV[1])
+
+	return payload
+`)
+
 func NewSmsService(
 	balanceService balanceService,
 	dlqRepo dlqRepository,
+	outboxRepository outboxRepository,
 	smsRepository smsRepository,
 	redisClient *redis.Client,
 	logger *logrus.Logger,
-	kafkaWriterSmsAccepted *kafka.Writer,
 	kafkaWriterSmsStatus *kafka.Writer,
 ) *smsService {
 	return &smsService{
-		balanceService:         balanceService,
-		dlqRepository:          dlqRepo,
-		smsRepository:          smsRepository,
-		redisClient:            redisClient,
-		logger:                 logger,
-		kafkaWriterSmsAccepted: kafkaWriterSmsAccepted,
-		kafkaWriterSmsStatus:   kafkaWriterSmsStatus,
-		kafkaWorkChan:          make(chan domain.KafkaMessage, constant.KafkaWorkerBufSize),
+		balanceService:       balanceService,
+		dlqRepository:        dlqRepo,
+		outboxRepository:     outboxRepository,
+		smsRepository:        smsRepository,
+		redisClient:          redisClient,
+		logger:               logger,
+		kafkaWriterSmsStatus: kafkaWriterSmsStatus,
+		popDueScript:         popDueLua,
+		cancelScript:         cancelScheduledLua,
 	}
 }
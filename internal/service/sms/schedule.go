@@ -0,0 +1,180 @@
+package sms
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+func validateSendAt(sendAt *time.Time) error {
+	if sendAt != nil && time.Until(*sendAt) > constant.ScheduleMaxAhead {
+		return constant.InvalidSendAtErr
+	}
+	return nil
+}
+
+// schedule keeps a paid sms in redis until its send_at is due
+func (ss *smsService) schedule(ctx context.Context, sms domain.Sms) error {
+	payload, err := json.Marshal(sms)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal payload")
+	}
+
+	_, err = ss.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, constant.RedisScheduledPayloadKey, sms.MessageId, payload)
+		pipe.ZAdd(ctx, constant.RedisScheduledSetKey, redis.Z{
+			Score:  float64(sms.SendAt.Unix()),
+			Member: sms.MessageId,
+		})
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to schedule sms")
+	}
+
+	return nil
+}
+
+// refundUnscheduled gives back the charge of a paid sms that could not be
+// scheduled and records it as cancelled. It returns the balance after the
+// refund, the customer is still charged when it fails.
+func (ss *smsService) refundUnscheduled(ctx context.Context, sms domain.Sms, cause error) (int64, error) {
+	balance, err := ss.balanceService.Refund(ctx, sms.CustomerId, sms.MessageId, constant.SmsCost, string(domain.StatusCancelled))
+	if err != nil {
+		ss.logger.Errorf("CRITICAL: failed to refund message %s that could not be scheduled: %v", sms.MessageId, err)
+		return 0, err
+	}
+
+	// through the outbox so it follows the scheduled status written with the charge
+	statusMsg, err := domain.NewStatusEvent(sms.ToJob(), domain.StatusCancelled, "failed to schedule: "+cause.Error()).
+		KafkaMessage(constant.TopicStatus)
+	if err == nil {
+		err = ss.outboxRepository.InsertOutbox(ctx, []domain.KafkaMessage{statusMsg})
+	}
+	if err != nil {
+		ss.logger.Warnf("failed to record cancelled status for %s: %v", sms.MessageId, err)
+	}
+
+	return balance, nil
+}
+
+// CancelScheduled removes a scheduled sms that belongs to the customer before it
+// is released and refunds its cost.
+func (ss *smsService) CancelScheduled(ctx context.Context, customerId int, messageId string) (domain.CancelReceipt, error) {
+	res, err := ss.cancelScript.Run(
+		ctx,
+		ss.redisClient,
+		[]string{constant.RedisScheduledSetKey, constant.RedisScheduledPayloadKey},
+		messageId,
+		customerId,
+	).Text()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return domain.CancelReceipt{}, constant.ScheduledSmsNotFoundErr
+		}
+		return domain.CancelReceipt{}, errors.Wrap(err, "failed to cancel scheduled sms")
+	}
+
+	var sms domain.Sms
+	if err := json.Unmarshal([]byte(res), &sms); err != nil {
+		return domain.CancelReceipt{}, errors.Wrap(err, "failed to unmarshal payload")
+	}
+
+	balance, err := ss.balanceService.Refund(ctx, customerId, sms.MessageId, constant.SmsCost, string(domain.StatusCancelled))
+	if err != nil {
+		// the message is still paid for, it is scheduled again instead of being lost
+		ss.restoreScheduled(ctx, []string{res})
+		return domain.CancelReceipt{}, err
+	}
+
+	pushCtx, cancel := context.WithTimeout(ctx, constant.KafkaWriteTimeout)
+	defer cancel()
+	if err := ss.pushStatus(pushCtx, sms, domain.StatusCancelled); err != nil {
+		ss.logger.Warnf("failed to publish cancelled status for %s: %v", sms.MessageId, err)
+	}
+
+	return domain.CancelReceipt{
+		MessageId: sms.MessageId,
+		Status:    domain.StatusCancelled,
+		Refund:    constant.SmsCost,
+		Balance:   balance,
+	}, nil
+}
+
+// ReleaseScheduled moves due messages to the outbox until ctx is done.
+// Due messages are popped atomically so several server replicas may run it.
+func (ss *smsService) ReleaseScheduled(ctx context.Context) {
+	ticker := time.NewTicker(constant.ScheduleReleaseInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				released, err := ss.releaseDue(ctx)
+				if err != nil {
+					ss.logger.Errorf("scheduler: release failed: %v", err)
+					break
+				}
+				if released < constant.ScheduleReleaseBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+func (ss *smsService) releaseDue(ctx context.Context) (int, error) {
+	payloads, err := ss.popDueScript.Run(
+		ctx,
+		ss.redisClient,
+		[]string{constant.RedisScheduledSetKey, constant.RedisScheduledPayloadKey},
+		strconv.FormatInt(time.Now().Unix(), 10),
+		constant.ScheduleReleaseBatchSize,
+	).StringSlice()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to pop due messages")
+	}
+
+	for i, payload := range payloads {
+		var sms domain.Sms
+		if err := json.Unmarshal([]byte(payload), &sms); err != nil {
+			ss.logger.Errorf("scheduler: invalid payload: %v, raw: %s", err, payload)
+			continue
+		}
+
+		if err := ss.queueAccepted(ctx, sms); err != nil {
+			// the popped messages that are not queued yet are released on the next tick
+			ss.restoreScheduled(ctx, payloads[i:])
+			return i, errors.Wrapf(err, "failed to queue message %s", sms.MessageId)
+		}
+	}
+
+	return len(payloads), nil
+}
+
+// restoreScheduled puts popped payloads back until their release. It is not
+// cancelled with ctx, a message that was taken out must not be lost on shutdown.
+func (ss *smsService) restoreScheduled(ctx context.Context, payloads []string) {
+	ctx = context.WithoutCancel(ctx)
+
+	for _, payload := range payloads {
+		var sms domain.Sms
+		if err := json.Unmarshal([]byte(payload), &sms); err != nil {
+			ss.logger.Errorf("scheduler: invalid payload: %v, raw: %s", err, payload)
+			continue
+		}
+
+		if err := ss.schedule(ctx, sms); err != nil {
+			ss.logger.Errorf("CRITICAL: failed to restore scheduled message %s: %v, raw: %s", sms.MessageId, err, payload)
+		}
+	}
+}
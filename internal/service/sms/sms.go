@@ -3,138 +3,244 @@ package sms
 import (
 	"arvan/message-gateway/internal/constant"
 	"arvan/message-gateway/internal/domain"
+	"arvan/message-gateway/internal/infra"
 	"context"
 	"encoding/json"
-	"github.com/google/uuid"
 	"strconv"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
-	"github.com/segmentio/kafka-go"
 
 	"arvan/message-gateway/internal/api/request"
 )
 
-func (ss *smsService) Send(ctx context.Context, priority, customerId int, req request.SendSmsRequest) error {
-	msgId, err := ss.balanceService.DeductBalanceAndQueueSms(ctx, customerId, req.Message, req.PhoneNumber)
-	if err != nil {
-		return err
+// Send charges the customer for one sms and queues or schedules it. A message
+// that cannot be scheduled is refunded, when the refund fails as well the
+// receipt is returned along with the error, so the caller knows the customer
+// was charged.
+func (ss *smsService) Send(ctx context.Context, priority, customerId int, req request.SendSmsRequest) (domain.SmsReceipt, error) {
+	if err := validateSendAt(req.SendAt); err != nil {
+		return domain.SmsReceipt{}, err
 	}
 
 	sms := domain.Sms{
-		MessageId:  msgId.String(),
+		MessageId:  uuid.NewString(),
 		CustomerId: customerId,
 		To:         req.PhoneNumber,
 		Priority:   priority,
 		Message:    req.Message,
+		SendAt:     req.SendAt,
 		CreatedAt:  time.Now(),
 	}
-	b, err := json.Marshal(sms)
+	item, status, err := prepare(sms)
 	if err != nil {
-		return errors.Wrap(err, "failed to marshal payload")
-	}
-	kmsg := domain.KafkaMessage{
-		Key:      strconv.Itoa(customerId),
-		Payload:  b,
-		Topic:    constant.TopicAccepted,
-		Attempts: 0,
-	}
-
-	// Non-blocking enqueue to background workers. If the channel is full, we synchronously write to kafka_dlq
-	select {
-	case ss.kafkaWorkChan <- kmsg:
-		// enqueued successfully
-	default:
-		// worker queue full; fail-safe: persist to kafka_dlq synchronously (fast insert)
-		if err := ss.dlqRepository.InsertDLQ(ctx, kmsg); err != nil {
-			// If DLQ insert fails, log heavily — but do NOT undo billing (billing must remain correct).
-			ss.logger.Error(errors.Wrap(err, "CRITICAL: dlq insert failed: %v"))
+		return domain.SmsReceipt{}, err
+	}
+
+	balance, err := ss.balanceService.DeductBalanceAndQueueSms(ctx, item)
+	if err != nil {
+		return domain.SmsReceipt{}, err
+	}
+
+	receipt := domain.SmsReceipt{
+		MessageId:  sms.MessageId,
+		Status:     status,
+		Cost:       constant.SmsCost,
+		Balance:    balance,
+		AcceptedAt: sms.CreatedAt,
+		SendAt:     sms.SendAt,
+	}
+
+	if status == domain.StatusScheduled {
+		if err := ss.schedule(ctx, sms); err != nil {
+			if _, refundErr := ss.refundUnscheduled(ctx, sms, err); refundErr != nil {
+				// the message is paid for, the receipt comes back with the error
+				return receipt, err
+			}
+			return domain.SmsReceipt{}, err
 		}
 	}
 
-	return nil
+	return receipt, nil
 }
 
-func (ss *smsService) ProduceMessages(workerID int) {
-	for km := range ss.kafkaWorkChan {
-		success := false
-		for attempt := 0; attempt < constant.KafkaWriteRetries; attempt++ {
-			ctx, cancel := context.WithTimeout(context.Background(), constant.KafkaWriteTimeout)
+// SendBulk validates every item, charges the valid ones in a single balance
+// deduction and queues them. Invalid items are reported as rejected in the
+// receipt. The valid items are charged all together or not at all, when the
+// balance does not cover them InsufficientBalanceErr is returned along with
+// the receipt and every item is rejected. A scheduled item that cannot be
+// scheduled is refunded and rejected.
+func (ss *smsService) SendBulk(ctx context.Context, priority, customerId int, reqs []request.SendSmsRequest) (domain.BulkSmsReceipt, error) {
+	receipt := domain.BulkSmsReceipt{
+		Items:      make([]domain.BulkItemResult, len(reqs)),
+		AcceptedAt: time.Now(),
+	}
 
-			// log error but move on
-			err := ss.pushToStatusTopic(ctx, km)
-			if err != nil {
-				ss.logger.Warnf("kafka worker %d: write attempt %d failed: %v", workerID, attempt+1, err)
-			}
+	valid := make([]int, 0, len(reqs))
+	statuses := make([]domain.Status, 0, len(reqs))
+	items := make([]domain.QueuedSms, 0, len(reqs))
+	for i, req := range reqs {
+		receipt.Items[i] = domain.BulkItemResult{
+			Index:       i,
+			PhoneNumber: req.PhoneNumber,
+		}
+		if req.PhoneNumber == "" || req.Message == "" {
+			receipt.Items[i].Error = "phone_number and message are required"
+			continue
+		}
+		if err := validateSendAt(req.SendAt); err != nil {
+			receipt.Items[i].Error = err.Error()
+			continue
+		}
 
-			err = ss.kafkaWriterSmsAccepted.WriteMessages(ctx, kafka.Message{
-				Key:   []byte(km.Key),
-				Value: km.Payload,
-				Time:  time.Now(),
-			})
-			cancel()
-			if err == nil {
-				success = true
-				break
+		item, status, err := prepare(domain.Sms{
+			MessageId:  uuid.NewString(),
+			CustomerId: customerId,
+			To:         req.PhoneNumber,
+			Priority:   priority,
+			Message:    req.Message,
+			SendAt:     req.SendAt,
+			CreatedAt:  receipt.AcceptedAt,
+		})
+		if err != nil {
+			return domain.BulkSmsReceipt{}, err
+		}
+		valid = append(valid, i)
+		statuses = append(statuses, status)
+		items = append(items, item)
+	}
+
+	if len(items) > 0 {
+		balance, err := ss.balanceService.DeductBalanceAndQueueBulkSms(ctx, customerId, items)
+		if errors.Is(err, constant.InsufficientBalanceErr) {
+			for _, i := range valid {
+				receipt.Items[i].Error = constant.InsufficientBalanceErrMsg
 			}
-			ss.logger.Warnf("kafka worker %d: write attempt %d failed: %v", workerID, attempt+1, err)
-			time.Sleep(constant.KafkaRetryBackoff * time.Duration(attempt+1))
+			receipt.Rejected = len(reqs)
+			return receipt, err
+		}
+		if err != nil {
+			return domain.BulkSmsReceipt{}, err
 		}
-		if !success {
-			// push to DLQ in DB
-			km.Attempts += constant.KafkaWriteRetries
-			if err := ss.dlqRepository.InsertDLQ(context.Background(), km); err != nil {
-				ss.logger.Errorf("kafka worker %d: failed to insert dlq: %v", workerID, err)
+		receipt.Balance = balance
+
+		for j, i := range valid {
+			sms := items[j].Sms
+			status := statuses[j]
+			if status == domain.StatusScheduled {
+				if err := ss.schedule(ctx, sms); err != nil {
+					ss.logger.Errorf("bulk send: failed to schedule message %s: %v", sms.MessageId, err)
+					receipt.Items[i].Error = "failed to schedule the message"
+					if balance, refundErr := ss.refundUnscheduled(ctx, sms, err); refundErr == nil {
+						receipt.Balance = balance
+					} else {
+						// not sent but still paid for
+						receipt.Cost += constant.SmsCost
+					}
+					continue
+				}
 			}
+
+			receipt.Items[i].Accepted = true
+			receipt.Items[i].MessageId = sms.MessageId
+			receipt.Items[i].Status = status
+			receipt.Accepted++
+			receipt.Cost += constant.SmsCost
 		}
 	}
+
+	receipt.Rejected = len(reqs) - receipt.Accepted
+
+	return receipt, nil
 }
 
-// no need to prevent sms send because logging is not critical
-func (ss *smsService) pushToStatusTopic(ctx context.Context, kmsg domain.KafkaMessage) error {
-	var sms domain.Sms
-	err := json.Unmarshal(kmsg.Payload, &sms)
+// prepare builds the outbox messages of a new sms and returns the status it
+// starts with. A message due now is written to sms.accepted right away, one with
+// a send_at in the future only gets its scheduled status and waits in redis.
+func prepare(sms domain.Sms) (domain.QueuedSms, domain.Status, error) {
+	status := domain.StatusAccepted
+	if sms.SendAt != nil && sms.SendAt.After(time.Now()) {
+		status = domain.StatusScheduled
+	}
+
+	statusMsg, err := statusMessage(sms, status)
 	if err != nil {
-		return errors.Wrap(err, "failed to unmarshal payload")
+		return domain.QueuedSms{}, "", err
+	}
+	item := domain.QueuedSms{
+		Sms:    sms,
+		Outbox: []domain.KafkaMessage{statusMsg},
 	}
 
-	job := domain.Job{
-		ID:         uuid.NewString(),
-		CustomerID: sms.CustomerId,
-		Phone:      sms.To,
-		Message:    sms.Message,
-		Priority:   sms.Priority,
-		CreatedAt:  time.Now(),
+	if status == domain.StatusAccepted {
+		acceptedMsg, err := acceptedMessage(sms)
+		if err != nil {
+			return domain.QueuedSms{}, "", err
+		}
+		item.Outbox = append(item.Outbox, acceptedMsg)
+	}
+
+	return item, status, nil
+}
+
+// queueAccepted writes a released scheduled sms to the outbox, it falls back to
+// kafka_dlq when the outbox is not reachable.
+func (ss *smsService) queueAccepted(ctx context.Context, sms domain.Sms) error {
+	statusMsg, err := statusMessage(sms, domain.StatusAccepted)
+	if err != nil {
+		return err
+	}
+	acceptedMsg, err := acceptedMessage(sms)
+	if err != nil {
+		return err
 	}
 
-	msg := struct {
-		domain.Job `json:",inline"`
-		Status     string `json:"status"`
-	}{
-		job,
-		"init",
+	if err := ss.outboxRepository.InsertOutbox(ctx, []domain.KafkaMessage{statusMsg, acceptedMsg}); err != nil {
+		ss.logger.Warnf("outbox insert failed for %s, writing to dlq: %v", sms.MessageId, err)
+		if err := ss.dlqRepository.InsertDLQ(ctx, acceptedMsg); err != nil {
+			// If DLQ insert fails, log heavily — but do NOT undo billing (billing must remain correct).
+			ss.logger.Error(errors.Wrap(err, "CRITICAL: dlq insert failed"))
+			return err
+		}
 	}
 
-	marshalled, err := json.Marshal(msg)
+	return nil
+}
+
+func acceptedMessage(sms domain.Sms) (domain.KafkaMessage, error) {
+	b, err := json.Marshal(sms)
 	if err != nil {
-		return errors.Wrap(err, "failed to marshal payload")
+		return domain.KafkaMessage{}, errors.Wrap(err, "failed to marshal payload")
 	}
 
-	err = ss.kafkaWriterSmsStatus.WriteMessages(ctx, kafka.Message{
-		Key:   []byte(job.ID),
-		Value: marshalled,
-		Time:  time.Now(),
-	})
+	return domain.KafkaMessage{
+		Key:     strconv.Itoa(sms.CustomerId),
+		Payload: b,
+		Topic:   constant.TopicAccepted,
+	}, nil
+}
+
+func statusMessage(sms domain.Sms, status domain.Status) (domain.KafkaMessage, error) {
+	km, err := domain.NewStatusEvent(sms.ToJob(), status, "").KafkaMessage(constant.TopicStatus)
 	if err != nil {
+		return domain.KafkaMessage{}, errors.Wrap(err, "failed to marshal payload")
+	}
+
+	return km, nil
+}
+
+func (ss *smsService) pushStatus(ctx context.Context, sms domain.Sms, status domain.Status) error {
+	if err := infra.WriteStatusEvent(ctx, ss.kafkaWriterSmsStatus, domain.NewStatusEvent(sms.ToJob(), status, "")); err != nil {
 		return errors.Wrap(err, "failed to write messages")
 	}
 
 	return nil
 }
 
-func (ss *smsService) GetAllSmsLog(ctx context.Context, customerId, limit, offset int) ([]domain.SMSStatus, int64, error) {
-	return ss.smsRepository.GetAllSmsLog(ctx, customerId, limit, offset)
+func (ss *smsService) GetAllSmsLog(ctx context.Context, customerId int, filter domain.SmsLogFilter) ([]domain.SMSStatus, *domain.SmsLogCursor, error) {
+	return ss.smsRepository.GetAllSmsLog(ctx, customerId, filter)
 }
-func (ss *smsService) ViewSmsTimeLine(ctx context.Context, messageId string) ([]domain.SMSStatus, error) {
-	return ss.smsRepository.ViewSmsTimeLine(ctx, messageId)
+func (ss *smsService) ViewSmsTimeLine(ctx context.Context, customerId int, messageId string) ([]domain.SMSStatus, error) {
+	return ss.smsRepository.ViewSmsTimeLine(ctx, customerId, messageId)
 }
@@ -0,0 +1,38 @@
+package status
+
+import (
+	"arvan/message-gateway/internal/domain"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type statusService struct {
+	statusRepository statusRepository
+	logger           *logrus.Logger
+
+	mu sync.Mutex
+	// states holds the last status of the messages seen recently
+	states map[string]messageState
+}
+
+type statusRepository interface {
+	GetLatestStatus(ctx context.Context, messageId string) (domain.Status, error)
+}
+
+type messageState struct {
+	status domain.Status
+	seenAt time.Time
+}
+
+// NewStatusService returns a status service that reads the last status of
+// the messages it has not seen from statusRepository, which may be nil.
+func NewStatusService(statusRepository statusRepository, logger *logrus.Logger) *statusService {
+	return &statusService{
+		statusRepository: statusRepository,
+		logger:           logger,
+		states:           make(map[string]messageState),
+	}
+}
@@ -0,0 +1,82 @@
+package status
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Apply checks that the event moves its message along an allowed transition
+// and remembers the new status. Events have to be applied in the order of
+// their partition. A message whose history is unknown, e.g. after a restart,
+// is checked against its last logged status.
+func (ss *statusService) Apply(ctx context.Context, event domain.StatusEvent) error {
+	if !event.Status.Valid() {
+		return errors.Wrapf(constant.InvalidStatusErr, "%q", event.Status)
+	}
+
+	current, err := ss.current(ctx, event)
+	if err != nil {
+		// the transition can not be checked, the event is kept
+		ss.logger.Warnf("status: last status of %s is unknown: %v", event.ID, err)
+	} else if current != "" && !current.CanTransitionTo(event.Status) {
+		return errors.Wrapf(constant.InvalidStatusTransitionErr, "%s to %s", current, event.Status)
+	}
+
+	ss.mu.Lock()
+	ss.states[event.ID] = messageState{status: event.Status, seenAt: time.Now()}
+	ss.mu.Unlock()
+
+	return nil
+}
+
+// current returns the last status of the message of event, an empty status
+// means it has none.
+func (ss *statusService) current(ctx context.Context, event domain.StatusEvent) (domain.Status, error) {
+	ss.mu.Lock()
+	state, ok := ss.states[event.ID]
+	ss.mu.Unlock()
+	if ok {
+		return state.status, nil
+	}
+
+	// a new message starts with an initial status, without a repository the
+	// messages that were not seen yet are not checked
+	if event.Status.Initial() || ss.statusRepository == nil {
+		return "", nil
+	}
+
+	return ss.statusRepository.GetLatestStatus(ctx, event.ID)
+}
+
+// Run forgets the messages that were not seen for constant.StatusStateTTL
+// until ctx is done.
+func (ss *statusService) Run(ctx context.Context) {
+	ticker := time.NewTicker(constant.StatusStateSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ss.sweep()
+		}
+	}
+}
+
+func (ss *statusService) sweep() {
+	before := time.Now().Add(-constant.StatusStateTTL)
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for id, state := range ss.states {
+		if state.seenAt.Before(before) {
+			delete(ss.states, id)
+		}
+	}
+}
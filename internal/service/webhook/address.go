@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"context"
+	"net"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// publicDialer refuses connections to addresses that are not public. It checks
+// the address actually dialed, so a callback host that resolves differently
+// after registration or a redirect cannot reach internal services.
+var publicDialer = &net.Dialer{
+	Timeout:   constant.WebhookTimeout,
+	KeepAlive: 30 * time.Second,
+	Control: func(_, address string, _ syscall.RawConn) error {
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return errors.Wrapf(err, "invalid webhook address %q", address)
+		}
+		if !publicAddr(addrPort.Addr()) {
+			return errors.Wrapf(constant.WebhookHostNotAllowedErr, "refusing to dial %s", address)
+		}
+		return nil
+	},
+}
+
+// checkHost resolves the host of a callback url and rejects it when any of its
+// addresses is not public.
+func checkHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !publicAddr(addr) {
+			return constant.WebhookHostNotAllowedErr
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, constant.WebhookTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return errors.Wrapf(constant.InvalidWebhookUrlErr, "cannot resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if !publicAddr(addr) {
+			return constant.WebhookHostNotAllowedErr
+		}
+	}
+
+	return nil
+}
+
+// cgnat is the shared address space of carrier-grade NAT, RFC 6598
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddr reports whether addr is a globally routable unicast address, it is
+// false for loopback, link-local (169.254.169.254 included), private, shared
+// and unspecified addresses.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!cgnat.Contains(addr)
+}
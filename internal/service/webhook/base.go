@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type webhookService struct {
+	webhookRepository webhookRepository
+	httpClient        *http.Client
+	logger            *logrus.Logger
+	cache             sync.Map
+}
+
+type webhookRepository interface {
+	UpsertWebhook(ctx context.Context, customerId int, url, secret string) (domain.Webhook, error)
+	GetWebhook(ctx context.Context, customerId int) (domain.Webhook, error)
+	DeleteWebhook(ctx context.Context, customerId int) (int, error)
+	InsertWebhookRetry(ctx context.Context, retry domain.WebhookRetry) error
+	HasWebhookRetries(ctx context.Context, messageId string) (bool, error)
+	ClaimWebhookRetries(ctx context.Context, limit int) ([]domain.WebhookRetry, error)
+	RescheduleWebhookRetry(ctx context.Context, retry domain.WebhookRetry) error
+	DeleteWebhookRetry(ctx context.Context, id int64) error
+	DeadLetterWebhookRetry(ctx context.Context, webhook domain.Webhook, retry domain.WebhookRetry) error
+}
+
+// cachedWebhook keeps the dispatcher from hitting postgres for every status
+// event, webhook is nil for customers without a callback url.
+type cachedWebhook struct {
+	webhook   *domain.Webhook
+	expiresAt time.Time
+}
+
+func NewWebhookService(webhookRepository webhookRepository, logger *logrus.Logger) *webhookService {
+	return &webhookService{
+		webhookRepository: webhookRepository,
+		httpClient: &http.Client{
+			Timeout: constant.WebhookTimeout,
+			Transport: &http.Transport{
+				// no proxy, the dialer must see the address of the callback
+				Proxy:               nil,
+				DialContext:         publicDialer.DialContext,
+				TLSHandshakeTimeout: constant.WebhookTimeout,
+				MaxIdleConnsPerHost: 2,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		logger: logger,
+	}
+}
@@ -0,0 +1,276 @@
+package webhook
+
+import (
+	"arvan/message-gateway/internal/constant"
+	"arvan/message-gateway/internal/domain"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+const (
+	SignatureHeader          = "X-Webhook-Signature"
+	SignatureTimestampHeader = "X-Webhook-Timestamp"
+)
+
+// Register sets the callback url of the customer and generates a new signing
+// secret, which is only returned here. The host of the url must resolve to
+// public addresses only.
+func (ws *webhookService) Register(ctx context.Context, customerId int, callbackUrl string) (domain.Webhook, error) {
+	u, err := url.ParseRequestURI(callbackUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return domain.Webhook{}, constant.InvalidWebhookUrlErr
+	}
+	if err := checkHost(ctx, u.Hostname()); err != nil {
+		return domain.Webhook{}, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return domain.Webhook{}, errors.Wrap(err, "failed to generate webhook secret")
+	}
+
+	return ws.webhookRepository.UpsertWebhook(ctx, customerId, callbackUrl, hex.EncodeToString(secret))
+}
+
+func (ws *webhookService) GetWebhook(ctx context.Context, customerId int) (domain.Webhook, error) {
+	webhook, err := ws.webhookRepository.GetWebhook(ctx, customerId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Webhook{}, constant.WebhookNotFoundErr
+		}
+		return domain.Webhook{}, errors.Wrap(err, "failed to get webhook")
+	}
+
+	// the secret is only shown once at registration
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+func (ws *webhookService) DeleteWebhook(ctx context.Context, customerId int) error {
+	rows, err := ws.webhookRepository.DeleteWebhook(ctx, customerId)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return constant.WebhookNotFoundErr
+	}
+	return nil
+}
+
+// Deliver makes one attempt to post the event to the customer's callback url.
+// An event that fails, or that would overtake an event of its message still
+// waiting for a retry, is stored in webhook_retries and posted again by Retry.
+// Customers without a webhook are skipped. An error means the event was
+// neither delivered nor stored.
+func (ws *webhookService) Deliver(ctx context.Context, event domain.WebhookEvent) error {
+	webhook, err := ws.lookup(ctx, event.CustomerId)
+	if err != nil {
+		return err
+	}
+	if webhook == nil {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal webhook event")
+	}
+
+	retry := domain.WebhookRetry{
+		CustomerId:    event.CustomerId,
+		MessageId:     event.MessageId,
+		Payload:       payload,
+		NextAttemptAt: time.Now(),
+	}
+
+	waiting, err := ws.webhookRepository.HasWebhookRetries(ctx, event.MessageId)
+	if err != nil {
+		return err
+	}
+	if waiting {
+		return ws.webhookRepository.InsertWebhookRetry(ctx, retry)
+	}
+
+	err = ws.post(ctx, *webhook, payload)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	ws.logger.Warnf("webhook: delivery of %s to customer %d failed, attempt 1: %v", event.MessageId, event.CustomerId, err)
+
+	retry.AttemptCount = 1
+	retry.LastError = err.Error()
+	retry.NextAttemptAt = time.Now().Add(retryBackoff(retry.AttemptCount))
+	return ws.webhookRepository.InsertWebhookRetry(ctx, retry)
+}
+
+// Retry posts the events of webhook_retries that are due until ctx is done.
+// The claimed events are posted concurrently, a dead callback url only holds
+// up the events of its own messages. Events that still fail after
+// constant.WebhookMaxAttempts are moved to the webhook dead letter table.
+func (ws *webhookService) Retry(ctx context.Context) {
+	ticker := time.NewTicker(constant.WebhookRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				retried, err := ws.retryDue(ctx)
+				if err != nil {
+					ws.logger.Errorf("webhook: retry failed: %v", err)
+					break
+				}
+				if retried < constant.WebhookRetryBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+func (ws *webhookService) retryDue(ctx context.Context) (int, error) {
+	retries, err := ws.webhookRepository.ClaimWebhookRetries(ctx, constant.WebhookRetryBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, retry := range retries {
+		wg.Add(1)
+		go func(retry domain.WebhookRetry) {
+			defer wg.Done()
+			ws.retry(ctx, retry)
+		}(retry)
+	}
+	wg.Wait()
+
+	return len(retries), nil
+}
+
+// retry posts a claimed event once. A row that can not be settled keeps its
+// lease and is claimed again once the lease expires.
+func (ws *webhookService) retry(ctx context.Context, retry domain.WebhookRetry) {
+	webhook, err := ws.lookup(ctx, retry.CustomerId)
+	if err != nil {
+		ws.logger.Errorf("webhook: retry of %s failed: %v", retry.MessageId, err)
+		return
+	}
+	if webhook == nil {
+		// the customer removed the webhook since
+		if err := ws.webhookRepository.DeleteWebhookRetry(ctx, retry.ID); err != nil {
+			ws.logger.Errorf("webhook: %v", err)
+		}
+		return
+	}
+
+	err = ws.post(ctx, *webhook, retry.Payload)
+	if err == nil {
+		if err := ws.webhookRepository.DeleteWebhookRetry(ctx, retry.ID); err != nil {
+			ws.logger.Errorf("webhook: %v", err)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	retry.AttemptCount++
+	retry.LastError = err.Error()
+	ws.logger.Warnf("webhook: delivery of %s to customer %d failed, attempt %d: %v", retry.MessageId, retry.CustomerId, retry.AttemptCount, err)
+
+	if retry.AttemptCount >= constant.WebhookMaxAttempts {
+		if err := ws.webhookRepository.DeadLetterWebhookRetry(ctx, *webhook, retry); err != nil {
+			ws.logger.Errorf("webhook: %v", err)
+		}
+		return
+	}
+
+	retry.NextAttemptAt = time.Now().Add(retryBackoff(retry.AttemptCount))
+	if err := ws.webhookRepository.RescheduleWebhookRetry(ctx, retry); err != nil {
+		ws.logger.Errorf("webhook: %v", err)
+	}
+}
+
+// retryBackoff doubles constant.WebhookRetryBackoff with every failed attempt.
+func retryBackoff(attempts int) time.Duration {
+	return constant.WebhookRetryBackoff * time.Duration(1<<(attempts-1))
+}
+
+func (ws *webhookService) post(ctx context.Context, webhook domain.Webhook, payload []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrap(err, "failed to create webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureTimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(webhook.Secret, timestamp, payload))
+
+	resp, err := ws.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of "timestamp.payload", receivers
+// recompute it with their secret to verify a callback.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (ws *webhookService) lookup(ctx context.Context, customerId int) (*domain.Webhook, error) {
+	if value, ok := ws.cache.Load(customerId); ok {
+		cached := value.(cachedWebhook)
+		if time.Now().Before(cached.expiresAt) {
+			return cached.webhook, nil
+		}
+	}
+
+	var found *domain.Webhook
+	webhook, err := ws.webhookRepository.GetWebhook(ctx, customerId)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.Wrap(err, "failed to get webhook")
+		}
+	} else {
+		found = &webhook
+	}
+
+	ws.cache.Store(customerId, cachedWebhook{
+		webhook:   found,
+		expiresAt: time.Now().Add(constant.WebhookCacheTTL),
+	})
+
+	return found, nil
+}
@@ -1,8 +1,10 @@
 package worker
 
 import (
+	"arvan/message-gateway/internal/config"
 	"arvan/message-gateway/internal/domain"
 	"arvan/message-gateway/internal/provider"
+	"context"
 	"github.com/segmentio/kafka-go"
 	"sync"
 )
@@ -14,6 +16,21 @@ type WorkerPool struct {
 	wg         sync.WaitGroup
 
 	kafkaSmsStatusWriter *kafka.Writer
+
+	delivery config.Delivery
+	refunder refunder
+	receipts receiptTracker
+}
+
+// receiptTracker records the provider message ids of sent jobs so their
+// delivery receipts can be resolved.
+type receiptTracker interface {
+	Track(ctx context.Context, message domain.ProviderMessage) error
+}
+
+// refunder refunds failed jobs according to the refund policy
+type refunder interface {
+	RefundFailed(ctx context.Context, job domain.Job, status domain.Status)
 }
 
 func NewWorkerPool(
@@ -21,11 +38,17 @@ func NewWorkerPool(
 	prov provider.SMSProvider,
 	numWorkers int,
 	kafkaSmsStatusWriter *kafka.Writer,
+	delivery config.Delivery,
+	refunder refunder,
+	receipts receiptTracker,
 ) *WorkerPool {
 	return &WorkerPool{
 		qm:                   qm,
 		provider:             prov,
 		numWorkers:           numWorkers,
 		kafkaSmsStatusWriter: kafkaSmsStatusWriter,
+		delivery:             delivery,
+		refunder:             refunder,
+		receipts:             receipts,
 	}
 }
@@ -1,10 +1,11 @@
 package worker
 
 import (
+	"arvan/message-gateway/internal/constant"
 	"arvan/message-gateway/internal/domain"
+	"arvan/message-gateway/internal/infra"
+	"arvan/message-gateway/internal/provider"
 	"context"
-	"encoding/json"
-	"github.com/segmentio/kafka-go"
 	log "github.com/sirupsen/logrus"
 	"time"
 )
@@ -41,49 +42,141 @@ func (p *WorkerPool) worker(ctx context.Context, id int) {
 		}
 
 		// Process the job
+		job = p.markSending(ctx, job)
 		err = p.processJob(ctx, job)
-		if err != nil {
-			// requeue again for customer
-			// probably couldn't queue for analysis
-			err = p.qm.Enqueue(customerID, job)
-			if err != nil {
-				log.Printf("worker %d: enqueue job failed", id)
-			}
-			p.qm.UnlockCustomer(customerID)
-			continue
-		}
+		p.settle(ctx, customerID, job, err)
 
 		// Unlock the customer (allow other workers to process)
 		p.qm.UnlockCustomer(customerID)
 	}
 }
 
+// processJob only returns provider errors, the job is not sent again when
+// publishing its status fails.
 func (p *WorkerPool) processJob(ctx context.Context, job domain.Job) error {
-	err := p.provider.Send(job)
+	sendCtx, cancel := context.WithTimeout(ctx, constant.ProviderSendTimeout)
+	defer cancel()
+
+	result, err := p.provider.Send(sendCtx, job)
 	if err != nil {
 		return err
 	}
+	log.Debugf("worker: job %s accepted by provider as %s (%d segments)", job.ID, result.ProviderMessageID, result.Segments)
 
-	msg := struct {
-		domain.Job `json:",inline"`
-		Status     string `json:"status"`
-	}{
-		job,
-		"success",
+	// the message is tracked before sent is published, a receipt of a message
+	// that is published as sent can always be resolved. A receipt that is
+	// faster than the publish is accepted from sending.
+	if err := p.receipts.Track(ctx, domain.ProviderMessage{
+		Provider:          result.Provider,
+		ProviderMessageID: result.ProviderMessageID,
+		MessageID:         job.ID,
+		CustomerID:        job.CustomerID,
+		Phone:             job.Phone,
+		Priority:          job.Priority,
+		CreatedAt:         job.CreatedAt,
+		SentAt:            result.AcceptedAt,
+	}); err != nil {
+		log.Printf("worker: tracking provider message of %s failed: %v", job.ID, err)
 	}
 
-	marshalled, err := json.Marshal(msg)
-	if err != nil {
-		return err
+	sent := domain.NewStatusEvent(job, domain.StatusSent, "")
+	sent.Provider = result.Provider
+	sent.Segments = result.Segments
+	sent.Cost = result.Cost
+	if err := p.publish(ctx, sent); err != nil {
+		log.Printf("worker: publish sent status of %s failed: %v", job.ID, err)
 	}
 
-	if err = p.kafkaSmsStatusWriter.WriteMessages(ctx, kafka.Message{
-		Key:   []byte(job.ID),
-		Value: marshalled,
-		Time:  time.Now(),
-	}); err != nil {
-		return err
+	return nil
+}
+
+// settle acts on the class of a send error. Permanent errors fail the job
+// right away, throttled jobs are queued again with a retry time without using
+// up an attempt and other errors are retried until the max attempts. The
+// worker never waits for a throttled job, it takes the next one right away.
+func (p *WorkerPool) settle(ctx context.Context, customerID int, job domain.Job, err error) {
+	if err == nil {
+		complete(job)
+		return
 	}
 
-	return nil
+	job.NotBefore = time.Time{}
+	switch provider.Classify(err) {
+	case provider.Permanent:
+		p.fail(ctx, job, err)
+		complete(job)
+		return
+	case provider.Throttled:
+		backoff := provider.RetryAfter(err)
+		if backoff <= 0 {
+			backoff = constant.ProviderThrottleBackoff
+		}
+		job.NotBefore = time.Now().Add(backoff)
+		// report the first delay, the job is sending again when it is taken
+		// from the queue
+		if job.Throttles == 0 {
+			if err := p.publishStatus(ctx, job, domain.StatusThrottled, err.Error()); err != nil {
+				log.Printf("worker: publish throttled status of %s failed: %v", job.ID, err)
+			}
+			job.Status = domain.StatusThrottled
+		}
+		job.Throttles++
+	default:
+		job.Attempts++
+		if job.Attempts >= p.delivery.MaxAttempts {
+			p.fail(ctx, job, err)
+			complete(job)
+			return
+		}
+	}
+
+	// requeue again for customer
+	if err := p.qm.Enqueue(customerID, job); err != nil {
+		log.Printf("worker: enqueue job %s failed: %v", job.ID, err)
+		complete(job)
+	}
+}
+
+// complete reports the terminal outcome of a job to whoever queued it
+func complete(job domain.Job) {
+	if job.Done != nil {
+		job.Done()
+	}
+}
+
+// fail marks a job that ran out of attempts as failed and refunds it when the
+// refund policy says so.
+func (p *WorkerPool) fail(ctx context.Context, job domain.Job, cause error) {
+	log.Printf("worker: job %s failed after %d attempts: %v", job.ID, job.Attempts, cause)
+
+	failed := domain.NewStatusEvent(job, domain.StatusFailed, cause.Error())
+	failed.ErrorCode = provider.ErrorCode(cause)
+	if err := p.publish(ctx, failed); err != nil {
+		log.Printf("worker: publish failed status of %s failed: %v", job.ID, err)
+	}
+
+	p.refunder.RefundFailed(ctx, job, domain.StatusFailed)
+}
+
+// markSending publishes that the job is handed to a provider, retries of a
+// job that is already sending are not published again.
+func (p *WorkerPool) markSending(ctx context.Context, job domain.Job) domain.Job {
+	if job.Status == domain.StatusSending {
+		return job
+	}
+
+	if err := p.publishStatus(ctx, job, domain.StatusSending, ""); err != nil {
+		log.Printf("worker: publish sending status of %s failed: %v", job.ID, err)
+	}
+	job.Status = domain.StatusSending
+
+	return job
+}
+
+func (p *WorkerPool) publishStatus(ctx context.Context, job domain.Job, status domain.Status, reason string) error {
+	return p.publish(ctx, domain.NewStatusEvent(job, status, reason))
+}
+
+func (p *WorkerPool) publish(ctx context.Context, event domain.StatusEvent) error {
+	return infra.WriteStatusEvent(ctx, p.kafkaSmsStatusWriter, event)
 }
@@ -0,0 +1,10 @@
+DROP VIEW IF EXISTS sms_latest_status_mv;
+DROP TABLE IF EXISTS sms_latest_status;
+ALTER TABLE sms_status_log DROP PROJECTION IF EXISTS sms_status_log_by_id;
+ALTER TABLE sms_status_log
+    DROP COLUMN IF EXISTS event_time,
+    DROP COLUMN IF EXISTS attempt,
+    DROP COLUMN IF EXISTS cost,
+    DROP COLUMN IF EXISTS segments,
+    DROP COLUMN IF EXISTS error_code,
+    DROP COLUMN IF EXISTS provider;
@@ -0,0 +1,74 @@
+ALTER TABLE sms_status_log
+    ADD COLUMN IF NOT EXISTS provider LowCardinality(String) DEFAULT '',
+    ADD COLUMN IF NOT EXISTS error_code String DEFAULT '',
+    ADD COLUMN IF NOT EXISTS segments UInt16 DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS cost Int64 DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS attempt UInt16 DEFAULT 0,
+    -- timestamp only has seconds, the events of a message are ordered by event_time
+    ADD COLUMN IF NOT EXISTS event_time DateTime64(3) DEFAULT timestamp;
+
+-- timeline lookups by message id
+ALTER TABLE sms_status_log ADD PROJECTION IF NOT EXISTS sms_status_log_by_id
+(
+    SELECT * ORDER BY id, event_time
+);
+ALTER TABLE sms_status_log MATERIALIZE PROJECTION sms_status_log_by_id;
+
+-- one row per message after merges, read it with the -Merge combinators and
+-- GROUP BY since parts are merged in the background. Later events, e.g.
+-- delivery receipts, do not repeat the provider, cost or text of the message,
+-- so the columns are aggregated instead of replaced.
+CREATE TABLE IF NOT EXISTS sms_latest_status
+(
+    customer_id Int32,
+    created_at  DateTime,
+    id          String,
+    phone       SimpleAggregateFunction(any, String),
+    message     SimpleAggregateFunction(max, String),
+    priority    SimpleAggregateFunction(max, Int32),
+    status      AggregateFunction(argMax, String, DateTime64(3)),
+    error_code  AggregateFunction(argMax, String, DateTime64(3)),
+    provider    SimpleAggregateFunction(max, String),
+    segments    SimpleAggregateFunction(max, UInt16),
+    cost        SimpleAggregateFunction(max, Int64),
+    attempt     SimpleAggregateFunction(max, UInt16),
+    timestamp   SimpleAggregateFunction(max, DateTime64(3))
+) ENGINE = AggregatingMergeTree()
+    PARTITION BY toYYYYMM(created_at)
+    ORDER BY (customer_id, created_at, id)
+    TTL created_at + INTERVAL 90 DAY;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS sms_latest_status_mv TO sms_latest_status AS
+SELECT customer_id,
+       created_at,
+       id,
+       any(phone)                          AS phone,
+       max(message)                        AS message,
+       max(priority)                       AS priority,
+       argMaxState(status, event_time)     AS status,
+       argMaxState(error_code, event_time) AS error_code,
+       max(provider)                       AS provider,
+       max(segments)                       AS segments,
+       max(cost)                           AS cost,
+       max(attempt)                        AS attempt,
+       max(event_time)                     AS timestamp
+FROM sms_status_log
+GROUP BY customer_id, created_at, id;
+
+-- messages logged before the view existed
+INSERT INTO sms_latest_status
+SELECT customer_id,
+       created_at,
+       id,
+       any(phone),
+       max(message),
+       max(priority),
+       argMaxState(status, event_time),
+       argMaxState(error_code, event_time),
+       max(provider),
+       max(segments),
+       max(cost),
+       max(attempt),
+       max(event_time)
+FROM sms_status_log
+GROUP BY customer_id, created_at, id;
@@ -0,0 +1,19 @@
+DROP VIEW IF EXISTS sms_latest_status_mv;
+CREATE MATERIALIZED VIEW IF NOT EXISTS sms_latest_status_mv TO sms_latest_status AS
+SELECT customer_id,
+       created_at,
+       id,
+       any(phone)                          AS phone,
+       max(message)                        AS message,
+       max(priority)                       AS priority,
+       argMaxState(status, event_time)     AS status,
+       argMaxState(error_code, event_time) AS error_code,
+       max(provider)                       AS provider,
+       max(segments)                       AS segments,
+       max(cost)                           AS cost,
+       max(attempt)                        AS attempt,
+       max(event_time)                     AS timestamp
+FROM sms_status_log
+GROUP BY customer_id, created_at, id;
+ALTER TABLE sms_latest_status DROP COLUMN IF EXISTS reason;
+ALTER TABLE sms_status_log DROP COLUMN IF EXISTS reason;
@@ -0,0 +1,26 @@
+ALTER TABLE sms_status_log
+    ADD COLUMN IF NOT EXISTS reason String DEFAULT '' AFTER error_code;
+
+-- the reason of the current status, e.g. the provider limit of a throttled
+-- message or the stat of an undelivered one
+ALTER TABLE sms_latest_status
+    ADD COLUMN IF NOT EXISTS reason AggregateFunction(argMax, String, DateTime64(3)) AFTER error_code;
+
+DROP VIEW IF EXISTS sms_latest_status_mv;
+CREATE MATERIALIZED VIEW IF NOT EXISTS sms_latest_status_mv TO sms_latest_status AS
+SELECT customer_id,
+       created_at,
+       id,
+       any(phone)                          AS phone,
+       max(message)                        AS message,
+       max(priority)                       AS priority,
+       argMaxState(status, event_time)     AS status,
+       argMaxState(error_code, event_time) AS error_code,
+       argMaxState(reason, event_time)     AS reason,
+       max(provider)                       AS provider,
+       max(segments)                       AS segments,
+       max(cost)                           AS cost,
+       max(attempt)                        AS attempt,
+       max(event_time)                     AS timestamp
+FROM sms_status_log
+GROUP BY customer_id, created_at, id;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS webhook_dlq;
+DROP TABLE IF EXISTS webhooks;
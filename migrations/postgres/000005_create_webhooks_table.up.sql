@@ -0,0 +1,22 @@
+CREATE TABLE webhooks
+(
+    customer_id BIGINT PRIMARY KEY,
+    url         TEXT        NOT NULL,
+    secret      TEXT        NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE webhook_dlq
+(
+    id            BIGSERIAL PRIMARY KEY,
+    customer_id   BIGINT      NOT NULL,
+    message_id    TEXT        NOT NULL,
+    url           TEXT        NOT NULL,
+    payload       JSONB       NOT NULL,
+    attempt_count INT         NOT NULL DEFAULT 0,
+    last_error    TEXT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_webhook_dlq_customer_id ON webhook_dlq (customer_id);
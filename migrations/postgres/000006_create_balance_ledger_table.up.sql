@@ -0,0 +1,15 @@
+CREATE TABLE balance_ledger
+(
+    id          BIGSERIAL PRIMARY KEY,
+    customer_id BIGINT      NOT NULL,
+    message_id  TEXT        NOT NULL,
+    amount      BIGINT      NOT NULL,
+    reason      TEXT        NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- set once the amount is given back in redis
+    credited_at TIMESTAMPTZ
+);
+
+-- a message is refunded at most once, whatever the reason
+CREATE UNIQUE INDEX idx_balance_ledger_message_id ON balance_ledger (message_id);
+CREATE INDEX idx_balance_ledger_customer_id ON balance_ledger (customer_id);
@@ -0,0 +1,15 @@
+CREATE TABLE outbox
+(
+    id         BIGSERIAL PRIMARY KEY,
+    topic      TEXT        NOT NULL,
+    key        TEXT        NOT NULL,
+    payload    JSONB       NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    sent_at    TIMESTAMPTZ NULL,
+    -- leased by a relay that is publishing the row
+    claimed_until TIMESTAMPTZ NULL
+);
+
+-- the relay only scans rows that are not published yet
+CREATE INDEX idx_outbox_unsent ON outbox (id) WHERE sent_at IS NULL;
+CREATE INDEX idx_outbox_sent_at ON outbox (sent_at) WHERE sent_at IS NOT NULL;
@@ -0,0 +1,17 @@
+CREATE TABLE provider_messages
+(
+    provider            TEXT        NOT NULL,
+    provider_message_id TEXT        NOT NULL,
+    message_id          TEXT        NOT NULL,
+    customer_id         BIGINT      NOT NULL,
+    phone               TEXT        NOT NULL,
+    priority            INT         NOT NULL,
+    created_at          TIMESTAMPTZ NOT NULL,
+    sent_at             TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- set by the first final delivery receipt, later receipts are duplicates
+    final_status        TEXT        NULL,
+    final_at            TIMESTAMPTZ NULL,
+    PRIMARY KEY (provider, provider_message_id)
+);
+
+CREATE INDEX idx_provider_messages_message_id ON provider_messages (message_id);
@@ -0,0 +1,14 @@
+-- the keys of plans.api_key are not copied, they belong to no customer. They
+-- are only accepted with AUTH_LEGACY_PLAN_KEYS while customers move to keys
+-- of their own.
+CREATE TABLE api_keys
+(
+    id          BIGSERIAL PRIMARY KEY,
+    customer_id BIGINT      NOT NULL,
+    plan_id     BIGINT      NOT NULL REFERENCES plans (id),
+    -- sha256 of the key, the key itself is never stored
+    key_hash    TEXT        NOT NULL UNIQUE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_api_keys_customer_id ON api_keys (customer_id);
@@ -0,0 +1,12 @@
+-- salted keys cannot be checked without their salt
+DELETE FROM api_keys WHERE salt <> '';
+
+ALTER TABLE api_keys ADD CONSTRAINT api_keys_key_hash_key UNIQUE (key_hash);
+ALTER TABLE api_keys DROP CONSTRAINT api_keys_key_id_key;
+
+ALTER TABLE api_keys
+    DROP COLUMN key_id,
+    DROP COLUMN salt,
+    DROP COLUMN label,
+    DROP COLUMN updated_at,
+    DROP COLUMN revoked_at;
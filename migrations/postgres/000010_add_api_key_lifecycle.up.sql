@@ -0,0 +1,14 @@
+ALTER TABLE api_keys
+    ADD COLUMN key_id     TEXT,
+    -- hashed in front of the secret, empty for keys issued before salting
+    ADD COLUMN salt       TEXT        NOT NULL DEFAULT '',
+    ADD COLUMN label      TEXT        NOT NULL DEFAULT '',
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN revoked_at TIMESTAMPTZ NULL;
+
+-- keys issued before salting are found by their unsalted hash
+UPDATE api_keys SET key_id = key_hash;
+
+ALTER TABLE api_keys ALTER COLUMN key_id SET NOT NULL;
+ALTER TABLE api_keys ADD CONSTRAINT api_keys_key_id_key UNIQUE (key_id);
+ALTER TABLE api_keys DROP CONSTRAINT api_keys_key_hash_key;
@@ -0,0 +1 @@
+ALTER TABLE kafka_dlq DROP COLUMN claimed_until;
@@ -0,0 +1,3 @@
+-- a replica leases the rows it republishes instead of locking them while
+-- writing to kafka
+ALTER TABLE kafka_dlq ADD COLUMN claimed_until TIMESTAMPTZ NULL;
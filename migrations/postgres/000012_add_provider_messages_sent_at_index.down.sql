@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_provider_messages_sent_at;
@@ -0,0 +1,2 @@
+-- old mappings are purged by sent_at once carriers stopped reporting on them
+CREATE INDEX idx_provider_messages_sent_at ON provider_messages (sent_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_balance_ledger_uncredited;
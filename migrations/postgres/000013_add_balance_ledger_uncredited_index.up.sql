@@ -0,0 +1,2 @@
+-- the refund reconciler looks for the rows that were recorded but not credited
+CREATE INDEX idx_balance_ledger_uncredited ON balance_ledger (created_at) WHERE credited_at IS NULL;
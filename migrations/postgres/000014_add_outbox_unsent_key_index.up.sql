@@ -0,0 +1,2 @@
+-- a relay looks for older unsent rows of the same key before it claims a row
+CREATE INDEX idx_outbox_unsent_key ON outbox (topic, key, id) WHERE sent_at IS NULL;
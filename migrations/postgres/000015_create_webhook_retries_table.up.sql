@@ -0,0 +1,18 @@
+-- webhook events whose delivery failed wait here for their next attempt, the
+-- later events of their message wait behind them
+CREATE TABLE webhook_retries
+(
+    id              BIGSERIAL PRIMARY KEY,
+    customer_id     BIGINT      NOT NULL,
+    message_id      TEXT        NOT NULL,
+    payload         JSONB       NOT NULL,
+    attempt_count   INT         NOT NULL DEFAULT 0,
+    last_error      TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- leased by a dispatcher that is posting the event
+    claimed_until   TIMESTAMPTZ NULL
+);
+
+CREATE INDEX idx_webhook_retries_message_id ON webhook_retries (message_id, id);
+CREATE INDEX idx_webhook_retries_next_attempt_at ON webhook_retries (next_attempt_at);
@@ -0,0 +1,298 @@
+package smpp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrNotBound        = errors.New("smpp: session is not bound")
+	ErrResponseTimeout = errors.New("smpp: response timeout")
+	ErrClosed          = errors.New("smpp: connection closed")
+	errUnbound         = errors.New("smpp: unbound by smsc")
+)
+
+// StatusError is a response with a non zero command_status.
+type StatusError struct {
+	CommandID uint32
+	Status    uint32
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("smpp: command 0x%08X failed with status 0x%08X", e.CommandID, e.Status)
+}
+
+type Config struct {
+	Addr       string
+	SystemID   string
+	Password   string
+	SystemType string
+	// EnquireLinkInterval is how often the session is checked when idle
+	EnquireLinkInterval time.Duration
+	ResponseTimeout     time.Duration
+	ReconnectDelay      time.Duration
+	// Window is the number of submit_sm waiting for their response at once
+	Window int
+}
+
+// Client keeps a transceiver session bound to the SMSC and binds again
+// whenever the connection drops or the SMSC unbinds.
+type Client struct {
+	cfg       Config
+	onDeliver func(ShortMessage)
+	logger    *logrus.Logger
+
+	mu      sync.Mutex
+	conn    net.Conn
+	bound   bool
+	seq     uint32
+	pending map[uint32]chan PDU
+
+	writeMu sync.Mutex
+	window  chan struct{}
+}
+
+// NewClient returns a client that passes every deliver_sm to onDeliver. The
+// session is opened by Run.
+func NewClient(cfg Config, onDeliver func(ShortMessage), logger *logrus.Logger) *Client {
+	if cfg.Window <= 0 {
+		cfg.Window = 1
+	}
+
+	return &Client{
+		cfg:       cfg,
+		onDeliver: onDeliver,
+		logger:    logger,
+		pending:   make(map[uint32]chan PDU),
+		window:    make(chan struct{}, cfg.Window),
+	}
+}
+
+// Run binds the session and keeps it bound until ctx is done, then unbinds.
+func (c *Client) Run(ctx context.Context) {
+	for {
+		err := c.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.logger.Warnf("smpp: session to %s ended: %v, reconnecting in %s", c.cfg.Addr, err, c.cfg.ReconnectDelay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.cfg.ReconnectDelay):
+		}
+	}
+}
+
+// Submit sends a submit_sm and returns the message id given by the SMSC. At
+// most Window submits wait for their response at the same time.
+func (c *Client) Submit(ctx context.Context, sm ShortMessage) (string, error) {
+	c.mu.Lock()
+	bound := c.bound
+	c.mu.Unlock()
+	if !bound {
+		return "", ErrNotBound
+	}
+
+	select {
+	case c.window <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-c.window }()
+
+	resp, err := c.request(ctx, SubmitSM, sm.Marshal())
+	if err != nil {
+		return "", err
+	}
+
+	return ParseCString(resp.Body)
+}
+
+func (c *Client) session(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.cfg.Addr)
+	if err != nil {
+		return errors.Wrap(err, "failed to dial smsc")
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	defer c.teardown(conn)
+
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- c.readLoop(conn)
+	}()
+
+	if _, err := c.request(ctx, BindTransceiver, Bind{
+		SystemID:         c.cfg.SystemID,
+		Password:         c.cfg.Password,
+		SystemType:       c.cfg.SystemType,
+		InterfaceVersion: InterfaceVersion,
+	}.Marshal()); err != nil {
+		return errors.Wrap(err, "bind_transceiver failed")
+	}
+
+	c.mu.Lock()
+	c.bound = true
+	c.mu.Unlock()
+	c.logger.Infof("smpp: bound as transceiver to %s", c.cfg.Addr)
+
+	ticker := time.NewTicker(c.cfg.EnquireLinkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.mu.Lock()
+			c.bound = false
+			c.mu.Unlock()
+
+			unbindCtx, cancel := context.WithTimeout(context.Background(), c.cfg.ResponseTimeout)
+			if _, err := c.request(unbindCtx, Unbind, nil); err != nil {
+				c.logger.Warnf("smpp: unbind failed: %v", err)
+			}
+			cancel()
+			return nil
+		case err := <-readErr:
+			return err
+		case <-ticker.C:
+			if _, err := c.request(ctx, EnquireLink, nil); err != nil {
+				return errors.Wrap(err, "enquire_link failed")
+			}
+		}
+	}
+}
+
+// teardown closes the connection and fails every request still waiting for a response.
+func (c *Client) teardown(conn net.Conn) {
+	_ = conn.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn = nil
+	c.bound = false
+	for seq, ch := range c.pending {
+		close(ch)
+		delete(c.pending, seq)
+	}
+}
+
+func (c *Client) readLoop(conn net.Conn) error {
+	for {
+		pdu, err := ReadPDU(conn)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case pdu.CommandID&Resp != 0:
+			c.resolve(pdu)
+		case pdu.CommandID == EnquireLink:
+			err = c.write(conn, PDU{CommandID: EnquireLink | Resp, Sequence: pdu.Sequence})
+		case pdu.CommandID == DeliverSM:
+			err = c.deliver(conn, pdu)
+		case pdu.CommandID == Unbind:
+			_ = c.write(conn, PDU{CommandID: Unbind | Resp, Sequence: pdu.Sequence})
+			return errUnbound
+		default:
+			err = c.write(conn, PDU{CommandID: GenericNack, Status: StatusInvCmdID, Sequence: pdu.Sequence})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) deliver(conn net.Conn, pdu PDU) error {
+	sm, err := UnmarshalShortMessage(pdu.Body)
+	if err != nil {
+		c.logger.Warnf("smpp: invalid deliver_sm: %v", err)
+		return c.write(conn, PDU{CommandID: DeliverSM | Resp, Status: StatusSysErr, Sequence: pdu.Sequence, Body: CString("")})
+	}
+
+	if c.onDeliver != nil {
+		go c.onDeliver(sm)
+	}
+
+	return c.write(conn, PDU{CommandID: DeliverSM | Resp, Sequence: pdu.Sequence, Body: CString("")})
+}
+
+// resolve hands a response to the request waiting for its sequence number.
+func (c *Client) resolve(pdu PDU) {
+	c.mu.Lock()
+	ch, ok := c.pending[pdu.Sequence]
+	delete(c.pending, pdu.Sequence)
+	c.mu.Unlock()
+
+	if ok {
+		ch <- pdu
+	}
+}
+
+func (c *Client) request(ctx context.Context, commandID uint32, body []byte) (PDU, error) {
+	ch := make(chan PDU, 1)
+
+	c.mu.Lock()
+	conn := c.conn
+	if conn == nil {
+		c.mu.Unlock()
+		return PDU{}, ErrNotBound
+	}
+	// sequence numbers run from 1 to 0x7FFFFFFF
+	c.seq = c.seq%0x7FFFFFFF + 1
+	seq := c.seq
+	c.pending[seq] = ch
+	c.mu.Unlock()
+
+	if err := c.write(conn, PDU{CommandID: commandID, Sequence: seq, Body: body}); err != nil {
+		c.forget(seq)
+		return PDU{}, errors.Wrap(err, "failed to write pdu")
+	}
+
+	timer := time.NewTimer(c.cfg.ResponseTimeout)
+	defer timer.Stop()
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return PDU{}, ErrClosed
+		}
+		if resp.Status != StatusOK {
+			return resp, StatusError{CommandID: commandID, Status: resp.Status}
+		}
+		return resp, nil
+	case <-ctx.Done():
+		c.forget(seq)
+		return PDU{}, ctx.Err()
+	case <-timer.C:
+		c.forget(seq)
+		return PDU{}, ErrResponseTimeout
+	}
+}
+
+func (c *Client) forget(seq uint32) {
+	c.mu.Lock()
+	delete(c.pending, seq)
+	c.mu.Unlock()
+}
+
+func (c *Client) write(conn net.Conn, pdu PDU) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(c.cfg.ResponseTimeout)); err != nil {
+		return err
+	}
+	return WritePDU(conn, pdu)
+}
@@ -0,0 +1,344 @@
+// Package smpp implements the subset of SMPP 3.4 needed to submit messages to
+// an SMSC over a transceiver session and receive their delivery receipts.
+package smpp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// command ids
+const (
+	GenericNack     uint32 = 0x80000000
+	BindReceiver    uint32 = 0x00000001
+	BindTransmitter uint32 = 0x00000002
+	SubmitSM        uint32 = 0x00000004
+	DeliverSM       uint32 = 0x00000005
+	Unbind          uint32 = 0x00000006
+	BindTransceiver uint32 = 0x00000009
+	EnquireLink     uint32 = 0x00000015
+
+	// Resp is set on the command id of every response
+	Resp uint32 = 0x80000000
+)
+
+// command status
+const (
+	StatusOK          uint32 = 0x00000000
+	StatusInvMsgLen   uint32 = 0x00000001
+	StatusInvCmdLen   uint32 = 0x00000002
+	StatusInvCmdID    uint32 = 0x00000003
+	StatusInvBndSts   uint32 = 0x00000004
+	StatusAlyBnd      uint32 = 0x00000005
+	StatusSysErr      uint32 = 0x00000008
+	StatusInvSrcAdr   uint32 = 0x0000000A
+	StatusInvDstAdr   uint32 = 0x0000000B
+	StatusBindFail    uint32 = 0x0000000D
+	StatusInvPaswd    uint32 = 0x0000000E
+	StatusInvSysID    uint32 = 0x0000000F
+	StatusMsgQFul     uint32 = 0x00000014
+	StatusInvDstTON   uint32 = 0x00000050
+	StatusInvDstNPI   uint32 = 0x00000051
+	StatusThrottled   uint32 = 0x00000058
+	StatusSubmitFail  uint32 = 0x00000045
+	StatusDeliveryErr uint32 = 0x000000FE
+	StatusUnknownErr  uint32 = 0x000000FF
+)
+
+// optional parameter tags
+const (
+	TagReceiptedMessageID uint16 = 0x001E
+	TagMessagePayload     uint16 = 0x0424
+	TagMessageState       uint16 = 0x0427
+)
+
+// data coding schemes
+const (
+	CodingIA5  byte = 0x01
+	CodingUCS2 byte = 0x08
+)
+
+// InterfaceVersion is sent in the bind request
+const InterfaceVersion byte = 0x34
+
+const (
+	headerLen = 16
+	maxPDULen = 64 * 1024
+	// maxShortMessage is the longest short_message, longer messages are sent
+	// in the message_payload parameter
+	maxShortMessage = 254
+)
+
+type PDU struct {
+	CommandID uint32
+	Status    uint32
+	Sequence  uint32
+	Body      []byte
+}
+
+func ReadPDU(r io.Reader) (PDU, error) {
+	var header [headerLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return PDU{}, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < headerLen || length > maxPDULen {
+		return PDU{}, fmt.Errorf("smpp: invalid command_length %d", length)
+	}
+
+	pdu := PDU{
+		CommandID: binary.BigEndian.Uint32(header[4:8]),
+		Status:    binary.BigEndian.Uint32(header[8:12]),
+		Sequence:  binary.BigEndian.Uint32(header[12:16]),
+		Body:      make([]byte, length-headerLen),
+	}
+	if _, err := io.ReadFull(r, pdu.Body); err != nil {
+		return PDU{}, err
+	}
+
+	return pdu, nil
+}
+
+func WritePDU(w io.Writer, pdu PDU) error {
+	buf := make([]byte, headerLen+len(pdu.Body))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(buf)))
+	binary.BigEndian.PutUint32(buf[4:8], pdu.CommandID)
+	binary.BigEndian.PutUint32(buf[8:12], pdu.Status)
+	binary.BigEndian.PutUint32(buf[12:16], pdu.Sequence)
+	copy(buf[headerLen:], pdu.Body)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// Bind is the body of the bind_transmitter, bind_receiver and bind_transceiver requests.
+type Bind struct {
+	SystemID         string
+	Password         string
+	SystemType       string
+	InterfaceVersion byte
+	AddrTON          byte
+	AddrNPI          byte
+	AddressRange     string
+}
+
+func (b Bind) Marshal() []byte {
+	var w bodyWriter
+	w.cstring(b.SystemID)
+	w.cstring(b.Password)
+	w.cstring(b.SystemType)
+	w.WriteByte(b.InterfaceVersion)
+	w.WriteByte(b.AddrTON)
+	w.WriteByte(b.AddrNPI)
+	w.cstring(b.AddressRange)
+	return w.Bytes()
+}
+
+func UnmarshalBind(body []byte) (Bind, error) {
+	r := bodyReader{b: body}
+	b := Bind{
+		SystemID:         r.cstring(),
+		Password:         r.cstring(),
+		SystemType:       r.cstring(),
+		InterfaceVersion: r.byte(),
+		AddrTON:          r.byte(),
+		AddrNPI:          r.byte(),
+		AddressRange:     r.cstring(),
+	}
+	return b, r.err
+}
+
+// ShortMessage is the body of submit_sm and deliver_sm, they share the layout.
+type ShortMessage struct {
+	ServiceType          string
+	SourceTON            byte
+	SourceNPI            byte
+	SourceAddr           string
+	DestTON              byte
+	DestNPI              byte
+	DestAddr             string
+	ESMClass             byte
+	ProtocolID           byte
+	PriorityFlag         byte
+	ScheduleDeliveryTime string
+	ValidityPeriod       string
+	RegisteredDelivery   byte
+	ReplaceIfPresent     byte
+	DataCoding           byte
+	SMDefaultMsgID       byte
+	Message              []byte
+	// Options holds the optional parameters by tag
+	Options map[uint16][]byte
+}
+
+func (sm ShortMessage) Marshal() []byte {
+	var w bodyWriter
+	w.cstring(sm.ServiceType)
+	w.WriteByte(sm.SourceTON)
+	w.WriteByte(sm.SourceNPI)
+	w.cstring(sm.SourceAddr)
+	w.WriteByte(sm.DestTON)
+	w.WriteByte(sm.DestNPI)
+	w.cstring(sm.DestAddr)
+	w.WriteByte(sm.ESMClass)
+	w.WriteByte(sm.ProtocolID)
+	w.WriteByte(sm.PriorityFlag)
+	w.cstring(sm.ScheduleDeliveryTime)
+	w.cstring(sm.ValidityPeriod)
+	w.WriteByte(sm.RegisteredDelivery)
+	w.WriteByte(sm.ReplaceIfPresent)
+	w.WriteByte(sm.DataCoding)
+	w.WriteByte(sm.SMDefaultMsgID)
+
+	options := sm.Options
+	if len(sm.Message) > maxShortMessage {
+		w.WriteByte(0)
+		options = make(map[uint16][]byte, len(sm.Options)+1)
+		for tag, value := range sm.Options {
+			options[tag] = value
+		}
+		options[TagMessagePayload] = sm.Message
+	} else {
+		w.WriteByte(byte(len(sm.Message)))
+		w.Write(sm.Message)
+	}
+
+	for tag, value := range options {
+		w.option(tag, value)
+	}
+
+	return w.Bytes()
+}
+
+func UnmarshalShortMessage(body []byte) (ShortMessage, error) {
+	r := bodyReader{b: body}
+	sm := ShortMessage{
+		ServiceType:          r.cstring(),
+		SourceTON:            r.byte(),
+		SourceNPI:            r.byte(),
+		SourceAddr:           r.cstring(),
+		DestTON:              r.byte(),
+		DestNPI:              r.byte(),
+		DestAddr:             r.cstring(),
+		ESMClass:             r.byte(),
+		ProtocolID:           r.byte(),
+		PriorityFlag:         r.byte(),
+		ScheduleDeliveryTime: r.cstring(),
+		ValidityPeriod:       r.cstring(),
+		RegisteredDelivery:   r.byte(),
+		ReplaceIfPresent:     r.byte(),
+		DataCoding:           r.byte(),
+		SMDefaultMsgID:       r.byte(),
+	}
+	sm.Message = r.bytes(int(r.byte()))
+	sm.Options = r.options()
+	if r.err != nil {
+		return ShortMessage{}, r.err
+	}
+
+	if len(sm.Message) == 0 {
+		if payload, ok := sm.Options[TagMessagePayload]; ok {
+			sm.Message = payload
+		}
+	}
+
+	return sm, nil
+}
+
+// CString returns a body made of a single C-Octet string, like the message_id
+// of submit_sm_resp or the system_id of a bind response.
+func CString(s string) []byte {
+	var w bodyWriter
+	w.cstring(s)
+	return w.Bytes()
+}
+
+// ParseCString reads the leading C-Octet string of a body.
+func ParseCString(body []byte) (string, error) {
+	r := bodyReader{b: body}
+	s := r.cstring()
+	return s, r.err
+}
+
+type bodyWriter struct {
+	bytes.Buffer
+}
+
+func (w *bodyWriter) cstring(s string) {
+	w.WriteString(s)
+	w.WriteByte(0)
+}
+
+func (w *bodyWriter) option(tag uint16, value []byte) {
+	var header [4]byte
+	binary.BigEndian.PutUint16(header[0:2], tag)
+	binary.BigEndian.PutUint16(header[2:4], uint16(len(value)))
+	w.Write(header[:])
+	w.Write(value)
+}
+
+// bodyReader keeps the first error, the values read after it are zero.
+type bodyReader struct {
+	b   []byte
+	off int
+	err error
+}
+
+var errShortBody = errors.New("smpp: pdu body too short")
+
+func (r *bodyReader) cstring() string {
+	if r.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(r.b[r.off:], 0)
+	if end < 0 {
+		r.err = errShortBody
+		return ""
+	}
+	s := string(r.b[r.off : r.off+end])
+	r.off += end + 1
+	return s
+}
+
+func (r *bodyReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.off >= len(r.b) {
+		r.err = errShortBody
+		return 0
+	}
+	b := r.b[r.off]
+	r.off++
+	return b
+}
+
+func (r *bodyReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if r.off+n > len(r.b) {
+		r.err = errShortBody
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, r.b[r.off:r.off+n])
+	r.off += n
+	return b
+}
+
+func (r *bodyReader) options() map[uint16][]byte {
+	options := make(map[uint16][]byte)
+	for r.err == nil && len(r.b)-r.off >= 4 {
+		tag := binary.BigEndian.Uint16(r.b[r.off : r.off+2])
+		length := int(binary.BigEndian.Uint16(r.b[r.off+2 : r.off+4]))
+		r.off += 4
+		options[tag] = r.bytes(length)
+	}
+	return options
+}
@@ -0,0 +1,318 @@
+package smpp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPDURoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		pdu  PDU
+	}{
+		{
+			name: "header only",
+			pdu:  PDU{CommandID: EnquireLink, Sequence: 7},
+		},
+		{
+			name: "response with status",
+			pdu:  PDU{CommandID: SubmitSM | Resp, Status: StatusThrottled, Sequence: 42},
+		},
+		{
+			name: "with body",
+			pdu:  PDU{CommandID: SubmitSM | Resp, Sequence: 1, Body: CString("msg-1")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WritePDU(&buf, tt.pdu); err != nil {
+				t.Fatalf("WritePDU: %v", err)
+			}
+			if got := binary.BigEndian.Uint32(buf.Bytes()[0:4]); int(got) != headerLen+len(tt.pdu.Body) {
+				t.Fatalf("command_length = %d, want %d", got, headerLen+len(tt.pdu.Body))
+			}
+
+			got, err := ReadPDU(&buf)
+			if err != nil {
+				t.Fatalf("ReadPDU: %v", err)
+			}
+			if got.CommandID != tt.pdu.CommandID || got.Status != tt.pdu.Status || got.Sequence != tt.pdu.Sequence {
+				t.Fatalf("header = %+v, want %+v", got, tt.pdu)
+			}
+			if !bytes.Equal(got.Body, tt.pdu.Body) {
+				t.Fatalf("body = %q, want %q", got.Body, tt.pdu.Body)
+			}
+		})
+	}
+}
+
+func TestReadPDUInvalid(t *testing.T) {
+	header := func(length uint32) []byte {
+		b := make([]byte, headerLen)
+		binary.BigEndian.PutUint32(b[0:4], length)
+		return b
+	}
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "short header", input: []byte{0, 0, 0, 16}},
+		{name: "length below header", input: header(headerLen - 1)},
+		{name: "length above max", input: header(maxPDULen + 1)},
+		{name: "truncated body", input: append(header(headerLen+4), 1, 2)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadPDU(bytes.NewReader(tt.input)); err == nil {
+				t.Fatal("ReadPDU succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestBindRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		bind Bind
+	}{
+		{
+			name: "transceiver",
+			bind: Bind{SystemID: "gateway", Password: "secret", SystemType: "SMS", InterfaceVersion: InterfaceVersion, AddrTON: 1, AddrNPI: 1, AddressRange: "98*"},
+		},
+		{
+			name: "empty strings",
+			bind: Bind{InterfaceVersion: InterfaceVersion},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnmarshalBind(tt.bind.Marshal())
+			if err != nil {
+				t.Fatalf("UnmarshalBind: %v", err)
+			}
+			if got != tt.bind {
+				t.Fatalf("bind = %+v, want %+v", got, tt.bind)
+			}
+		})
+	}
+}
+
+func TestShortMessageRoundTrip(t *testing.T) {
+	long := []byte(strings.Repeat("a", maxShortMessage+1))
+
+	tests := []struct {
+		name string
+		sm   ShortMessage
+		// wantOptions are the options expected after decoding, nil means the
+		// ones of sm
+		wantOptions map[uint16][]byte
+	}{
+		{
+			name: "short message",
+			sm: ShortMessage{
+				SourceTON: 5, SourceAddr: "gateway", DestTON: 1, DestNPI: 1, DestAddr: "989121234567",
+				RegisteredDelivery: 1, DataCoding: CodingIA5, Message: []byte("hello"),
+				Options: map[uint16][]byte{},
+			},
+		},
+		{
+			name: "empty message",
+			sm:   ShortMessage{DestAddr: "989121234567", Options: map[uint16][]byte{}},
+		},
+		{
+			name: "long message goes in message_payload",
+			sm:   ShortMessage{DestAddr: "989121234567", Message: long},
+			wantOptions: map[uint16][]byte{
+				TagMessagePayload: long,
+			},
+		},
+		{
+			name: "options are kept",
+			sm: ShortMessage{
+				ESMClass: esmClassReceipt, Message: []byte("id:1"),
+				Options: map[uint16][]byte{
+					TagReceiptedMessageID: []byte("1\x00"),
+					TagMessageState:       {2},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnmarshalShortMessage(tt.sm.Marshal())
+			if err != nil {
+				t.Fatalf("UnmarshalShortMessage: %v", err)
+			}
+
+			want := tt.sm
+			if tt.wantOptions != nil {
+				want.Options = tt.wantOptions
+			}
+			if len(want.Message) == 0 {
+				want.Message = nil
+			}
+			if len(got.Message) == 0 {
+				got.Message = nil
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("short message = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalShortMessageTruncated(t *testing.T) {
+	body := ShortMessage{DestAddr: "989121234567", Message: []byte("hello")}.Marshal()
+
+	for _, n := range []int{0, 1, 5, len(body) - 1} {
+		if _, err := UnmarshalShortMessage(body[:n]); err == nil {
+			t.Fatalf("UnmarshalShortMessage of %d of %d bytes succeeded, want an error", n, len(body))
+		}
+	}
+}
+
+func TestParseCString(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "message id", body: CString("abc123"), want: "abc123"},
+		{name: "empty", body: CString(""), want: ""},
+		{name: "trailing bytes", body: append(CString("id"), 1, 2), want: "id"},
+		{name: "not terminated", body: []byte("abc"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCString(tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("ParseCString = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageEncoding(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		wantCoding byte
+		wantLen    int
+	}{
+		{name: "ascii", text: "hello", wantCoding: CodingIA5, wantLen: 5},
+		{name: "persian", text: "سلام", wantCoding: CodingUCS2, wantLen: 8},
+		{name: "surrogate pair", text: "ok 👍", wantCoding: CodingUCS2, wantLen: 10},
+		{name: "empty", text: "", wantCoding: CodingIA5, wantLen: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coding, b := EncodeMessage(tt.text)
+			if coding != tt.wantCoding || len(b) != tt.wantLen {
+				t.Fatalf("EncodeMessage = (%#x, %d bytes), want (%#x, %d bytes)", coding, len(b), tt.wantCoding, tt.wantLen)
+			}
+			if got := DecodeMessage(coding, b); got != tt.text {
+				t.Fatalf("DecodeMessage = %q, want %q", got, tt.text)
+			}
+		})
+	}
+}
+
+func TestDeliveryReceiptRoundTrip(t *testing.T) {
+	date := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		receipt DeliveryReceipt
+	}{
+		{
+			name:    "delivered",
+			receipt: DeliveryReceipt{ID: "msg-1", Stat: StatDelivered, Err: "000", SubmitDate: date, DoneDate: date, Text: "hello"},
+		},
+		{
+			name:    "undeliverable",
+			receipt: DeliveryReceipt{ID: "msg-2", Stat: StatUndeliverable, Err: "034", SubmitDate: date, DoneDate: date},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm, err := UnmarshalShortMessage(tt.receipt.Marshal("gateway", "989121234567").Marshal())
+			if err != nil {
+				t.Fatalf("UnmarshalShortMessage: %v", err)
+			}
+
+			got, ok := ParseDeliveryReceipt(sm)
+			if !ok {
+				t.Fatal("ParseDeliveryReceipt did not find a receipt")
+			}
+			if got != tt.receipt {
+				t.Fatalf("receipt = %+v, want %+v", got, tt.receipt)
+			}
+		})
+	}
+}
+
+func TestParseDeliveryReceipt(t *testing.T) {
+	tests := []struct {
+		name   string
+		sm     ShortMessage
+		wantOk bool
+		wantID string
+		stat   string
+	}{
+		{
+			name: "mobile originated",
+			sm:   ShortMessage{Message: []byte("id:1 stat:DELIVRD")},
+		},
+		{
+			name:   "text only",
+			sm:     ShortMessage{ESMClass: esmClassReceipt, Message: []byte("id:abc sub:001 dlvrd:001 stat:delivrd err:000")},
+			wantOk: true, wantID: "abc", stat: StatDelivered,
+		},
+		{
+			name: "options win over the text",
+			sm: ShortMessage{
+				ESMClass: esmClassReceipt,
+				Message:  []byte("id:abc stat:DELIVRD"),
+				Options: map[uint16][]byte{
+					TagReceiptedMessageID: []byte("xyz\x00"),
+					TagMessageState:       {5},
+				},
+			},
+			wantOk: true, wantID: "xyz", stat: StatUndeliverable,
+		},
+		{
+			name: "receipt without id",
+			sm:   ShortMessage{ESMClass: esmClassReceipt, Message: []byte("stat:DELIVRD")},
+			stat: StatDelivered,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseDeliveryReceipt(tt.sm)
+			if ok != tt.wantOk {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOk)
+			}
+			if got.ID != tt.wantID || got.Stat != tt.stat {
+				t.Fatalf("receipt = %+v, want id %q stat %q", got, tt.wantID, tt.stat)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package smpp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// receipt stat values of the SMPP 3.4 appendix B delivery receipt format
+const (
+	StatDelivered     = "DELIVRD"
+	StatExpired       = "EXPIRED"
+	StatDeleted       = "DELETED"
+	StatUndeliverable = "UNDELIV"
+	StatAccepted      = "ACCEPTD"
+	StatUnknown       = "UNKNOWN"
+	StatRejected      = "REJECTD"
+	StatEnroute       = "ENROUTE"
+)
+
+// esmClassReceipt marks a deliver_sm that carries a delivery receipt
+const esmClassReceipt byte = 0x04
+
+const receiptDateLayout = "0601021504"
+
+// messageStates maps the message_state parameter to the receipt stat values
+var messageStates = map[byte]string{
+	1: StatEnroute,
+	2: StatDelivered,
+	3: StatExpired,
+	4: StatDeleted,
+	5: StatUndeliverable,
+	6: StatAccepted,
+	7: StatUnknown,
+	8: StatRejected,
+}
+
+// DeliveryReceipt is the outcome of a submitted message reported by the SMSC.
+type DeliveryReceipt struct {
+	// ID is the message id returned in submit_sm_resp
+	ID         string
+	Stat       string
+	Err        string
+	SubmitDate time.Time
+	DoneDate   time.Time
+	Text       string
+}
+
+// ParseDeliveryReceipt reads the receipt of a deliver_sm, ok is false when the
+// deliver_sm is a mobile originated message. The receipted_message_id and
+// message_state parameters win over the text when both are present.
+func ParseDeliveryReceipt(sm ShortMessage) (DeliveryReceipt, bool) {
+	if sm.ESMClass&0x3C != esmClassReceipt {
+		return DeliveryReceipt{}, false
+	}
+
+	text := string(sm.Message)
+	receipt := DeliveryReceipt{
+		ID:   receiptField(text, "id:"),
+		Stat: strings.ToUpper(receiptField(text, "stat:")),
+		Err:  receiptField(text, "err:"),
+	}
+	receipt.SubmitDate, _ = time.Parse(receiptDateLayout, receiptField(text, "submit date:"))
+	receipt.DoneDate, _ = time.Parse(receiptDateLayout, receiptField(text, "done date:"))
+	if i := strings.Index(strings.ToLower(text), "text:"); i >= 0 {
+		receipt.Text = text[i+len("text:"):]
+	}
+
+	if id, ok := sm.Options[TagReceiptedMessageID]; ok {
+		receipt.ID = strings.TrimRight(string(id), "\x00")
+	}
+	if state, ok := sm.Options[TagMessageState]; ok && len(state) == 1 {
+		if stat, ok := messageStates[state[0]]; ok {
+			receipt.Stat = stat
+		}
+	}
+
+	return receipt, receipt.ID != ""
+}
+
+// Marshal returns a deliver_sm carrying the receipt in both the text and the
+// optional parameters, the way most SMSCs send it.
+func (r DeliveryReceipt) Marshal(source, dest string) ShortMessage {
+	text := fmt.Sprintf(
+		"id:%s sub:001 dlvrd:%s submit date:%s done date:%s stat:%s err:%s text:%.20s",
+		r.ID,
+		delivered(r.Stat),
+		r.SubmitDate.Format(receiptDateLayout),
+		r.DoneDate.Format(receiptDateLayout),
+		r.Stat,
+		r.Err,
+		r.Text,
+	)
+
+	options := map[uint16][]byte{
+		TagReceiptedMessageID: append([]byte(r.ID), 0),
+	}
+	for state, stat := range messageStates {
+		if stat == r.Stat {
+			options[TagMessageState] = []byte{state}
+		}
+	}
+
+	return ShortMessage{
+		SourceTON:  1,
+		SourceNPI:  1,
+		SourceAddr: source,
+		DestAddr:   dest,
+		ESMClass:   esmClassReceipt,
+		Message:    []byte(text),
+		Options:    options,
+	}
+}
+
+func delivered(stat string) string {
+	if stat == StatDelivered {
+		return "001"
+	}
+	return "000"
+}
+
+// receiptField returns the value after key up to the next space.
+func receiptField(text, key string) string {
+	i := strings.Index(strings.ToLower(text), key)
+	if i < 0 {
+		return ""
+	}
+	value := text[i+len(key):]
+	if end := strings.IndexByte(value, ' '); end >= 0 {
+		value = value[:end]
+	}
+	return value
+}
+
+// EncodeMessage picks IA5 for plain ASCII text and UCS-2 for everything else.
+func EncodeMessage(text string) (byte, []byte) {
+	ascii := true
+	for i := 0; i < len(text); i++ {
+		if text[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return CodingIA5, []byte(text)
+	}
+
+	units := utf16.Encode([]rune(text))
+	b := make([]byte, 0, len(units)*2)
+	for _, u := range units {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return CodingUCS2, b
+}
+
+// DecodeMessage is the reverse of EncodeMessage.
+func DecodeMessage(coding byte, b []byte) string {
+	if coding != CodingUCS2 {
+		return string(b)
+	}
+
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
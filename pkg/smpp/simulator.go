@@ -0,0 +1,147 @@
+package smpp
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Simulator is a minimal SMSC for local runs. It accepts any bind, answers
+// enquire_link and submit_sm and sends a delivery receipt for every submit_sm
+// that asked for one.
+type Simulator struct {
+	listener net.Listener
+	logger   *logrus.Logger
+	// ReceiptDelay is how long after the submit the receipt is sent
+	ReceiptDelay time.Duration
+	// FailureRate is the share of messages that are reported undeliverable
+	FailureRate float64
+}
+
+func NewSimulator(addr string, logger *logrus.Logger) (*Simulator, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "smsc simulator: failed to listen")
+	}
+
+	return &Simulator{
+		listener:     listener,
+		logger:       logger,
+		ReceiptDelay: time.Second,
+		FailureRate:  0.05,
+	}, nil
+}
+
+func (s *Simulator) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Serve accepts sessions until ctx is done.
+func (s *Simulator) Serve(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		_ = s.listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				s.logger.Errorf("smsc simulator: accept failed: %v", err)
+			}
+			return
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handle(ctx, conn)
+		}()
+	}
+}
+
+func (s *Simulator) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	var (
+		writeMu sync.Mutex
+		seq     atomic.Uint32
+	)
+	write := func(pdu PDU) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if err := WritePDU(conn, pdu); err != nil {
+			s.logger.Warnf("smsc simulator: write failed: %v", err)
+		}
+	}
+
+	for {
+		pdu, err := ReadPDU(conn)
+		if err != nil {
+			return
+		}
+
+		switch pdu.CommandID {
+		case BindTransceiver, BindTransmitter, BindReceiver:
+			write(PDU{CommandID: pdu.CommandID | Resp, Sequence: pdu.Sequence, Body: CString("smsc-simulator")})
+		case EnquireLink:
+			write(PDU{CommandID: EnquireLink | Resp, Sequence: pdu.Sequence})
+		case Unbind:
+			write(PDU{CommandID: Unbind | Resp, Sequence: pdu.Sequence})
+			return
+		case SubmitSM:
+			sm, err := UnmarshalShortMessage(pdu.Body)
+			if err != nil {
+				write(PDU{CommandID: SubmitSM | Resp, Status: StatusInvMsgLen, Sequence: pdu.Sequence})
+				continue
+			}
+
+			id := uuid.NewString()
+			write(PDU{CommandID: SubmitSM | Resp, Sequence: pdu.Sequence, Body: CString(id)})
+
+			if sm.RegisteredDelivery&0x01 == 0 {
+				continue
+			}
+
+			submitted := time.Now()
+			time.AfterFunc(s.ReceiptDelay, func() {
+				receipt := DeliveryReceipt{
+					ID:         id,
+					Stat:       StatDelivered,
+					Err:        "000",
+					SubmitDate: submitted,
+					DoneDate:   time.Now(),
+					Text:       DecodeMessage(sm.DataCoding, sm.Message),
+				}
+				if rand.Float64() < s.FailureRate {
+					receipt.Stat = StatUndeliverable
+					receipt.Err = "001"
+				}
+
+				write(PDU{
+					CommandID: DeliverSM,
+					Sequence:  seq.Add(1),
+					Body:      receipt.Marshal(sm.DestAddr, sm.SourceAddr).Marshal(),
+				})
+			})
+		case DeliverSM | Resp:
+		default:
+			write(PDU{CommandID: GenericNack, Status: StatusInvCmdID, Sequence: pdu.Sequence})
+		}
+	}
+}
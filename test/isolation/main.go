@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tenant isolation suite: one customer sends messages, another one tries to
+// read, list, export and cancel them through every read path of the API.
+// Run it against a running stack with `make isolation`.
+
+const (
+	serverURL = "http://server:8080"
+	dsn       = "host=postgres user=messenger password=messenger dbname=messenger port=5432 sslmode=disable"
+	redisAddr = "redis:6379"
+
+	// the status log is written the fastest for enterprise customers
+	planName = "enterprise"
+
+	// ids far above the simulator users
+	customerBase = 900000000
+	balance      = 10000
+
+	// time for a message to reach the status log in ClickHouse
+	visibleTimeout = 60 * time.Second
+)
+
+type Balance struct {
+	CustomerId    int   `gorm:"primary_key;column:customer_id"`
+	BalanceBigint int64 `gorm:"column:balance_bigint"`
+}
+
+func (Balance) TableName() string {
+	return "balances"
+}
+
+type ApiKey struct {
+	CustomerId int    `gorm:"column:customer_id"`
+	PlanId     int64  `gorm:"column:plan_id"`
+	KeyHash    string `gorm:"column:key_hash"`
+	// keys without an id of their own are found by their hash
+	KeyId string `gorm:"column:key_id"`
+}
+
+func (ApiKey) TableName() string {
+	return "api_keys"
+}
+
+type Customer struct {
+	ID     int
+	ApiKey string
+}
+
+type Suite struct {
+	httpClient *http.Client
+	db         *gorm.DB
+	redis      *redis.Client
+
+	owner    Customer
+	intruder Customer
+	marker   string
+	from     time.Time
+
+	passed int
+	failed int
+}
+
+type sendResponse struct {
+	Data struct {
+		MessageId string `json:"message_id"`
+	} `json:"data"`
+}
+
+type listResponse struct {
+	Data []struct {
+		ID string `json:"ID"`
+	} `json:"data"`
+}
+
+func NewSuite(db *gorm.DB, redisClient *redis.Client) *Suite {
+	first := customerBase + rand.Intn(1000000)*2
+	return &Suite{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		db:         db,
+		redis:      redisClient,
+		owner:      Customer{ID: first, ApiKey: fmt.Sprintf("isolation-%d-%d", first, rand.Int63())},
+		intruder:   Customer{ID: first + 1, ApiKey: fmt.Sprintf("isolation-%d-%d", first+1, rand.Int63())},
+		marker:     fmt.Sprintf("isolation-%d", time.Now().UnixNano()),
+		from:       time.Now().UTC().Add(-time.Minute),
+	}
+}
+
+// charge gives both customers an api key and a balance in postgres and in
+// the redis cache the server charges from.
+func (s *Suite) charge(ctx context.Context) error {
+	var planId int64
+	if err := s.db.WithContext(ctx).Table("plans").Select("id").Where("name = ?", planName).
+		Scan(&planId).Error; err != nil || planId == 0 {
+		return fmt.Errorf("failed to get the %s plan: %v", planName, err)
+	}
+
+	for _, customer := range []Customer{s.owner, s.intruder} {
+		hash := sha256.Sum256([]byte(customer.ApiKey))
+		if err := s.db.WithContext(ctx).Create(&ApiKey{
+			CustomerId: customer.ID,
+			PlanId:     planId,
+			KeyHash:    hex.EncodeToString(hash[:]),
+			KeyId:      hex.EncodeToString(hash[:]),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to create api key of customer %d: %w", customer.ID, err)
+		}
+		if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "customer_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"balance_bigint"}),
+		}).Create(&Balance{CustomerId: customer.ID, BalanceBigint: balance}).Error; err != nil {
+			return fmt.Errorf("failed to charge customer %d: %w", customer.ID, err)
+		}
+		if err := s.redis.Set(ctx, fmt.Sprintf("balance:%d", customer.ID), balance, 0).Err(); err != nil {
+			return fmt.Errorf("failed to cache balance of customer %d: %w", customer.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Suite) do(ctx context.Context, customer Customer, method, path, body string) (int, []byte, error) {
+	return s.doAs(ctx, customer.ApiKey, customer.ID, method, path, body)
+}
+
+// doAs sends a request with the given key and gateway user header, they do
+// not have to belong together.
+func (s *Suite) doAs(ctx context.Context, apiKey string, userId int, method, path, body string) (int, []byte, error) {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, serverURL+path, reader)
+	if err != nil {
+		return 0, nil, fmt.Errorf("create request error: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", apiKey)
+	req.Header.Set("X-Auth-User-Id", fmt.Sprintf("%d", userId))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("read body error: %w", err)
+	}
+	return resp.StatusCode, data, nil
+}
+
+func (s *Suite) send(ctx context.Context, sendAt *time.Time) (string, error) {
+	body := map[string]interface{}{
+		"phone_number": fmt.Sprintf("+1%010d", rand.Intn(9999999999)),
+		"message":      s.marker,
+	}
+	if sendAt != nil {
+		body["send_at"] = sendAt.Format(time.RFC3339)
+	}
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("marshal error: %w", err)
+	}
+
+	code, data, err := s.do(ctx, s.owner, http.MethodPost, "/v1/sms/send", string(jsonBody))
+	if err != nil {
+		return "", err
+	}
+	if code != http.StatusOK {
+		return "", fmt.Errorf("send status code: %d, body: %s", code, data)
+	}
+
+	var resp sendResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", fmt.Errorf("unmarshal error: %w", err)
+	}
+	return resp.Data.MessageId, nil
+}
+
+// waitVisible polls the timeline of the owner until the message is in the
+// status log, so a 404 for the intruder is not just replication lag.
+func (s *Suite) waitVisible(ctx context.Context, messageId string) error {
+	deadline := time.Now().Add(visibleTimeout)
+	for time.Now().Before(deadline) {
+		code, _, err := s.do(ctx, s.owner, http.MethodGet, "/v1/sms/"+messageId, "")
+		if err != nil {
+			return err
+		}
+		if code == http.StatusOK {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("message %s did not reach the status log in %s", messageId, visibleTimeout)
+}
+
+func (s *Suite) check(name string, err error) {
+	if err != nil {
+		s.failed++
+		fmt.Printf("❌ %s: %v\n", name, err)
+		return
+	}
+	s.passed++
+	fmt.Printf("✅ %s\n", name)
+}
+
+func (s *Suite) expectStatus(ctx context.Context, customer Customer, method, path string, want int) error {
+	code, data, err := s.do(ctx, customer, method, path, "")
+	if err != nil {
+		return err
+	}
+	if code != want {
+		return fmt.Errorf("status code: %d, want %d, body: %s", code, want, data)
+	}
+	return nil
+}
+
+// listed reports whether the message comes back in the message list of the
+// customer searched by the marker.
+func (s *Suite) listed(ctx context.Context, customer Customer, messageId string) (bool, error) {
+	path := "/v1/sms/log?page_size=100&q=" + url.QueryEscape(s.marker)
+	code, data, err := s.do(ctx, customer, http.MethodGet, path, "")
+	if err != nil {
+		return false, err
+	}
+	if code != http.StatusOK {
+		return false, fmt.Errorf("status code: %d, body: %s", code, data)
+	}
+
+	var resp listResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return false, fmt.Errorf("unmarshal error: %w", err)
+	}
+	for _, item := range resp.Data {
+		if item.ID == messageId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// exported reports whether the message is in the ndjson export of the
+// customer since the suite started.
+func (s *Suite) exported(ctx context.Context, customer Customer, messageId string) (bool, error) {
+	query := url.Values{
+		"format": {"ndjson"},
+		"from":   {s.from.Format(time.RFC3339)},
+		"to":     {time.Now().UTC().Add(time.Minute).Format(time.RFC3339)},
+	}
+	code, data, err := s.do(ctx, customer, http.MethodGet, "/v1/sms/log/export?"+query.Encode(), "")
+	if err != nil {
+		return false, err
+	}
+	if code != http.StatusOK {
+		return false, fmt.Errorf("status code: %d, body: %s", code, data)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var item struct {
+			ID string `json:"ID"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			return false, fmt.Errorf("unmarshal error: %w", err)
+		}
+		if item.ID == messageId {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func expect(found bool, err error, want bool) error {
+	if err != nil {
+		return err
+	}
+	if found != want {
+		return fmt.Errorf("found: %t, want %t", found, want)
+	}
+	return nil
+}
+
+type keyResponse struct {
+	Data struct {
+		KeyID string `json:"key_id"`
+		Key   string `json:"key"`
+	} `json:"data"`
+}
+
+// checkApiKeys issues a key for the owner, checks that the intruder can
+// neither see nor revoke it, and that it stops working once revoked.
+func (s *Suite) checkApiKeys(ctx context.Context) {
+	code, data, err := s.do(ctx, s.owner, http.MethodPost, "/v1/api-keys", `{"label":"isolation"}`)
+	if err == nil && code != http.StatusCreated {
+		err = fmt.Errorf("status code: %d, body: %s", code, data)
+	}
+	var created keyResponse
+	if err == nil {
+		err = json.Unmarshal(data, &created)
+	}
+	s.check("owner creates an api key", err)
+	if err != nil {
+		return
+	}
+	issued := Customer{ID: s.owner.ID, ApiKey: created.Data.Key}
+
+	code, data, err = s.do(ctx, s.intruder, http.MethodGet, "/v1/api-keys", "")
+	if err == nil && (code != http.StatusOK || strings.Contains(string(data), created.Data.KeyID)) {
+		err = fmt.Errorf("status code: %d, body: %s", code, data)
+	}
+	s.check("intruder does not find the key in its key list", err)
+
+	s.check("intruder gets 404 revoking the key",
+		s.expectStatus(ctx, s.intruder, http.MethodDelete, "/v1/api-keys/"+created.Data.KeyID, http.StatusNotFound))
+	s.check("issued key authenticates the owner",
+		s.expectStatus(ctx, issued, http.MethodGet, "/v1/api-keys", http.StatusOK))
+	s.check("owner revokes the key",
+		s.expectStatus(ctx, s.owner, http.MethodDelete, "/v1/api-keys/"+created.Data.KeyID, http.StatusOK))
+	s.check("revoked key is rejected",
+		s.expectStatus(ctx, issued, http.MethodGet, "/v1/api-keys", http.StatusUnauthorized))
+}
+
+// Run sends the messages of the owner and checks every read path of both
+// customers, it returns false if any check failed.
+func (s *Suite) Run(ctx context.Context) bool {
+	fmt.Printf("🔒 Tenant isolation suite\n")
+	fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
+	fmt.Printf("Target Server:     %s\n", serverURL)
+	fmt.Printf("Owner:             %d\n", s.owner.ID)
+	fmt.Printf("Intruder:          %d\n", s.intruder.ID)
+	fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n\n")
+
+	if err := s.charge(ctx); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return false
+	}
+
+	sent, err := s.send(ctx, nil)
+	if err != nil {
+		fmt.Printf("❌ failed to send: %v\n", err)
+		return false
+	}
+	sendAt := time.Now().UTC().Add(time.Hour)
+	scheduled, err := s.send(ctx, &sendAt)
+	if err != nil {
+		fmt.Printf("❌ failed to schedule: %v\n", err)
+		return false
+	}
+
+	for _, messageId := range []string{sent, scheduled} {
+		if err := s.waitVisible(ctx, messageId); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return false
+		}
+	}
+
+	s.check("intruder gets 404 for the timeline of a sent message",
+		s.expectStatus(ctx, s.intruder, http.MethodGet, "/v1/sms/"+sent, http.StatusNotFound))
+	s.check("intruder gets 404 for the timeline of a scheduled message",
+		s.expectStatus(ctx, s.intruder, http.MethodGet, "/v1/sms/"+scheduled, http.StatusNotFound))
+	s.check("intruder gets 404 cancelling a scheduled message",
+		s.expectStatus(ctx, s.intruder, http.MethodDelete, "/v1/sms/"+scheduled, http.StatusNotFound))
+
+	code, data, err := s.doAs(ctx, s.intruder.ApiKey, s.owner.ID, http.MethodGet, "/v1/sms/"+sent, "")
+	if err == nil && code == http.StatusOK {
+		err = fmt.Errorf("status code: %d, body: %s", code, data)
+	}
+	s.check("intruder key with the owner's user id cannot read the message", err)
+
+	found, err := s.listed(ctx, s.intruder, sent)
+	s.check("intruder does not find the message in the message list", expect(found, err, false))
+	found, err = s.exported(ctx, s.intruder, sent)
+	s.check("intruder does not find the message in the export", expect(found, err, false))
+
+	found, err = s.listed(ctx, s.owner, sent)
+	s.check("owner finds the message in the message list", expect(found, err, true))
+	found, err = s.exported(ctx, s.owner, sent)
+	s.check("owner finds the message in the export", expect(found, err, true))
+	s.check("owner cancels the scheduled message",
+		s.expectStatus(ctx, s.owner, http.MethodDelete, "/v1/sms/"+scheduled, http.StatusOK))
+
+	s.checkApiKeys(ctx)
+
+	fmt.Printf("\n━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
+	fmt.Printf("Passed: %d, Failed: %d\n", s.passed, s.failed)
+	fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
+
+	return s.failed == 0
+}
+
+func main() {
+	ctx := context.Background()
+	rand.Seed(time.Now().UnixNano())
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		fmt.Printf("❌ Failed to connect to database: %v\n", err)
+		os.Exit(1)
+	}
+
+	redisClient := redis.NewClient(&redis.Options{Addr: redisAddr})
+	defer redisClient.Close()
+
+	if !NewSuite(db, redisClient).Run(ctx) {
+		os.Exit(1)
+	}
+}
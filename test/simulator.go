@@ -3,6 +3,8 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -45,6 +47,18 @@ func (Balance) TableName() string {
 	return "balances"
 }
 
+type ApiKey struct {
+	CustomerId int    `gorm:"column:customer_id"`
+	PlanId     int64  `gorm:"column:plan_id"`
+	KeyHash    string `gorm:"column:key_hash"`
+	// keys without an id of their own are found by their hash
+	KeyId string `gorm:"column:key_id"`
+}
+
+func (ApiKey) TableName() string {
+	return "api_keys"
+}
+
 type Stats struct {
 	totalRequests           atomic.Int64
 	successRequests         atomic.Int64
@@ -114,7 +128,7 @@ func generateUsers(numUsers int) []User {
 		users[i] = User{
 			ID:     i + 1,
 			Plan:   plan,
-			ApiKey: plan.ApiKey,
+			ApiKey: fmt.Sprintf("simulator-%d-%s", i+1, plan.Name),
 		}
 	}
 
@@ -279,6 +293,10 @@ func (s *Simulator) chargeUsers(ctx context.Context) error {
 		}
 	}
 
+	if err := s.createApiKeys(ctx); err != nil {
+		return err
+	}
+
 	avgBalance := totalBalance / int64(len(s.users))
 	fmt.Printf("✅ Charged %d users with balances (avg: %d, total: %d)\n",
 		len(s.users), avgBalance, totalBalance)
@@ -287,6 +305,41 @@ func (s *Simulator) chargeUsers(ctx context.Context) error {
 	return nil
 }
 
+// createApiKeys stores the key of every user with their plan, keys that
+// exist already are kept
+func (s *Simulator) createApiKeys(ctx context.Context) error {
+	var planRows []struct {
+		ID   int64
+		Name string
+	}
+	if err := s.db.WithContext(ctx).Table("plans").Select("id, name").Scan(&planRows).Error; err != nil {
+		return fmt.Errorf("failed to get plans: %w", err)
+	}
+	planIds := make(map[string]int64, len(planRows))
+	for _, plan := range planRows {
+		planIds[plan.Name] = plan.ID
+	}
+
+	keys := make([]ApiKey, len(s.users))
+	for i, user := range s.users {
+		hash := sha256.Sum256([]byte(user.ApiKey))
+		keys[i] = ApiKey{
+			CustomerId: user.ID,
+			PlanId:     planIds[user.Plan.Name],
+			KeyHash:    hex.EncodeToString(hash[:]),
+			KeyId:      hex.EncodeToString(hash[:]),
+		}
+	}
+
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(keys, 1000).Error; err != nil {
+		return fmt.Errorf("failed to insert api keys: %w", err)
+	}
+
+	fmt.Printf("🔑 Created api keys for %d users\n", len(s.users))
+	return nil
+}
+
 // Run starts the load test
 func (s *Simulator) Run(ctx context.Context) {
 	fmt.Printf("🚀 Starting Load Test Simulator\n")